@@ -0,0 +1,172 @@
+package alerts
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"stock-management/config"
+	"stock-management/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notifier delivers stock alerts through one channel. Notify gets a batch
+// of alerts and fails or succeeds for the whole batch.
+type Notifier interface {
+	Name() string
+	Notify(alerts []models.StockAlert) error
+}
+
+const dispatchBatchSize = 100
+
+// deliveryLog tracks which open alerts each notifier still has to deliver
+// and how often it has tried
+type deliveryLog interface {
+	Undelivered(notifier string, maxAttempts, limit int) ([]models.StockAlert, error)
+	Record(alertIDs []int, notifier string, deliveryErr error) error
+}
+
+// dbDeliveryLog keeps the log in stock_alert_deliveries
+type dbDeliveryLog struct {
+	db *sql.DB
+}
+
+func (l dbDeliveryLog) Undelivered(notifier string, maxAttempts, limit int) ([]models.StockAlert, error) {
+	return models.GetUndeliveredStockAlerts(l.db, notifier, maxAttempts, limit)
+}
+
+func (l dbDeliveryLog) Record(alertIDs []int, notifier string, deliveryErr error) error {
+	return models.RecordStockAlertDeliveries(l.db, alertIDs, notifier, deliveryErr)
+}
+
+// Dispatcher delivers open alerts through each notifier and records every
+// attempt, so an alert reaches each channel once and failed channels retry
+// on the next run, up to maxAttempts, without repeating the others
+type Dispatcher struct {
+	deliveries  deliveryLog
+	notifiers   []Notifier
+	maxAttempts int
+	mu          sync.Mutex
+}
+
+func NewDispatcher(db *sql.DB, notifiers []Notifier, maxAttempts int) *Dispatcher {
+	return &Dispatcher{deliveries: dbDeliveryLog{db}, notifiers: notifiers, maxAttempts: maxAttempts}
+}
+
+func (d *Dispatcher) Notifiers() []Notifier {
+	return d.notifiers
+}
+
+// Dispatch makes one delivery pass and returns how many alerts each
+// notifier delivered
+func (d *Dispatcher) Dispatch() (map[string]int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delivered := map[string]int{}
+	for _, notifier := range d.notifiers {
+		for {
+			pending, err := d.deliveries.Undelivered(notifier.Name(), d.maxAttempts, dispatchBatchSize)
+			if err != nil {
+				return delivered, err
+			}
+			if len(pending) == 0 {
+				break
+			}
+
+			ids := make([]int, len(pending))
+			for i, alert := range pending {
+				ids[i] = alert.ID
+			}
+			notifyErr := notifier.Notify(pending)
+			if err := d.deliveries.Record(ids, notifier.Name(), notifyErr); err != nil {
+				return delivered, err
+			}
+			if notifyErr != nil {
+				log.Printf("❌ %s alert delivery failed: %v", notifier.Name(), notifyErr)
+				break
+			}
+			delivered[notifier.Name()] += len(pending)
+			if len(pending) < dispatchBatchSize {
+				break
+			}
+		}
+	}
+	return delivered, nil
+}
+
+// Start runs Dispatch every interval in the background
+func (d *Dispatcher) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := d.Dispatch(); err != nil {
+				log.Printf("❌ Stock alert dispatch failed: %v", err)
+			}
+		}
+	}()
+}
+
+var (
+	mu         sync.RWMutex
+	dispatcher *Dispatcher
+)
+
+// Init builds the notifiers named in ALERT_NOTIFIERS
+func Init(db *sql.DB) error {
+	settings := config.GetAlertSettings()
+	var notifiers []Notifier
+	for _, name := range settings.Notifiers {
+		switch name {
+		case "in_app":
+			notifiers = append(notifiers, NewInApp(db))
+		case "webhook":
+			webhook, err := NewWebhook(settings.WebhookURL, settings.WebhookSecret)
+			if err != nil {
+				return err
+			}
+			notifiers = append(notifiers, webhook)
+		case "smtp":
+			mailer, err := NewSMTP(settings)
+			if err != nil {
+				return err
+			}
+			notifiers = append(notifiers, mailer)
+		default:
+			return fmt.Errorf("unknown alert notifier %q", name)
+		}
+	}
+	Use(NewDispatcher(db, notifiers, settings.MaxAttempts))
+	return nil
+}
+
+// Use replaces the dispatcher, e.g. with one using stub notifiers in tests
+func Use(d *Dispatcher) {
+	mu.Lock()
+	dispatcher = d
+	mu.Unlock()
+}
+
+// Default returns the dispatcher set up by Init
+func Default() *Dispatcher {
+	mu.RLock()
+	defer mu.RUnlock()
+	return dispatcher
+}
+
+// Summary is the one-line description of an alert used by every notifier
+func Summary(alert models.StockAlert) string {
+	variant := alert.ItemName
+	if details := strings.TrimSpace(strings.Join([]string{alert.Size, alert.Color}, " ")); details != "" {
+		variant += " (" + details + ")"
+	}
+	if alert.SKU != "" {
+		variant += " [" + alert.SKU + "]"
+	}
+	if alert.AlertType == models.AlertOutOfStock {
+		return fmt.Sprintf("Out of stock at %s: %s", alert.StoreName, variant)
+	}
+	return fmt.Sprintf("Low stock at %s: %s has %d left (threshold %d)", alert.StoreName, variant, alert.Quantity, alert.Threshold)
+}
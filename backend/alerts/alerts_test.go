@@ -0,0 +1,230 @@
+package alerts
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stock-management/models"
+	"sync"
+	"testing"
+)
+
+// memoryDeliveryLog is a deliveryLog kept in memory, counting attempts the
+// way stock_alert_deliveries does
+type memoryDeliveryLog struct {
+	alerts    []models.StockAlert
+	attempts  map[string]map[int]int
+	delivered map[string]map[int]bool
+}
+
+func newMemoryDeliveryLog(alerts ...models.StockAlert) *memoryDeliveryLog {
+	return &memoryDeliveryLog{alerts: alerts, attempts: map[string]map[int]int{}, delivered: map[string]map[int]bool{}}
+}
+
+func (l *memoryDeliveryLog) Undelivered(notifier string, maxAttempts, limit int) ([]models.StockAlert, error) {
+	var pending []models.StockAlert
+	for _, alert := range l.alerts {
+		if len(pending) == limit {
+			break
+		}
+		if !l.delivered[notifier][alert.ID] && l.attempts[notifier][alert.ID] < maxAttempts {
+			pending = append(pending, alert)
+		}
+	}
+	return pending, nil
+}
+
+func (l *memoryDeliveryLog) Record(alertIDs []int, notifier string, deliveryErr error) error {
+	if l.attempts[notifier] == nil {
+		l.attempts[notifier] = map[int]int{}
+		l.delivered[notifier] = map[int]bool{}
+	}
+	for _, id := range alertIDs {
+		l.attempts[notifier][id]++
+		if deliveryErr == nil {
+			l.delivered[notifier][id] = true
+		}
+	}
+	return nil
+}
+
+func testAlert(id int) models.StockAlert {
+	return models.StockAlert{
+		ID: id, StoreID: 1, StoreName: "Main", ProductVariantID: id, ItemName: "Runner",
+		Size: "9", SKU: "NIKE-RUN-9", AlertType: models.AlertLowStock, Quantity: 2, Threshold: 5,
+	}
+}
+
+// webhookServer answers with the statuses given, in order, then 200
+type webhookServer struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, body)
+	status := http.StatusOK
+	if len(s.statuses) > 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (s *webhookServer) hits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func newTestWebhook(t *testing.T, secret string, statuses ...int) (*Webhook, *webhookServer) {
+	t.Helper()
+	handler := &webhookServer{statuses: statuses}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	webhook, err := NewWebhook(server.URL, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webhook, handler
+}
+
+func TestWebhookSignsBody(t *testing.T) {
+	webhook, server := newTestWebhook(t, "s3cret")
+	if err := webhook.Notify([]models.StockAlert{testAlert(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if server.hits() != 1 {
+		t.Fatalf("webhook received %d requests, want 1", server.hits())
+	}
+
+	body := server.bodies[0]
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := server.requests[0].Header.Get(SignatureHeader); got != want {
+		t.Fatalf("%s = %q, want %q", SignatureHeader, got, want)
+	}
+
+	var payload struct {
+		Event  string `json:"event"`
+		Alerts []struct {
+			ID      int    `json:"id"`
+			Summary string `json:"summary"`
+		} `json:"alerts"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != "stock_alerts" || len(payload.Alerts) != 1 || payload.Alerts[0].ID != 1 {
+		t.Fatalf("unexpected payload %s", body)
+	}
+	if payload.Alerts[0].Summary != Summary(testAlert(1)) {
+		t.Errorf("summary = %q", payload.Alerts[0].Summary)
+	}
+}
+
+func TestWebhookWithoutSecretIsUnsigned(t *testing.T) {
+	webhook, server := newTestWebhook(t, "")
+	if err := webhook.Notify([]models.StockAlert{testAlert(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.requests[0].Header.Get(SignatureHeader); got != "" {
+		t.Fatalf("%s = %q without a secret", SignatureHeader, got)
+	}
+}
+
+func TestWebhookErrorStatusFails(t *testing.T) {
+	webhook, _ := newTestWebhook(t, "", http.StatusBadGateway)
+	if err := webhook.Notify([]models.StockAlert{testAlert(1)}); err == nil {
+		t.Fatal("a 502 from the webhook was treated as delivered")
+	}
+}
+
+func TestDispatchRetriesUntilMaxAttempts(t *testing.T) {
+	const maxAttempts = 3
+	webhook, server := newTestWebhook(t, "", 500, 500, 500, 500, 500, 500)
+	deliveries := newMemoryDeliveryLog(testAlert(1))
+	d := &Dispatcher{deliveries: deliveries, notifiers: []Notifier{webhook}, maxAttempts: maxAttempts}
+
+	for i := 0; i < maxAttempts+2; i++ {
+		delivered, err := d.Dispatch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delivered["webhook"] != 0 {
+			t.Fatalf("pass %d delivered %d alerts through a failing webhook", i+1, delivered["webhook"])
+		}
+	}
+	if server.hits() != maxAttempts {
+		t.Fatalf("webhook was tried %d times, want %d", server.hits(), maxAttempts)
+	}
+	if got := deliveries.attempts["webhook"][1]; got != maxAttempts {
+		t.Fatalf("recorded %d attempts, want %d", got, maxAttempts)
+	}
+}
+
+func TestDispatchStopsRetryingOnceDelivered(t *testing.T) {
+	webhook, server := newTestWebhook(t, "", 500, 503)
+	deliveries := newMemoryDeliveryLog(testAlert(1), testAlert(2))
+	d := &Dispatcher{deliveries: deliveries, notifiers: []Notifier{webhook}, maxAttempts: 5}
+
+	total := 0
+	for i := 0; i < 5; i++ {
+		delivered, err := d.Dispatch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += delivered["webhook"]
+	}
+	if total != 2 {
+		t.Fatalf("delivered %d alerts, want 2", total)
+	}
+	if server.hits() != 3 {
+		t.Fatalf("webhook was called %d times, want 2 failures and 1 success", server.hits())
+	}
+}
+
+// failingNotifier always fails and counts its calls
+type failingNotifier struct {
+	calls int
+}
+
+func (n *failingNotifier) Name() string { return "failing" }
+
+func (n *failingNotifier) Notify([]models.StockAlert) error {
+	n.calls++
+	return errors.New("channel down")
+}
+
+func TestDispatchKeepsChannelsIndependent(t *testing.T) {
+	webhook, server := newTestWebhook(t, "")
+	failing := &failingNotifier{}
+	d := &Dispatcher{
+		deliveries:  newMemoryDeliveryLog(testAlert(1)),
+		notifiers:   []Notifier{failing, webhook},
+		maxAttempts: 2,
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := d.Dispatch(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if server.hits() != 1 {
+		t.Fatalf("webhook was called %d times, want once despite the other channel failing", server.hits())
+	}
+	if failing.calls != 2 {
+		t.Fatalf("failing channel was tried %d times, want 2", failing.calls)
+	}
+}
@@ -0,0 +1,42 @@
+package alerts
+
+import (
+	"database/sql"
+	"stock-management/models"
+)
+
+// InApp turns alerts into notifications listed by GET /notifications for
+// users of the alert's store
+type InApp struct {
+	db *sql.DB
+}
+
+func NewInApp(db *sql.DB) *InApp {
+	return &InApp{db: db}
+}
+
+func (n *InApp) Name() string {
+	return "in_app"
+}
+
+func (n *InApp) Notify(alerts []models.StockAlert) error {
+	for _, alert := range alerts {
+		title := "Low stock"
+		if alert.AlertType == models.AlertOutOfStock {
+			title = "Out of stock"
+		}
+		notification := models.Notification{
+			StoreID: &alert.StoreID,
+			Title:   title + ": " + alert.ItemName,
+			Message: Summary(alert),
+		}
+		// Test alerts are not stored, so they have no id to link to
+		if alert.ID != 0 {
+			notification.StockAlertID = &alert.ID
+		}
+		if err := models.CreateNotification(n.db, &notification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
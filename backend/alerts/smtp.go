@@ -0,0 +1,75 @@
+package alerts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"stock-management/config"
+	"stock-management/models"
+	"strings"
+	"time"
+)
+
+// SMTP emails each batch of alerts as one plain-text message. The
+// connection is upgraded with STARTTLS when the server offers it;
+// credentials are only sent when SMTP_USERNAME is set.
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+	// send is smtp.SendMail, replaced in tests
+	send func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewSMTP(settings config.AlertSettings) (*SMTP, error) {
+	if settings.SMTPHost == "" || settings.EmailFrom == "" || len(settings.EmailTo) == 0 {
+		return nil, errors.New("the smtp notifier needs SMTP_HOST, ALERT_EMAIL_FROM and ALERT_EMAIL_TO")
+	}
+	mailer := &SMTP{
+		addr: net.JoinHostPort(settings.SMTPHost, settings.SMTPPort),
+		from: settings.EmailFrom,
+		to:   settings.EmailTo,
+		send: smtp.SendMail,
+	}
+	if settings.SMTPUsername != "" {
+		mailer.auth = smtp.PlainAuth("", settings.SMTPUsername, settings.SMTPPassword, settings.SMTPHost)
+	}
+	return mailer, nil
+}
+
+func (s *SMTP) Name() string {
+	return "smtp"
+}
+
+func (s *SMTP) Notify(alerts []models.StockAlert) error {
+	return s.send(s.addr, s.auth, s.from, s.to, s.message(alerts))
+}
+
+func (s *SMTP) message(alerts []models.StockAlert) []byte {
+	subject := fmt.Sprintf("Stock alerts: %d items need attention", len(alerts))
+	if len(alerts) == 1 {
+		subject = Summary(alerts[0])
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", headerValue(s.from))
+	fmt.Fprintf(&msg, "To: %s\r\n", headerValue(strings.Join(s.to, ", ")))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", headerValue(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	for _, alert := range alerts {
+		fmt.Fprintf(&msg, "- %s\r\n", headerValue(Summary(alert)))
+	}
+	msg.WriteString("\r\nOpen alerts are listed at GET /stock-alerts.\r\n")
+	return msg.Bytes()
+}
+
+// headerValue keeps line breaks in product names out of the message
+// structure, where they could inject headers
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
@@ -0,0 +1,119 @@
+package alerts
+
+import (
+	"errors"
+	"net/smtp"
+	"stock-management/config"
+	"stock-management/models"
+	"strings"
+	"testing"
+)
+
+// sentMail is one message captured by a fake SMTP sender
+type sentMail struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+	msg  string
+}
+
+func newTestSMTP(t *testing.T, settings config.AlertSettings, sendErr error) (*SMTP, *[]sentMail) {
+	t.Helper()
+	mailer, err := NewSMTP(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent []sentMail
+	mailer.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		sent = append(sent, sentMail{addr, auth, from, to, string(msg)})
+		return sendErr
+	}
+	return mailer, &sent
+}
+
+func testSMTPSettings() config.AlertSettings {
+	return config.AlertSettings{
+		SMTPHost:  "mail.example.com",
+		SMTPPort:  "587",
+		EmailFrom: "stock@example.com",
+		EmailTo:   []string{"manager@example.com", "owner@example.com"},
+	}
+}
+
+func TestSMTPSendsOneMessagePerBatch(t *testing.T) {
+	mailer, sent := newTestSMTP(t, testSMTPSettings(), nil)
+	if err := mailer.Notify([]models.StockAlert{testAlert(1), testAlert(2)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(*sent))
+	}
+
+	mail := (*sent)[0]
+	if mail.addr != "mail.example.com:587" {
+		t.Errorf("addr = %q", mail.addr)
+	}
+	if mail.auth != nil {
+		t.Error("credentials were sent without SMTP_USERNAME")
+	}
+	if mail.from != "stock@example.com" || strings.Join(mail.to, ",") != "manager@example.com,owner@example.com" {
+		t.Errorf("envelope = %q -> %v", mail.from, mail.to)
+	}
+	if !strings.Contains(mail.msg, "Subject: Stock alerts: 2 items need attention\r\n") {
+		t.Errorf("missing batch subject in:\n%s", mail.msg)
+	}
+	if strings.Count(mail.msg, "- "+Summary(testAlert(1))+"\r\n") != 2 {
+		t.Errorf("body does not list both alerts:\n%s", mail.msg)
+	}
+}
+
+func TestSMTPSingleAlertSubject(t *testing.T) {
+	mailer, sent := newTestSMTP(t, testSMTPSettings(), nil)
+	if err := mailer.Notify([]models.StockAlert{testAlert(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Subject: " + Summary(testAlert(1)) + "\r\n"; !strings.Contains((*sent)[0].msg, want) {
+		t.Errorf("missing %q in:\n%s", want, (*sent)[0].msg)
+	}
+}
+
+func TestSMTPAuthWithUsername(t *testing.T) {
+	settings := testSMTPSettings()
+	settings.SMTPUsername = "stock"
+	settings.SMTPPassword = "pw"
+	mailer, sent := newTestSMTP(t, settings, nil)
+	if err := mailer.Notify([]models.StockAlert{testAlert(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if (*sent)[0].auth == nil {
+		t.Error("SMTP_USERNAME was set but no credentials were sent")
+	}
+}
+
+func TestSMTPKeepsLineBreaksOutOfHeaders(t *testing.T) {
+	mailer, sent := newTestSMTP(t, testSMTPSettings(), nil)
+	alert := testAlert(1)
+	alert.ItemName = "Runner\r\nBcc: attacker@example.com"
+	if err := mailer.Notify([]models.StockAlert{alert}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains((*sent)[0].msg, "\r\nBcc:") {
+		t.Fatalf("product name injected a header:\n%s", (*sent)[0].msg)
+	}
+}
+
+func TestSMTPReportsSendErrors(t *testing.T) {
+	mailer, _ := newTestSMTP(t, testSMTPSettings(), errors.New("connection refused"))
+	if err := mailer.Notify([]models.StockAlert{testAlert(1)}); err == nil {
+		t.Fatal("a failed send was treated as delivered")
+	}
+}
+
+func TestNewSMTPNeedsSettings(t *testing.T) {
+	settings := testSMTPSettings()
+	settings.EmailTo = nil
+	if _, err := NewSMTP(settings); err == nil {
+		t.Fatal("NewSMTP accepted settings without ALERT_EMAIL_TO")
+	}
+}
@@ -0,0 +1,96 @@
+package alerts
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"stock-management/models"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries "sha256=<hex HMAC of the body>" when the webhook
+// has a secret
+const SignatureHeader = "X-Signature-256"
+
+// Webhook POSTs alerts as JSON:
+//
+//	{"event": "stock_alerts", "sent_at": "...", "alerts": [{..., "summary": "..."}]}
+type Webhook struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+type webhookAlert struct {
+	models.StockAlert
+	Summary string `json:"summary"`
+}
+
+type webhookPayload struct {
+	Event  string         `json:"event"`
+	SentAt time.Time      `json:"sent_at"`
+	Alerts []webhookAlert `json:"alerts"`
+}
+
+func NewWebhook(target, secret string) (*Webhook, error) {
+	parsed, err := url.Parse(target)
+	if target == "" || err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, errors.New("the webhook notifier needs an http(s) ALERT_WEBHOOK_URL")
+	}
+	return &Webhook{
+		url:    target,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+func (w *Webhook) Notify(alerts []models.StockAlert) error {
+	payload := webhookPayload{Event: "stock_alerts", SentAt: time.Now().UTC()}
+	for _, alert := range alerts {
+		payload.Alerts = append(payload.Alerts, webhookAlert{alert, Summary(alert)})
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook responded %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// Sign is the hex HMAC-SHA256 of a webhook body, for receivers to compare
+// with SignatureHeader
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
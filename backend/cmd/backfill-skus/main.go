@@ -0,0 +1,65 @@
+// Command backfill-skus replaces missing and legacy SKU-<timestamp>-... SKUs
+// with ones generated from SKU_TEMPLATE.
+//
+//	go run ./cmd/backfill-skus            # show what would change
+//	go run ./cmd/backfill-skus -apply     # write the new SKUs
+package main
+
+import (
+	"flag"
+	"log"
+	"stock-management/config"
+	"stock-management/database"
+	"stock-management/models"
+)
+
+func main() {
+	apply := flag.Bool("apply", false, "write the new SKUs (default is a dry run)")
+	flag.Parse()
+
+	config.LoadConfig()
+	database.InitDB()
+	defer database.CloseDB()
+
+	db := database.GetDB()
+	variants, err := models.GetLegacySKUVariants(db)
+	if err != nil {
+		log.Fatalf("❌ Could not load variants: %v", err)
+	}
+	if len(variants) == 0 {
+		log.Println("✅ No legacy SKUs found")
+		return
+	}
+
+	template := config.GetSKUTemplate()
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatalf("❌ Could not start transaction: %v", err)
+	}
+
+	// All variants are renamed in one transaction so each new SKU sees the
+	// ones generated before it
+	for _, variant := range variants {
+		oldSKU := variant.SKU
+		if err := models.GenerateVariantSKUTx(tx, template, &variant); err != nil {
+			tx.Rollback()
+			log.Fatalf("❌ Variant %d: %v", variant.ID, err)
+		}
+		if err := models.SetVariantSKUTx(tx, variant.ID, variant.SKU); err != nil {
+			tx.Rollback()
+			log.Fatalf("❌ Variant %d: %v", variant.ID, err)
+		}
+		log.Printf("  variant %d: %q -> %q", variant.ID, oldSKU, variant.SKU)
+	}
+
+	if !*apply {
+		tx.Rollback()
+		log.Printf("ℹ️  Dry run: %d SKUs would change. Re-run with -apply to save.", len(variants))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("❌ Could not save SKUs: %v", err)
+	}
+	log.Printf("✅ Regenerated %d SKUs", len(variants))
+}
@@ -0,0 +1,59 @@
+// Command gc-uploads lists uploaded files that no variant or product image
+// refers to, and deletes those older than the grace period.
+//
+//	go run ./cmd/gc-uploads                 # report only
+//	go run ./cmd/gc-uploads -delete         # delete orphans past the grace period
+//	go run ./cmd/gc-uploads -grace 24h      # override ORPHAN_GRACE_PERIOD
+package main
+
+import (
+	"flag"
+	"log"
+	"stock-management/config"
+	"stock-management/database"
+	"stock-management/storage"
+)
+
+func main() {
+	remove := flag.Bool("delete", false, "delete orphans past the grace period (default is a report)")
+	grace := flag.Duration("grace", -1, "grace period (default ORPHAN_GRACE_PERIOD)")
+	flag.Parse()
+
+	config.LoadConfig()
+	database.InitDB()
+	defer database.CloseDB()
+
+	if err := storage.Init(); err != nil {
+		log.Fatalf("❌ File storage setup failed: %v", err)
+	}
+	if *grace < 0 {
+		*grace = config.GetOrphanGracePeriod()
+	}
+
+	report, err := storage.FindOrphans(database.GetDB(), storage.Files(), *grace, *remove)
+	if err != nil {
+		log.Fatalf("❌ Could not scan uploads: %v", err)
+	}
+
+	expired := 0
+	for _, orphan := range report.Orphans {
+		status := "within grace period"
+		switch {
+		case orphan.Error != "":
+			status = "delete failed: " + orphan.Error
+		case orphan.Deleted:
+			status = "deleted"
+		case orphan.Expired:
+			status = "expired"
+			expired++
+		}
+		log.Printf("  %s  %d bytes  %s  %s", orphan.Key, orphan.Size, orphan.ModifiedAt.Format("2006-01-02 15:04"), status)
+	}
+
+	log.Printf("ℹ️  Scanned %d files: %d orphaned (%d bytes)", report.Scanned, len(report.Orphans), report.OrphanBytes)
+	if !*remove {
+		log.Printf("ℹ️  Report only: %d orphans are past the grace period. Re-run with -delete to remove them.", expired)
+		return
+	}
+	log.Printf("✅ Deleted %d orphaned files (%d bytes)", report.Deleted, report.DeletedBytes)
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -17,6 +21,9 @@ type Config struct {
 	DBName     string
 	JWTSecret  string
 	JWTExpiry  string
+	// Roles that must complete a TOTP second step when logging in
+	TOTPRequiredRoles []string
+	TOTPIssuer        string
 }
 
 var AppConfig *Config
@@ -29,14 +36,16 @@ func LoadConfig() {
 	}
 
 	AppConfig = &Config{
-		ServerPort: getEnv("SERVER_PORT", "8080"),
-		DBHost:     getEnv("DB_HOST", "localhost"),
-		DBPort:     getEnv("DB_PORT", "3306"),
-		DBUser:     getEnv("DB_USER", "root"),
-		DBPassword: getEnv("DB_PASSWORD", "1234"),
-		DBName:     getEnv("DB_NAME", "stock_management"),
-		JWTSecret:  getEnv("JWT_SECRET", "1a2b3c4d5e"),
-		JWTExpiry:  getEnv("JWT_EXPIRY", "24h"),
+		ServerPort:        getEnv("SERVER_PORT", "8080"),
+		DBHost:            getEnv("DB_HOST", "localhost"),
+		DBPort:            getEnv("DB_PORT", "3306"),
+		DBUser:            getEnv("DB_USER", "root"),
+		DBPassword:        getEnv("DB_PASSWORD", "1234"),
+		DBName:            getEnv("DB_NAME", "stock_management"),
+		JWTSecret:         getEnv("JWT_SECRET", "1a2b3c4d5e"),
+		JWTExpiry:         getEnv("JWT_EXPIRY", "24h"),
+		TOTPRequiredRoles: splitList(getEnv("TOTP_REQUIRED_ROLES", "")),
+		TOTPIssuer:        getEnv("TOTP_ISSUER", "Best Shop"),
 	}
 }
 
@@ -47,8 +56,22 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// GetDBConnectionString pins the session time zone to UTC, the zone the
+// driver uses for time values (loc), so TIMESTAMP columns and time
+// parameters refer to the same instants whatever the server's zone is
 func GetDBConnectionString() string {
-	return AppConfig.DBUser + ":" + AppConfig.DBPassword + "@tcp(" + AppConfig.DBHost + ":" + AppConfig.DBPort + ")/" + AppConfig.DBName + "?parseTime=true"
+	return AppConfig.DBUser + ":" + AppConfig.DBPassword + "@tcp(" + AppConfig.DBHost + ":" + AppConfig.DBPort + ")/" + AppConfig.DBName +
+		"?parseTime=true&loc=UTC&time_zone=%27%2B00%3A00%27"
 }
 
 func GetServerAddress() string {
@@ -65,3 +88,187 @@ func GetMaxFileSize() int64 {
 	}
 	return 10 * 1024 * 1024 // 10MB default
 }
+
+// RoleRequiresTOTP reports whether users with the given role must use 2FA
+func RoleRequiresTOTP(role string) bool {
+	for _, r := range AppConfig.TOTPRequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAdjustmentApprovalQuantity is the largest stock adjustment (in units)
+// an employee may post without manager approval
+func GetAdjustmentApprovalQuantity() int {
+	if qty, err := strconv.Atoi(getEnv("ADJUSTMENT_APPROVAL_QUANTITY", "10")); err == nil {
+		return qty
+	}
+	return 10
+}
+
+// GetAdjustmentApprovalValue is the largest stock adjustment (at cost price)
+// an employee may post without manager approval
+func GetAdjustmentApprovalValue() float64 {
+	if value, err := strconv.ParseFloat(getEnv("ADJUSTMENT_APPROVAL_VALUE", "5000"), 64); err == nil {
+		return value
+	}
+	return 5000
+}
+
+// GetBarcodePrefix is the numeric prefix for generated EAN-13 barcodes. The
+// default sits in the 200-299 range GS1 reserves for in-store use.
+func GetBarcodePrefix() string {
+	return getEnv("BARCODE_PREFIX", "200")
+}
+
+// GetSKUTemplate is the pattern generated SKUs follow. See models.BuildSKU
+// for the available tokens.
+func GetSKUTemplate() string {
+	return getEnv("SKU_TEMPLATE", "{BRAND}-{MODEL}-{GENDER}-{SIZE}-{COLOR}")
+}
+
+// GetStorageDriver selects where uploaded files are kept: "local" (the
+// default) or "s3"
+func GetStorageDriver() string {
+	return getEnv("STORAGE_DRIVER", "local")
+}
+
+// GetUploadDir is the directory the local storage driver writes to
+func GetUploadDir() string {
+	return getEnv("UPLOAD_DIR", "./uploads")
+}
+
+// GetStorageSigningKey signs URLs for files served by the API itself. When
+// STORAGE_SIGNING_KEY is unset a key is derived from the JWT secret under a
+// purpose label, so a file signature can never be replayed as a token
+// signature or the other way round.
+func GetStorageSigningKey() []byte {
+	if key := getEnv("STORAGE_SIGNING_KEY", ""); key != "" {
+		return []byte(key)
+	}
+	mac := hmac.New(sha256.New, GetJWTSecret())
+	mac.Write([]byte("stock-management storage URL signing v1"))
+	return mac.Sum(nil)
+}
+
+// GetSignedURLExpiry is how long signed file URLs stay valid
+func GetSignedURLExpiry() time.Duration {
+	if expiry, err := time.ParseDuration(getEnv("SIGNED_URL_EXPIRY", "15m")); err == nil && expiry > 0 {
+		return expiry
+	}
+	return 15 * time.Minute
+}
+
+// S3Settings configures the S3-compatible storage driver. PathStyle puts the
+// bucket in the path rather than the host name, as MinIO and most other
+// stand-ins expect; PublicURL, when set, is the base of unsigned file URLs
+// (a CDN or public bucket endpoint).
+type S3Settings struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PublicURL string
+	PathStyle bool
+}
+
+func GetS3Settings() S3Settings {
+	pathStyle, _ := strconv.ParseBool(getEnv("S3_PATH_STYLE", "false"))
+	return S3Settings{
+		Endpoint:  getEnv("S3_ENDPOINT", "https://s3.amazonaws.com"),
+		Region:    getEnv("S3_REGION", "us-east-1"),
+		Bucket:    getEnv("S3_BUCKET", ""),
+		AccessKey: getEnv("S3_ACCESS_KEY", ""),
+		SecretKey: getEnv("S3_SECRET_KEY", ""),
+		PublicURL: getEnv("S3_PUBLIC_URL", ""),
+		PathStyle: pathStyle,
+	}
+}
+
+// GetOrphanGracePeriod is how old an unreferenced upload must be before it
+// is deleted, leaving time for it to be attached to a product
+func GetOrphanGracePeriod() time.Duration {
+	if grace, err := time.ParseDuration(getEnv("ORPHAN_GRACE_PERIOD", "72h")); err == nil && grace >= 0 {
+		return grace
+	}
+	return 72 * time.Hour
+}
+
+// GetOrphanSweepInterval is how often the server deletes orphaned uploads;
+// 0 turns the background sweep off
+func GetOrphanSweepInterval() time.Duration {
+	if interval, err := time.ParseDuration(getEnv("ORPHAN_SWEEP_INTERVAL", "24h")); err == nil && interval >= 0 {
+		return interval
+	}
+	return 24 * time.Hour
+}
+
+// GetReorderVelocityDays is the window of sales, in days, that reorder
+// suggestions average demand over
+func GetReorderVelocityDays() int {
+	if days, err := strconv.Atoi(getEnv("REORDER_VELOCITY_DAYS", "30")); err == nil && days > 0 {
+		return days
+	}
+	return 30
+}
+
+// GetReorderCoverDays is how many days of demand a suggested order should
+// cover beyond the reorder point
+func GetReorderCoverDays() int {
+	if days, err := strconv.Atoi(getEnv("REORDER_COVER_DAYS", "30")); err == nil && days >= 0 {
+		return days
+	}
+	return 30
+}
+
+// GetDefaultLeadTimeDays is the lead time assumed for variants with no
+// known supplier
+func GetDefaultLeadTimeDays() int {
+	if days, err := strconv.Atoi(getEnv("DEFAULT_LEAD_TIME_DAYS", "7")); err == nil && days >= 0 {
+		return days
+	}
+	return 7
+}
+
+// AlertSettings configures delivery of stock alerts. Notifiers lists the
+// channels in use: in_app, webhook and smtp.
+type AlertSettings struct {
+	Notifiers        []string
+	DispatchInterval time.Duration
+	MaxAttempts      int
+	WebhookURL       string
+	// WebhookSecret, when set, signs webhook bodies with HMAC-SHA256
+	WebhookSecret string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
+	EmailFrom     string
+	EmailTo       []string
+}
+
+func GetAlertSettings() AlertSettings {
+	settings := AlertSettings{
+		Notifiers:        splitList(getEnv("ALERT_NOTIFIERS", "in_app")),
+		DispatchInterval: 30 * time.Second,
+		MaxAttempts:      5,
+		WebhookURL:       getEnv("ALERT_WEBHOOK_URL", ""),
+		WebhookSecret:    getEnv("ALERT_WEBHOOK_SECRET", ""),
+		SMTPHost:         getEnv("SMTP_HOST", ""),
+		SMTPPort:         getEnv("SMTP_PORT", "587"),
+		SMTPUsername:     getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+		EmailFrom:        getEnv("ALERT_EMAIL_FROM", ""),
+		EmailTo:          splitList(getEnv("ALERT_EMAIL_TO", "")),
+	}
+	if interval, err := time.ParseDuration(getEnv("ALERT_DISPATCH_INTERVAL", "30s")); err == nil && interval >= 0 {
+		settings.DispatchInterval = interval
+	}
+	if attempts, err := strconv.Atoi(getEnv("ALERT_MAX_ATTEMPTS", "5")); err == nil && attempts > 0 {
+		settings.MaxAttempts = attempts
+	}
+	return settings
+}
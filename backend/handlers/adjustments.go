@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"stock-management/config"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var adjustmentReasonCodes = map[string]bool{
+	"damaged":     true,
+	"theft":       true,
+	"found":       true,
+	"expired":     true,
+	"count_error": true,
+	"other":       true,
+}
+
+func GetStockAdjustments(c *gin.Context) {
+	db := database.GetDB()
+	adjustments, err := models.GetStockAdjustments(db, c.GetInt("store_id"), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if adjustments == nil {
+		adjustments = []models.StockAdjustment{}
+	}
+	c.JSON(http.StatusOK, adjustments)
+}
+
+func GetStockAdjustment(c *gin.Context) {
+	adj, ok := loadAdjustment(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, adj)
+}
+
+// CreateStockAdjustment posts an add, remove or correction against a variant
+// in the caller's store. Employees' adjustments above the configured quantity
+// or value wait for a manager to approve them.
+func CreateStockAdjustment(c *gin.Context) {
+	var req struct {
+		ProductVariantID int    `json:"product_variant_id" binding:"required"`
+		AdjustmentType   string `json:"adjustment_type" binding:"required"`
+		Quantity         int    `json:"quantity"`
+		NewQuantity      *int   `json:"new_quantity"`
+		ReasonCode       string `json:"reason_code" binding:"required"`
+		Reason           string `json:"reason"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if !adjustmentReasonCodes[req.ReasonCode] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reason_code"})
+		return
+	}
+	if req.AdjustmentType == "correction" && req.NewQuantity == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new_quantity is required for corrections"})
+		return
+	}
+
+	storeID, ok := writeStoreID(c)
+	if !ok {
+		return
+	}
+
+	adj := models.StockAdjustment{
+		ProductVariantID: req.ProductVariantID,
+		StoreID:          storeID,
+		Quantity:         req.Quantity,
+		AdjustmentType:   req.AdjustmentType,
+		ReasonCode:       req.ReasonCode,
+		Reason:           req.Reason,
+		AdjustedBy:       c.GetInt("user_id"),
+	}
+	if req.NewQuantity != nil {
+		adj.NewQuantity = *req.NewQuantity
+	}
+
+	db := database.GetDB()
+	if err := models.CreateStockAdjustment(db, &adj, adjustmentApprovalRule(c.GetString("role"))); err != nil {
+		respondAdjustmentError(c, err)
+		return
+	}
+
+	created, err := models.GetStockAdjustmentByID(db, adj.ID)
+	if err != nil {
+		created = &adj
+	}
+
+	middleware.RecordAudit(c, "create", "stock_adjustments", adj.ID, nil, created)
+
+	status := http.StatusCreated
+	if adj.Status == models.AdjustmentPending {
+		status = http.StatusAccepted
+	}
+	c.JSON(status, created)
+}
+
+func ApproveStockAdjustment(c *gin.Context) {
+	reviewStockAdjustment(c, "approve", models.ApproveStockAdjustment)
+}
+
+func RejectStockAdjustment(c *gin.Context) {
+	reviewStockAdjustment(c, "reject", models.RejectStockAdjustment)
+}
+
+func reviewStockAdjustment(c *gin.Context, action string, review func(db *sql.DB, id, approverID int) error) {
+	adj, ok := loadAdjustment(c)
+	if !ok {
+		return
+	}
+
+	if !canAccessStore(c, adj.StoreID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No access to this store"})
+		return
+	}
+
+	db := database.GetDB()
+	if err := review(db, adj.ID, c.GetInt("user_id")); err != nil {
+		respondAdjustmentError(c, err)
+		return
+	}
+
+	updated, err := models.GetStockAdjustmentByID(db, adj.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.RecordAudit(c, action, "stock_adjustments", adj.ID, adj, updated)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// adjustmentApprovalRule lets managers and admins adjust freely; everyone
+// else needs approval above the configured quantity or cost value
+func adjustmentApprovalRule(role string) models.ApprovalRule {
+	if role == "admin" || role == "manager" {
+		return nil
+	}
+
+	maxQuantity := config.GetAdjustmentApprovalQuantity()
+	maxValue := config.GetAdjustmentApprovalValue()
+	return func(delta int, value float64) bool {
+		if delta < 0 {
+			delta = -delta
+		}
+		return delta > maxQuantity || value > maxValue
+	}
+}
+
+func loadAdjustment(c *gin.Context) (*models.StockAdjustment, bool) {
+	adjustmentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adjustment ID"})
+		return nil, false
+	}
+
+	db := database.GetDB()
+	adj, err := models.GetStockAdjustmentByID(db, adjustmentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Adjustment not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+
+	if storeID := c.GetInt("store_id"); storeID != 0 && adj.StoreID != storeID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Adjustment not found"})
+		return nil, false
+	}
+
+	return adj, true
+}
+
+func respondAdjustmentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidAdjustment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adjustment: check product_variant_id, adjustment_type and quantity"})
+	case errors.Is(err, models.ErrInsufficientStock):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot go below zero"})
+	case errors.Is(err, models.ErrAdjustmentState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("❌ Stock adjustment error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"stock-management/alerts"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStockAlerts lists alerts for the selected store. ?status= is open (the
+// default), resolved or all; ?type= is low_stock or out_of_stock.
+func GetStockAlerts(c *gin.Context) {
+	limit, err := queryInt(c, "limit")
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	if limit == 0 || limit > 500 {
+		limit = 500
+	}
+
+	status := c.DefaultQuery("status", "open")
+	if status != "open" && status != "resolved" && status != "all" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be open, resolved or all"})
+		return
+	}
+	alertType := c.Query("type")
+	if alertType != "" && alertType != models.AlertLowStock && alertType != models.AlertOutOfStock {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be low_stock or out_of_stock"})
+		return
+	}
+
+	list, err := models.GetStockAlerts(database.GetDB(), models.StockAlertFilter{
+		StoreID:   c.GetInt("store_id"),
+		Status:    status,
+		AlertType: alertType,
+		Limit:     limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if list == nil {
+		list = []models.StockAlert{}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func AcknowledgeStockAlert(c *gin.Context) {
+	alertID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		return
+	}
+
+	db := database.GetDB()
+	alert, err := models.GetStockAlertByID(db, alertID)
+	if err == nil && !canAccessStore(c, alert.StoreID) {
+		err = models.ErrAlertNotFound
+	}
+	if err == nil {
+		err = models.AcknowledgeStockAlert(db, alertID, c.GetInt("user_id"))
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrAlertNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	acknowledged, err := models.GetStockAlertByID(db, alertID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, acknowledged)
+}
+
+// DispatchStockAlerts delivers pending alerts now instead of waiting for
+// the next background run
+func DispatchStockAlerts(c *gin.Context) {
+	dispatcher := alerts.Default()
+	if dispatcher == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Alert delivery is not configured"})
+		return
+	}
+
+	delivered, err := dispatcher.Dispatch()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "delivered": delivered})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"delivered": delivered})
+}
+
+// TestStockAlertNotifiers sends a sample alert, which is not stored, through
+// every configured notifier and reports how each fared
+func TestStockAlertNotifiers(c *gin.Context) {
+	dispatcher := alerts.Default()
+	if dispatcher == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Alert delivery is not configured"})
+		return
+	}
+
+	storeID, ok := writeStoreID(c)
+	if !ok {
+		return
+	}
+	store, err := models.GetStoreByID(database.GetDB(), storeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load store"})
+		return
+	}
+
+	sample := models.StockAlert{
+		StoreID:   storeID,
+		StoreName: store.Name,
+		ItemName:  "Test notification",
+		SKU:       "TEST",
+		AlertType: models.AlertLowStock,
+		Quantity:  1,
+		Threshold: 10,
+		CreatedAt: time.Now(),
+	}
+	results := map[string]string{}
+	for _, notifier := range dispatcher.Notifiers() {
+		if err := notifier.Notify([]models.StockAlert{sample}); err != nil {
+			results[notifier.Name()] = err.Error()
+		} else {
+			results[notifier.Name()] = "ok"
+		}
+	}
+
+	middleware.RecordAudit(c, "test", "stock_alerts", 0, nil, results)
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// GetNotifications lists the user's in-app notifications; ?unread=true
+// leaves out those already read
+func GetNotifications(c *gin.Context) {
+	limit, err := queryInt(c, "limit")
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	if limit == 0 || limit > 200 {
+		limit = 50
+	}
+
+	db := database.GetDB()
+	userID, storeID := c.GetInt("user_id"), c.GetInt("store_id")
+	notifications, err := models.GetNotifications(db, userID, storeID, c.Query("unread") == "true", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	unread, err := models.CountUnreadNotifications(db, userID, storeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+	c.JSON(http.StatusOK, gin.H{"unread_count": unread, "notifications": notifications})
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	notificationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	if err := models.MarkNotificationRead(database.GetDB(), notificationID, c.GetInt("user_id")); err != nil {
+		if errors.Is(err, models.ErrNotificationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+func MarkAllNotificationsRead(c *gin.Context) {
+	if err := models.MarkAllNotificationsRead(database.GetDB(), c.GetInt("user_id"), c.GetInt("store_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "All notifications marked as read"})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"stock-management/database"
+	"stock-management/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAuditLogs lists audit entries, filterable by user_id, action, table_name,
+// record_id and a from/to date range (YYYY-MM-DD or RFC 3339)
+func GetAuditLogs(c *gin.Context) {
+	filter := models.AuditLogFilter{
+		Action:    c.Query("action"),
+		TableName: c.Query("table_name"),
+	}
+
+	var err error
+	if filter.UserID, err = queryInt(c, "user_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+		return
+	}
+	if filter.RecordID, err = queryInt(c, "record_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid record_id"})
+		return
+	}
+	if filter.Limit, err = queryInt(c, "limit"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	if filter.Offset, err = queryInt(c, "offset"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+	if filter.From, err = queryTime(c, "from", false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+		return
+	}
+	if filter.To, err = queryTime(c, "to", true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+		return
+	}
+
+	db := database.GetDB()
+	logs, err := models.GetAuditLogs(db, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if logs == nil {
+		logs = []models.AuditLog{}
+	}
+	c.JSON(http.StatusOK, logs)
+}
+
+func queryInt(c *gin.Context, key string) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// queryTime parses a date or timestamp query parameter. A bare date used as an
+// upper bound is moved to the start of the following day so it is inclusive.
+func queryTime(c *gin.Context, key string, endOfDay bool) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"stock-management/config"
 	"stock-management/database"
+	"stock-management/middleware"
 	"stock-management/models"
 	"stock-management/utils"
 
@@ -41,6 +43,59 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// Enrolled users must pass a second step before getting a session token
+	if user.TOTPEnabled {
+		lockedUntil, err := models.MFALockedUntil(database.GetDB(), user.ID)
+		if err != nil {
+			log.Printf("❌ Two-factor lockout lookup error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if !lockedUntil.IsZero() {
+			respondMFALocked(c, user.Username, lockedUntil)
+			return
+		}
+
+		mfaToken, err := utils.GenerateScopedJWT(user.ID, user.Role, utils.TokenPurposeMFA, mfaTokenTTL)
+		if err != nil {
+			log.Printf("❌ Token generation error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+
+		log.Printf("🔐 Two-factor code required for user: %s", user.Username)
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Two-factor code required",
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
+		return
+	}
+
+	// Roles that require 2FA may only enroll until they have set it up
+	if config.RoleRequiresTOTP(user.Role) {
+		setupToken, err := utils.GenerateScopedJWT(user.ID, user.Role, utils.TokenPurposeMFASetup, mfaSetupTokenTTL)
+		if err != nil {
+			log.Printf("❌ Token generation error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+
+		log.Printf("🔐 Two-factor enrollment required for user: %s", user.Username)
+		c.JSON(http.StatusOK, gin.H{
+			"message":                 "Two-factor enrollment required",
+			"mfa_enrollment_required": true,
+			"setup_token":             setupToken,
+		})
+		return
+	}
+
+	completeLogin(c, user, gin.H{})
+}
+
+// completeLogin issues the session token once every required factor has been
+// checked. extra is merged into the response body.
+func completeLogin(c *gin.Context, user *models.User, extra gin.H) {
 	// Generate JWT token
 	token, err := utils.GenerateJWT(user.ID, user.Role)
 	if err != nil {
@@ -56,17 +111,23 @@ func Login(c *gin.Context) {
 	}
 
 	log.Printf("✅ Login successful for user: %s, role: %s", user.Username, user.Role)
-	
-	c.JSON(http.StatusOK, gin.H{
+
+	response := gin.H{
 		"message": "Login successful",
 		"token":   token,
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"role":     user.Role,
+			"id":           user.ID,
+			"username":     user.Username,
+			"email":        user.Email,
+			"role":         user.Role,
+			"totp_enabled": user.TOTPEnabled,
 		},
-	})
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 func GetProfile(c *gin.Context) {
@@ -103,6 +164,9 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
+	// Never log the password itself, only that it changed
+	middleware.RecordAudit(c, "reset_password", "users", req.UserID, nil, gin.H{"password_changed": true})
+
 	log.Printf("✅ Password reset successful for user ID: %d", req.UserID)
 	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
 } 
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"stock-management/config"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"stock-management/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetVariantByBarcode looks a variant up by barcode or SKU for scanners and
+// the till
+func GetVariantByBarcode(c *gin.Context) {
+	code := strings.TrimSpace(c.Param("code"))
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Barcode is required"})
+		return
+	}
+
+	db := database.GetDB()
+	variant, err := models.GetVariantByCode(db, code, c.GetInt("store_id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No variant with this barcode or SKU"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, variant)
+}
+
+// GenerateMissingBarcodes assigns an EAN-13 to every active variant that
+// has none
+func GenerateMissingBarcodes(c *gin.Context) {
+	db := database.GetDB()
+	ids, err := models.GetVariantIDsWithoutBarcode(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start transaction"})
+		return
+	}
+
+	assigned := map[int]string{}
+	for _, id := range ids {
+		variant := models.ProductVariant{ID: id}
+		if err := assignVariantBarcodeTx(tx, &variant); err != nil {
+			tx.Rollback()
+			if !respondVariantCodeError(c, err) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		assigned[id] = variant.Barcode
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed: " + err.Error()})
+		return
+	}
+
+	log.Printf("✅ Generated %d barcodes", len(assigned))
+	middleware.RecordAudit(c, "generate_barcodes", "product_variants", 0, nil, assigned)
+
+	c.JSON(http.StatusOK, gin.H{
+		"generated": len(assigned),
+		"barcodes":  assigned,
+	})
+}
+
+type labelView struct {
+	ItemName string
+	Size     string
+	Color    string
+	Price    string
+	MRP      string
+	Barcode  string
+	Bars     template.HTML
+}
+
+var labelSheetTemplate = template.Must(template.New("labels").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Labels</title>
+<style>
+  body { font-family: Arial, sans-serif; margin: 0; }
+  .sheet { display: flex; flex-wrap: wrap; gap: 4mm; padding: 5mm; }
+  .label { width: 60mm; height: 35mm; border: 1px dashed #ccc; padding: 2mm; box-sizing: border-box; text-align: center; page-break-inside: avoid; }
+  .name { font-size: 9pt; font-weight: bold; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+  .meta { font-size: 8pt; }
+  .price { font-size: 12pt; font-weight: bold; }
+  .mrp { font-size: 7pt; text-decoration: line-through; }
+  .code { font-size: 8pt; letter-spacing: 1px; }
+  @media print { .label { border: none; } }
+</style>
+</head>
+<body>
+<div class="sheet">
+{{range .}}<div class="label">
+  <div class="name">{{.ItemName}}</div>
+  <div class="meta">Size {{.Size}}{{if .Color}} · {{.Color}}{{end}}</div>
+  {{.Bars}}
+  <div class="code">{{.Barcode}}</div>
+  <div class="price">₹{{.Price}}{{if .MRP}} <span class="mrp">₹{{.MRP}}</span>{{end}}</div>
+</div>
+{{end}}</div>
+</body>
+</html>`))
+
+// GetBarcodeLabels renders a printable HTML label sheet with barcode, price
+// and size. Pass ids=1,2,3 (or product_id for all its variants) and copies.
+func GetBarcodeLabels(c *gin.Context) {
+	var ids []int
+	for _, part := range strings.Split(c.Query("ids"), ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID: " + part})
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	productID, _ := strconv.Atoi(c.Query("product_id"))
+	if len(ids) == 0 && productID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide ids or product_id"})
+		return
+	}
+
+	copies := 1
+	if value := c.Query("copies"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "copies must be between 1 and 100"})
+			return
+		}
+		copies = n
+	}
+
+	db := database.GetDB()
+	variants, err := models.GetVariantsForLabels(db, ids, productID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(variants) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No variants found"})
+		return
+	}
+
+	var labels []labelView
+	for _, variant := range variants {
+		label := labelView{
+			ItemName: variant.ItemName,
+			Size:     variant.Size,
+			Color:    variant.Color,
+			Price:    fmt.Sprintf("%.2f", variant.SellingPrice),
+			Barcode:  variant.Barcode,
+			Bars:     barcodeSVG(variant.Barcode),
+		}
+		if variant.MRP > variant.SellingPrice {
+			label.MRP = fmt.Sprintf("%.2f", variant.MRP)
+		}
+		for i := 0; i < copies; i++ {
+			labels = append(labels, label)
+		}
+	}
+
+	var page bytes.Buffer
+	if err := labelSheetTemplate.Execute(&page, labels); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// barcodeSVG draws an EAN-13 as inline SVG. Other codes (legacy or supplier
+// barcodes) are printed as text only.
+func barcodeSVG(code string) template.HTML {
+	modules, err := utils.EAN13Modules(code)
+	if err != nil {
+		return ""
+	}
+
+	// 95 modules plus a quiet zone either side
+	const quiet = 9
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="50mm" height="14mm" viewBox="0 0 %d 40" preserveAspectRatio="none">`,
+		len(modules)+2*quiet)
+	for i := 0; i < len(modules); i++ {
+		if modules[i] != '1' {
+			continue
+		}
+		width := 1
+		for i+width < len(modules) && modules[i+width] == '1' {
+			width++
+		}
+		fmt.Fprintf(&svg, `<rect x="%d" y="0" width="%d" height="40"/>`, i+quiet, width)
+		i += width - 1
+	}
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
+
+// checkVariantBarcodeTx validates a barcode entered by the user before the
+// variant is saved. Empty barcodes are filled in by assignVariantBarcodeTx.
+func checkVariantBarcodeTx(tx *sql.Tx, variant *models.ProductVariant) error {
+	variant.Barcode = strings.TrimSpace(variant.Barcode)
+	if variant.Barcode == "" {
+		return nil
+	}
+
+	if utils.LooksLikeEAN13(variant.Barcode) && !utils.IsValidEAN13(variant.Barcode) {
+		return fmt.Errorf("%w: %s has a wrong check digit", utils.ErrInvalidEAN13, variant.Barcode)
+	}
+
+	taken, err := models.BarcodeTakenTx(tx, variant.Barcode, variant.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("%w: %s", models.ErrDuplicateBarcode, variant.Barcode)
+	}
+	return nil
+}
+
+// maxBarcodeSequenceSkips bounds how many taken numbers assignVariantBarcodeTx
+// steps over before giving up
+const maxBarcodeSequenceSkips = 1000
+
+// assignVariantBarcodeTx gives a saved variant without a barcode an EAN-13
+// derived from its ID, or from the next free number after it
+func assignVariantBarcodeTx(tx *sql.Tx, variant *models.ProductVariant) error {
+	if variant.Barcode != "" {
+		return nil
+	}
+
+	// The sequence starts at the variant's id. A hand-entered code can
+	// already occupy a generated number, so taken numbers are skipped.
+	for sequence := variant.ID; sequence < variant.ID+maxBarcodeSequenceSkips; sequence++ {
+		barcode, err := utils.GenerateEAN13(config.GetBarcodePrefix(), sequence)
+		if err != nil {
+			return err
+		}
+
+		taken, err := models.BarcodeTakenTx(tx, barcode, variant.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			continue
+		}
+
+		// A concurrent save can claim the number after the check
+		err = models.SetVariantBarcodeTx(tx, variant.ID, barcode)
+		if errors.Is(err, models.ErrDuplicateBarcode) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		variant.Barcode = barcode
+		return nil
+	}
+	return fmt.Errorf("no free barcode within %d numbers of sequence %d", maxBarcodeSequenceSkips, variant.ID)
+}
+
+// applyVariantSKUTx generates a SKU from the configured template when none
+// was entered, otherwise normalises the entered one and checks it is not
+// taken. An existing variant's SKU sent back unchanged is kept as stored, so
+// SKUs from before the current rules do not make the product uneditable.
+func applyVariantSKUTx(tx *sql.Tx, variant *models.ProductVariant) error {
+	if variant.ID > 0 && variant.SKU != "" {
+		stored, err := models.GetVariantSKUTx(tx, variant.ID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if stored != "" && strings.TrimSpace(variant.SKU) == stored {
+			variant.SKU = stored
+			return nil
+		}
+	}
+
+	sku, err := models.NormalizeSKU(variant.SKU)
+	if err != nil {
+		return err
+	}
+	variant.SKU = sku
+	if variant.SKU == "" {
+		return models.GenerateVariantSKUTx(tx, config.GetSKUTemplate(), variant)
+	}
+	return models.CheckSKUTx(tx, variant.SKU, variant.ID)
+}
+
+// respondVariantCodeError writes the response for SKU and barcode validation
+// errors and reports whether it did
+func respondVariantCodeError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, models.ErrDuplicateBarcode), errors.Is(err, models.ErrDuplicateSKU):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, utils.ErrInvalidEAN13), errors.Is(err, models.ErrInvalidSKU):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
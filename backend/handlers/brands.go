@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"database/sql"
 	"net/http"
 	"stock-management/database"
+	"stock-management/middleware"
 	"stock-management/models"
+	"stock-management/search"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -26,11 +31,62 @@ func CreateBrand(c *gin.Context) {
 		return
 	}
 
+	if !checkTaxonomyName(c, models.KindBrand, brand.Name, 0, 0) {
+		return
+	}
+	brand.Name = strings.TrimSpace(brand.Name)
+
 	db := database.GetDB()
 	if err := models.CreateBrand(db, &brand); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondTaxonomyError(c, err)
 		return
 	}
 
+	middleware.RecordAudit(c, "create", "brands", brand.ID, nil, brand)
+
 	c.JSON(http.StatusCreated, brand)
-}
\ No newline at end of file
+}
+
+// UpdateBrand renames a brand and can deactivate (with reassign_to)
+// or reactivate it through is_active
+func UpdateBrand(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid brand ID"})
+		return
+	}
+
+	var req taxonomyUpdate
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !checkTaxonomyName(c, models.KindBrand, req.Name, 0, id) {
+		return
+	}
+
+	brand := models.Brand{ID: id, Name: strings.TrimSpace(req.Name), Description: req.Description}
+	moved, ok := updateTaxonomy(c, models.KindBrand, id, req, func(tx *sql.Tx) error {
+		return models.UpdateBrandTx(tx, &brand)
+	})
+	if !ok {
+		return
+	}
+
+	search.RefreshAll()
+	middleware.RecordAudit(c, "update", "brands", id, nil, req)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Brand updated successfully",
+		"products_reassigned": moved,
+	})
+}
+
+func DeleteBrand(c *gin.Context) {
+	deactivateTaxonomy(c, models.KindBrand)
+}
+
+func ReorderBrands(c *gin.Context) {
+	reorderTaxonomy(c, models.KindBrand)
+}
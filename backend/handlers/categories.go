@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"database/sql"
 	"net/http"
 	"stock-management/database"
+	"stock-management/middleware"
 	"stock-management/models"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -26,11 +30,61 @@ func CreateCategory(c *gin.Context) {
 		return
 	}
 
+	if !checkTaxonomyName(c, models.KindCategory, category.Name, 0, 0) {
+		return
+	}
+	category.Name = strings.TrimSpace(category.Name)
+
 	db := database.GetDB()
 	if err := models.CreateCategory(db, &category); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondTaxonomyError(c, err)
 		return
 	}
 
+	middleware.RecordAudit(c, "create", "categories", category.ID, nil, category)
+
 	c.JSON(http.StatusCreated, category)
-}
\ No newline at end of file
+}
+
+// UpdateCategory renames a category and can deactivate (with reassign_to)
+// or reactivate it through is_active
+func UpdateCategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	var req taxonomyUpdate
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !checkTaxonomyName(c, models.KindCategory, req.Name, 0, id) {
+		return
+	}
+
+	category := models.Category{ID: id, Name: strings.TrimSpace(req.Name), Description: req.Description}
+	moved, ok := updateTaxonomy(c, models.KindCategory, id, req, func(tx *sql.Tx) error {
+		return models.UpdateCategoryTx(tx, &category)
+	})
+	if !ok {
+		return
+	}
+
+	middleware.RecordAudit(c, "update", "categories", id, nil, req)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Category updated successfully",
+		"products_reassigned": moved,
+	})
+}
+
+func DeleteCategory(c *gin.Context) {
+	deactivateTaxonomy(c, models.KindCategory)
+}
+
+func ReorderCategories(c *gin.Context) {
+	reorderTaxonomy(c, models.KindCategory)
+}
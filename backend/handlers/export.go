@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"stock-management/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rows written between flushes of a streamed export
+const exportFlushRows = 500
+
+// ExportProducts streams the catalogue, one row per variant
+func ExportProducts(c *gin.Context) {
+	streamExport(c, "products", models.ExportProducts)
+}
+
+// ExportStockEntries streams stock entries
+func ExportStockEntries(c *gin.Context) {
+	streamExport(c, "stock-entries", models.ExportStockEntries)
+}
+
+// ExportSales streams sales, one row per sale item
+func ExportSales(c *gin.Context) {
+	streamExport(c, "sales", models.ExportSales)
+}
+
+// streamExport writes an export as it is read from the database. Query
+// parameters: format (csv, xlsx or jsonl; default csv), from and to
+// (YYYY-MM-DD or RFC 3339) and category_id. Exports follow the caller's
+// store scope.
+func streamExport(c *gin.Context, name string, query func(*sql.DB, models.ExportFilter) (*models.ExportRows, error)) {
+	format := c.DefaultQuery("format", utils.FormatCSV)
+	contentType := utils.ExportContentType(format)
+	if contentType == "" {
+		c.JSON(http.StatusBadRequest, models.FieldError{Field: "format", Message: utils.ErrUnknownExportFormat.Error()})
+		return
+	}
+
+	filter := models.ExportFilter{StoreID: c.GetInt("store_id")}
+	var err error
+	if filter.CategoryID, err = queryInt(c, "category_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category_id"})
+		return
+	}
+	if filter.From, err = queryTime(c, "from", false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+		return
+	}
+	if filter.To, err = queryTime(c, "to", true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+		return
+	}
+
+	db := database.GetDB()
+	rows, err := query(db, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	filename := name + "-" + time.Now().Format("20060102-150405") + "." + format
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	writer, err := utils.NewTableWriter(format, c.Writer, rows.Columns)
+	if err != nil {
+		log.Printf("❌ Export %s failed to start: %v", name, err)
+		return
+	}
+
+	// Once streaming has begun the status can no longer change, so failures
+	// are logged and the output ends with the format's error trailer
+	abort := func(count int, err error) {
+		log.Printf("❌ Export %s failed after %d rows: %v", name, count, err)
+		if err := writer.Abort(err); err != nil {
+			log.Printf("❌ Export %s could not write its error trailer: %v", name, err)
+		}
+		c.Writer.Flush()
+	}
+
+	count := 0
+	for rows.Next() {
+		values, err := rows.Values()
+		if err == nil {
+			err = writer.WriteRow(values)
+		}
+		if err != nil {
+			abort(count, err)
+			return
+		}
+		count++
+		if count%exportFlushRows == 0 {
+			if err := writer.Flush(); err != nil {
+				abort(count, err)
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		abort(count, err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("❌ Export %s failed to finish: %v", name, err)
+		return
+	}
+
+	middleware.RecordAudit(c, "export", name, 0, nil, gin.H{"format": format, "rows": count, "filter": filter})
+}
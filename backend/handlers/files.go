@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"stock-management/config"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"stock-management/storage"
+	"stock-management/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSignedURL returns a time-limited URL for a stored file given its
+// unsigned url, e.g. one from a product's images
+func GetSignedURL(c *gin.Context) {
+	files := storage.Files()
+	key, ok := files.Key(c.Query("url"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.FieldError{Field: "url", Message: "not a stored file URL"})
+		return
+	}
+
+	expiry := config.GetSignedURLExpiry()
+	signed, err := files.SignedURL(key, expiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": signed, "expires_at": time.Now().Add(expiry)})
+}
+
+// ServeSignedFile serves a file through a signed URL issued by a backend
+// that does not serve files itself (the local and in-memory stores)
+func ServeSignedFile(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	verifier, ok := storage.Files().(storage.SignedURLVerifier)
+	if err != nil || !ok || !verifier.VerifySignedURL(key, expires, c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	file, err := storage.Files().Open(key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	defer file.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "private, max-age="+strconv.FormatInt(expires-time.Now().Unix(), 10))
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, file)
+}
+
+// removeOrphanedFiles deletes the stored files behind fileURLs that no
+// variant or product image refers to any more. It runs after the change
+// that dropped the references has committed; failures are only logged.
+func removeOrphanedFiles(fileURLs ...string) {
+	files := storage.Files()
+	db := database.GetDB()
+	seen := map[string]bool{}
+
+	for _, fileURL := range fileURLs {
+		key, ok := files.Key(fileURL)
+		if !ok || seen[key] {
+			continue
+		}
+
+		keys := utils.ImageRenditionKeys(key)
+		inUse := false
+		for _, k := range keys {
+			seen[k] = true
+			used, err := models.FileURLInUse(db, files.URL(k))
+			if err != nil {
+				log.Printf("❌ Could not check whether %s is in use: %v", k, err)
+				inUse = true
+				break
+			}
+			if used {
+				inUse = true
+				break
+			}
+		}
+		if inUse {
+			continue
+		}
+
+		for _, k := range keys {
+			if err := files.Delete(k); err != nil {
+				log.Printf("❌ Could not delete orphaned file %s: %v", k, err)
+			}
+		}
+	}
+}
+
+// productFileURLs lists the file URLs a product snapshot refers to
+func productFileURLs(product *models.ProductWithVariants) []string {
+	if product == nil {
+		return nil
+	}
+	var urls []string
+	for _, variant := range product.Variants {
+		if variant.ImageURL != "" {
+			urls = append(urls, variant.ImageURL)
+		}
+	}
+	for _, image := range product.Images {
+		urls = append(urls, image.ImageURL)
+	}
+	return urls
+}
+
+// GetOrphanedUploads reports stored files that nothing refers to, without
+// deleting them
+func GetOrphanedUploads(c *gin.Context) {
+	report, err := storage.FindOrphans(database.GetDB(), storage.Files(), config.GetOrphanGracePeriod(), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// DeleteOrphanedUploads deletes orphaned files past the grace period and
+// reports what was found
+func DeleteOrphanedUploads(c *gin.Context) {
+	report, err := storage.FindOrphans(database.GetDB(), storage.Files(), config.GetOrphanGracePeriod(), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.RecordAudit(c, "delete_orphans", "uploads", 0, nil, gin.H{"deleted": report.Deleted, "deleted_bytes": report.DeletedBytes})
+	c.JSON(http.StatusOK, report)
+}
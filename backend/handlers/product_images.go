@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// productImageRequest is the body of POST /products/:id/images. image_url is
+// usually one returned by POST /upload-image; product_variant_id attaches the
+// image to one variant instead of the product.
+type productImageRequest struct {
+	ImageURL         string `json:"image_url" binding:"required"`
+	ImageType        string `json:"image_type"`
+	ProductVariantID *int   `json:"product_variant_id"`
+}
+
+// GetProductImages lists a product's images, variant images included, in
+// display order
+func GetProductImages(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	images, err := models.GetProductImages(database.GetDB(), productID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, images)
+}
+
+// AddProductImage attaches an image to the end of a product's gallery
+func AddProductImage(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req productImageRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	req.ImageURL = strings.TrimSpace(req.ImageURL)
+	if req.ImageURL == "" || len(req.ImageURL) > 500 {
+		c.JSON(http.StatusBadRequest, models.FieldError{Field: "image_url", Message: "image_url is required and at most 500 characters"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	image := models.ProductImage{
+		ProductID:        productID,
+		ProductVariantID: req.ProductVariantID,
+		ImageURL:         req.ImageURL,
+		ImageType:        req.ImageType,
+		UploadedBy:       &userID,
+	}
+
+	withProductImageTx(c, productID, func(tx *sql.Tx) error {
+		return models.AddProductImageTx(tx, &image)
+	}, func() {
+		middleware.RecordAudit(c, "add_image", "product_images", image.ID, nil, image)
+		c.JSON(http.StatusCreated, image)
+	})
+}
+
+// SetMainProductImage makes an image the main image of its product or
+// variant
+func SetMainProductImage(c *gin.Context) {
+	productID, imageID, ok := productImageParams(c)
+	if !ok {
+		return
+	}
+
+	var image models.ProductImage
+	withProductImageTx(c, productID, func(tx *sql.Tx) (err error) {
+		image, err = models.SetMainProductImageTx(tx, productID, imageID)
+		return err
+	}, func() {
+		middleware.RecordAudit(c, "set_main_image", "product_images", imageID, nil, image)
+		c.JSON(http.StatusOK, image)
+	})
+}
+
+// DeleteProductImage removes an image from a product's gallery
+func DeleteProductImage(c *gin.Context) {
+	productID, imageID, ok := productImageParams(c)
+	if !ok {
+		return
+	}
+
+	var image models.ProductImage
+	withProductImageTx(c, productID, func(tx *sql.Tx) (err error) {
+		image, err = models.DeleteProductImageTx(tx, productID, imageID)
+		return err
+	}, func() {
+		middleware.RecordAudit(c, "delete_image", "product_images", imageID, image, nil)
+		removeOrphanedFiles(image.ImageURL)
+		c.JSON(http.StatusOK, gin.H{"message": "Image deleted"})
+	})
+}
+
+// ReorderProductImages stores the display order from {"ids": [...]}, which
+// must list every image of the product
+func ReorderProductImages(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req struct {
+		IDs []int `json:"ids" binding:"required"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	withProductImageTx(c, productID, func(tx *sql.Tx) error {
+		return models.ReorderProductImagesTx(tx, productID, req.IDs)
+	}, func() {
+		middleware.RecordAudit(c, "reorder", "product_images", productID, nil, req.IDs)
+
+		images, err := models.GetProductImages(database.GetDB(), productID)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"message": "Order saved"})
+			return
+		}
+		c.JSON(http.StatusOK, images)
+	})
+}
+
+func productImageParams(c *gin.Context) (int, int, bool) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return 0, 0, false
+	}
+	imageID, err := strconv.Atoi(c.Param("imageId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image ID"})
+		return 0, 0, false
+	}
+	return productID, imageID, true
+}
+
+// withProductImageTx runs change in a transaction that also bumps the
+// product's version, then calls done once it has committed
+func withProductImageTx(c *gin.Context, productID int, change func(*sql.Tx) error, done func()) {
+	tx, err := database.GetDB().Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start transaction"})
+		return
+	}
+
+	if _, err := models.LockProductTx(tx, productID); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if err := change(tx); err != nil {
+		tx.Rollback()
+		respondProductImageError(c, err)
+		return
+	}
+
+	if err := models.TouchProductTx(tx, productID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed: " + err.Error()})
+		return
+	}
+	done()
+}
+
+func respondProductImageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrImageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrVariantNotFound):
+		c.JSON(http.StatusBadRequest, models.FieldError{Field: "product_variant_id", Message: err.Error()})
+	case errors.Is(err, models.ErrInvalidImageType):
+		c.JSON(http.StatusBadRequest, models.FieldError{Field: "image_type", Message: err.Error()})
+	case errors.Is(err, models.ErrImageOrder):
+		c.JSON(http.StatusBadRequest, models.FieldError{Field: "ids", Message: err.Error()})
+	default:
+		log.Printf("❌ Product image error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"stock-management/search"
+	"stock-management/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits on a single import file
+const (
+	maxImportBytes = 10 << 20
+	maxImportRows  = 5000
+)
+
+// importColumns are the recognised header names; importColumnAliases maps
+// other common spellings onto them
+var importColumns = map[string]bool{
+	"item_id": true, "item_name": true, "category": true, "subcategory": true, "brand": true,
+	"model": true, "description": true, "low_stock_threshold": true,
+	"gender": true, "size": true, "color": true, "mrp": true, "selling_price": true, "cost_price": true,
+	"sku": true, "barcode": true, "opening_stock": true, "image_url": true,
+}
+
+var importColumnAliases = map[string]string{
+	"name":          "item_name",
+	"product_name":  "item_name",
+	"category_name": "category",
+	"brand_name":    "brand",
+	"colour":        "color",
+	"price":         "selling_price",
+	"stock":         "opening_stock",
+	"quantity":      "opening_stock",
+}
+
+// Product-level columns; rows after the first for an item_id may leave them
+// blank but must not contradict the first
+var importProductColumns = []string{"item_name", "category", "subcategory", "brand", "model", "description", "low_stock_threshold"}
+
+// Columns that make a row describe a variant
+var importVariantColumns = []string{"gender", "size", "color", "mrp", "selling_price", "cost_price", "sku", "barcode", "opening_stock", "image_url"}
+
+// importRefColumns maps the reference fields reported by
+// ValidateProductRefsTx to the import columns they came from
+var importRefColumns = map[string]string{
+	"category_id":    "category",
+	"subcategory_id": "subcategory",
+	"brand_id":       "brand",
+}
+
+type importRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"error"`
+}
+
+type importRow struct {
+	number int
+	values map[string]string
+}
+
+type importVariant struct {
+	row     int
+	variant models.ProductVariant
+}
+
+// importProduct is one item_id's rows, grouped in file order
+type importProduct struct {
+	row      int
+	fields   map[string]string
+	fieldRow map[string]int
+	product  models.Product
+	variants []importVariant
+	failed   bool
+}
+
+// ImportProducts creates products from a CSV or XLSX upload (form field
+// "file") with one row per variant. Rows sharing an item_id form one
+// product; category, subcategory and brand are given by name. With
+// dry_run=true every row is validated, including SKU and barcode checks,
+// and nothing is saved. Otherwise the whole file is imported or, if any row
+// has an error, none of it.
+func ImportProducts(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true" || c.PostForm("dry_run") == "true"
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload the spreadsheet in the file field"})
+		return
+	}
+	if fileHeader.Size > maxImportBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read upload"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxImportBytes+1))
+	file.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read upload"})
+		return
+	}
+
+	// One extra row for the header; longer sheets stop being read there
+	records, err := utils.ReadSpreadsheet(fileHeader.Filename, data, maxImportRows+1)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not parse spreadsheet: " + err.Error()})
+		return
+	}
+
+	rows, err := parseImportRows(records)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid header row: " + err.Error()})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The file has no data rows"})
+		return
+	}
+	if len(rows) > maxImportRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Import at most " + strconv.Itoa(maxImportRows) + " rows at a time"})
+		return
+	}
+
+	// Opening stock is placed in the caller's store, as in CreateProduct
+	storeID, ok := writeStoreID(c)
+	if !ok {
+		return
+	}
+
+	var rowErrors []importRowError
+	addError := func(row int, field, message string) {
+		rowErrors = append(rowErrors, importRowError{Row: row, Field: field, Message: message})
+	}
+
+	products := groupImportRows(rows, addError)
+
+	db := database.GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start transaction"})
+		return
+	}
+
+	lookup, err := models.LoadImportLookupTx(tx)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	imported := []gin.H{}
+	variantCount := 0
+	for _, p := range products {
+		if !resolveImportRefs(p, lookup, addError) || p.failed {
+			continue
+		}
+
+		fieldErr := models.ValidateProductRefsTx(tx, 0, models.ProductRefs{
+			ItemID:        p.product.ItemID,
+			CategoryID:    p.product.CategoryID,
+			SubcategoryID: p.product.SubcategoryID,
+			BrandID:       p.product.BrandID,
+		})
+		var refErr *models.FieldError
+		if errors.As(fieldErr, &refErr) {
+			field := refErr.Field
+			if column, ok := importRefColumns[field]; ok {
+				field = column
+			}
+			addError(p.fieldRow[field], field, refErr.Message)
+			continue
+		}
+		if fieldErr != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fieldErr.Error()})
+			return
+		}
+
+		if err := models.CreateProductTx(tx, &p.product); err != nil {
+			tx.Rollback()
+			log.Printf("❌ Product import error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create product: " + err.Error()})
+			return
+		}
+
+		created := 0
+		for i := range p.variants {
+			iv := &p.variants[i]
+			iv.variant.ProductID = p.product.ID
+
+			err := applyVariantSKUTx(tx, &iv.variant)
+			field := "sku"
+			if err == nil {
+				err = checkVariantBarcodeTx(tx, &iv.variant)
+				field = "barcode"
+			}
+			if err == nil {
+				err = models.CreateProductVariantTx(tx, &iv.variant)
+				field = ""
+				if errors.Is(err, models.ErrDuplicateSKU) {
+					field = "sku"
+				} else if errors.Is(err, models.ErrDuplicateBarcode) {
+					field = "barcode"
+				}
+			}
+			if err == nil {
+				err = assignVariantBarcodeTx(tx, &iv.variant)
+				field = "barcode"
+			}
+			if err == nil {
+				err = models.SetStoreStockTx(tx, storeID, iv.variant.ID, iv.variant.CurrentStock)
+				field = ""
+			}
+
+			if err != nil {
+				if errors.Is(err, models.ErrDuplicateSKU) || errors.Is(err, models.ErrInvalidSKU) ||
+					errors.Is(err, models.ErrDuplicateBarcode) || errors.Is(err, utils.ErrInvalidEAN13) {
+					addError(iv.row, field, err.Error())
+					continue
+				}
+				tx.Rollback()
+				log.Printf("❌ Product import variant error on row %d: %v", iv.row, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create variant from row " + strconv.Itoa(iv.row) + ": " + err.Error()})
+				return
+			}
+			created++
+		}
+
+		variantCount += created
+		imported = append(imported, gin.H{
+			"row":       p.row,
+			"item_id":   p.product.ItemID,
+			"item_name": p.product.ItemName,
+			"variants":  created,
+		})
+	}
+
+	if rowErrors == nil {
+		rowErrors = []importRowError{}
+	}
+	sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+	summary := gin.H{
+		"dry_run":  dryRun,
+		"rows":     len(rows),
+		"products": len(products),
+		"variants": variantCount,
+		"errors":   rowErrors,
+	}
+
+	if dryRun || len(rowErrors) > 0 {
+		tx.Rollback()
+		summary["valid"] = len(rowErrors) == 0
+		if dryRun {
+			c.JSON(http.StatusOK, summary)
+		} else {
+			summary["message"] = "Nothing was imported; fix the errors and upload again"
+			c.JSON(http.StatusUnprocessableEntity, summary)
+		}
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed: " + err.Error()})
+		return
+	}
+
+	productIDs := make([]int, len(products))
+	for i, p := range products {
+		productIDs[i] = p.product.ID
+	}
+	for i := range imported {
+		imported[i]["product_id"] = productIDs[i]
+	}
+	search.RefreshProducts(productIDs...)
+
+	log.Printf("✅ Imported %d products with %d variants from %s", len(products), variantCount, fileHeader.Filename)
+	middleware.RecordAudit(c, "import", "products", 0, nil, gin.H{"file": fileHeader.Filename, "product_ids": productIDs})
+
+	summary["valid"] = true
+	summary["imported"] = imported
+	c.JSON(http.StatusCreated, summary)
+}
+
+// parseImportRows maps each data row to its values by column name. The
+// first non-blank row is the header; blank rows are skipped.
+func parseImportRows(records [][]string) ([]importRow, error) {
+	headerIndex := -1
+	for i, record := range records {
+		if strings.TrimSpace(strings.Join(record, "")) != "" {
+			headerIndex = i
+			break
+		}
+	}
+	if headerIndex < 0 {
+		return nil, nil
+	}
+
+	columns := make([]string, len(records[headerIndex]))
+	seen := map[string]bool{}
+	for i, name := range records[headerIndex] {
+		key := strings.ToLower(strings.TrimSpace(name))
+		key = strings.NewReplacer(" ", "_", "-", "_").Replace(key)
+		if alias, ok := importColumnAliases[key]; ok {
+			key = alias
+		}
+		if key == "" {
+			continue
+		}
+		if !importColumns[key] {
+			return nil, errors.New("unknown column " + name)
+		}
+		if seen[key] {
+			return nil, errors.New("duplicate column " + name)
+		}
+		seen[key] = true
+		columns[i] = key
+	}
+	if !seen["item_id"] {
+		return nil, errors.New("the item_id column is required")
+	}
+
+	var rows []importRow
+	for i := headerIndex + 1; i < len(records); i++ {
+		if strings.TrimSpace(strings.Join(records[i], "")) == "" {
+			continue
+		}
+		row := importRow{number: i + 1, values: map[string]string{}}
+		for j, value := range records[i] {
+			if j < len(columns) && columns[j] != "" {
+				row.values[columns[j]] = strings.TrimSpace(value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// groupImportRows collects rows into products by item_id, checking the
+// values that need no database access
+func groupImportRows(rows []importRow, addError func(row int, field, message string)) []*importProduct {
+	var products []*importProduct
+	byItemID := map[string]*importProduct{}
+
+	for _, row := range rows {
+		itemID := row.values["item_id"]
+		if itemID == "" {
+			addError(row.number, "item_id", "item_id is required")
+			continue
+		}
+
+		p, ok := byItemID[itemID]
+		if !ok {
+			p = &importProduct{row: row.number, fields: map[string]string{}, fieldRow: map[string]int{"item_id": row.number}}
+			p.product.ItemID = itemID
+			byItemID[itemID] = p
+			products = append(products, p)
+		}
+
+		for _, column := range importProductColumns {
+			value := row.values[column]
+			if value == "" {
+				continue
+			}
+			if existing, ok := p.fields[column]; ok {
+				if !strings.EqualFold(existing, value) {
+					addError(row.number, column, "differs from row "+strconv.Itoa(p.fieldRow[column])+" for item_id "+itemID)
+					p.failed = true
+				}
+				continue
+			}
+			p.fields[column] = value
+			p.fieldRow[column] = row.number
+		}
+
+		hasVariant := false
+		for _, column := range importVariantColumns {
+			if row.values[column] != "" {
+				hasVariant = true
+				break
+			}
+		}
+		if !hasVariant {
+			continue
+		}
+
+		variant, ok := parseImportVariant(row, addError)
+		if !ok {
+			p.failed = true
+			continue
+		}
+
+		key := models.VariantKey(variant.Gender, variant.Size, variant.Color)
+		for _, other := range p.variants {
+			if models.VariantKey(other.variant.Gender, other.variant.Size, other.variant.Color) == key {
+				addError(row.number, "size", "same gender, size and color as row "+strconv.Itoa(other.row))
+				p.failed = true
+				ok = false
+				break
+			}
+		}
+		if ok {
+			p.variants = append(p.variants, importVariant{row: row.number, variant: variant})
+		}
+	}
+
+	for _, p := range products {
+		p.product.ItemName = p.fields["item_name"]
+		p.product.Model = p.fields["model"]
+		p.product.Description = p.fields["description"]
+		if p.product.ItemName == "" {
+			addError(p.row, "item_name", "item_name is required for item_id "+p.product.ItemID)
+			p.failed = true
+		}
+		if value, ok := p.fields["low_stock_threshold"]; ok {
+			threshold, err := strconv.Atoi(value)
+			if err != nil || threshold < 0 {
+				addError(p.fieldRow["low_stock_threshold"], "low_stock_threshold", "must be a non-negative whole number")
+				p.failed = true
+			}
+			p.product.LowStockThreshold = threshold
+		}
+	}
+	return products
+}
+
+func parseImportVariant(row importRow, addError func(row int, field, message string)) (models.ProductVariant, bool) {
+	ok := true
+	variant := models.ProductVariant{
+		Gender:   strings.ToLower(row.values["gender"]),
+		Size:     row.values["size"],
+		Color:    row.values["color"],
+		SKU:      row.values["sku"],
+		Barcode:  row.values["barcode"],
+		ImageURL: row.values["image_url"],
+		IsActive: true,
+	}
+
+	if variant.Gender == "" {
+		variant.Gender = "unisex"
+	}
+	if !variantGenders[variant.Gender] {
+		addError(row.number, "gender", "must be male, female, kids or unisex")
+		ok = false
+	}
+
+	for column, target := range map[string]*float64{
+		"mrp":           &variant.MRP,
+		"selling_price": &variant.SellingPrice,
+		"cost_price":    &variant.CostPrice,
+	} {
+		value := strings.NewReplacer("₹", "", ",", "", " ", "").Replace(row.values[column])
+		if value == "" {
+			continue
+		}
+		price, err := strconv.ParseFloat(value, 64)
+		if err != nil || price < 0 {
+			addError(row.number, column, "must be a non-negative number")
+			ok = false
+			continue
+		}
+		*target = price
+	}
+
+	if value := row.values["opening_stock"]; value != "" {
+		stock, err := strconv.Atoi(value)
+		if err != nil || stock < 0 {
+			addError(row.number, "opening_stock", "must be a non-negative whole number")
+			ok = false
+		}
+		variant.CurrentStock = stock
+	}
+	return variant, ok
+}
+
+// resolveImportRefs fills in the product's category, subcategory and brand
+// IDs from their names, reporting names that do not match an active row
+func resolveImportRefs(p *importProduct, lookup *models.ImportLookup, addError func(row int, field, message string)) bool {
+	ok := true
+	if name, given := p.fields["category"]; given {
+		if id, found := lookup.Categories[models.ImportKey(name)]; found {
+			p.product.CategoryID = &id
+		} else {
+			addError(p.fieldRow["category"], "category", "no active category named "+name)
+			ok = false
+		}
+	}
+
+	if name, given := p.fields["subcategory"]; given {
+		switch {
+		case p.product.CategoryID == nil:
+			if ok {
+				addError(p.fieldRow["subcategory"], "subcategory", "subcategory requires a category")
+			}
+			ok = false
+		default:
+			if id, found := lookup.Subcategories[*p.product.CategoryID][models.ImportKey(name)]; found {
+				p.product.SubcategoryID = &id
+			} else {
+				addError(p.fieldRow["subcategory"], "subcategory", "no active subcategory named "+name+" in "+p.fields["category"])
+				ok = false
+			}
+		}
+	}
+
+	if name, given := p.fields["brand"]; given {
+		if id, found := lookup.Brands[models.ImportKey(name)]; found {
+			p.product.BrandID = &id
+		} else {
+			addError(p.fieldRow["brand"], "brand", "no active brand named "+name)
+			ok = false
+		}
+	}
+	return ok
+}
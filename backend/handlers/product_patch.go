@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"stock-management/search"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetProduct returns one product with its ETag, for use in If-Match on
+// PUT/PATCH
+func GetProduct(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	db := database.GetDB()
+	product, err := models.GetProductByID(db, productID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.Header("ETag", productETag(product.ID, product.UpdatedAt))
+	c.JSON(http.StatusOK, product)
+}
+
+// PatchProduct applies a JSON merge patch (RFC 7386) to a product's own
+// fields: only the keys sent are changed and null clears a field. The
+// If-Match header must carry the ETag the client last saw.
+func PatchProduct(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	if c.GetHeader("If-Match") == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the product's ETag is required"})
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	if err := c.BindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merge patch: " + err.Error()})
+		return
+	}
+
+	fields := map[string]interface{}{}
+	for key, raw := range patch {
+		value, err := decodeProductPatchField(key, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.FieldError{Field: key, Message: err.Error()})
+			return
+		}
+		fields[key] = value
+	}
+
+	db := database.GetDB()
+	previousProduct, _ := models.GetProductByID(db, productID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start transaction"})
+		return
+	}
+
+	if !checkProductIfMatch(c, tx, productID) {
+		tx.Rollback()
+		return
+	}
+
+	// Validate the references as they will be after the patch
+	refs, err := models.GetProductRefsTx(tx, productID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if value, ok := fields["item_id"]; ok {
+		refs.ItemID = value.(string)
+	}
+	for key, ref := range map[string]**int{
+		"category_id":    &refs.CategoryID,
+		"subcategory_id": &refs.SubcategoryID,
+		"brand_id":       &refs.BrandID,
+	} {
+		if value, ok := fields[key]; ok {
+			*ref = nil
+			if id, isID := value.(int); isID {
+				*ref = &id
+			}
+		}
+	}
+	if !validateProductRefsTx(c, tx, productID, refs) {
+		tx.Rollback()
+		return
+	}
+
+	if len(fields) > 0 {
+		if err := models.PatchProductTx(tx, productID, fields); err != nil {
+			tx.Rollback()
+			log.Printf("❌ Product patch error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed: " + err.Error()})
+		return
+	}
+	search.RefreshProducts(productID)
+
+	updatedProduct, err := models.GetProductByID(db, productID)
+	if err != nil {
+		// Patched to inactive; nothing left to show
+		middleware.RecordAudit(c, "update", "products", productID, previousProduct, fields)
+		c.JSON(http.StatusOK, gin.H{"message": "Product updated successfully"})
+		return
+	}
+
+	middleware.RecordAudit(c, "update", "products", productID, previousProduct, updatedProduct)
+
+	c.Header("ETag", productETag(updatedProduct.ID, updatedProduct.UpdatedAt))
+	c.JSON(http.StatusOK, updatedProduct)
+}
+
+// decodeProductPatchField converts one merge-patch member to the value to
+// store, applying the same rules as create/update
+func decodeProductPatchField(key string, raw json.RawMessage) (interface{}, error) {
+	if !models.ProductPatchColumns[key] {
+		return nil, fmt.Errorf("unknown or read-only field")
+	}
+	isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+	switch key {
+	case "item_id", "item_name":
+		var value string
+		if isNull || json.Unmarshal(raw, &value) != nil || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("must be a non-empty string")
+		}
+		return value, nil
+	case "model", "description":
+		if isNull {
+			return "", nil
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("must be a string")
+		}
+		return value, nil
+	case "category_id", "subcategory_id", "brand_id":
+		if isNull {
+			return nil, nil
+		}
+		var value int
+		if err := json.Unmarshal(raw, &value); err != nil || value < 0 {
+			return nil, fmt.Errorf("must be an ID or null")
+		}
+		// 0 clears the reference, as in PUT
+		if value == 0 {
+			return nil, nil
+		}
+		return value, nil
+	case "low_stock_threshold":
+		var value int
+		if isNull {
+			return 0, nil
+		}
+		if err := json.Unmarshal(raw, &value); err != nil || value < 0 {
+			return nil, fmt.Errorf("must be a non-negative integer")
+		}
+		return value, nil
+	case "is_active":
+		var value bool
+		if isNull || json.Unmarshal(raw, &value) != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return value, nil
+	}
+	return nil, fmt.Errorf("unknown or read-only field")
+}
+
+// checkProductIfMatch locks the product and, when the request carries
+// If-Match, rejects it with 412 unless the ETag is current. If-Match uses
+// strong comparison, so weak (W/) tags never match. It writes the response
+// and returns false when the request must stop.
+func checkProductIfMatch(c *gin.Context, tx *sql.Tx, productID int) bool {
+	updatedAt, err := models.LockProductTx(tx, productID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return false
+	}
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" || ifMatch == "*" {
+		return true
+	}
+
+	current := productETag(productID, updatedAt)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(tag) == current {
+			return true
+		}
+	}
+
+	c.Header("ETag", current)
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":      models.ErrProductModified.Error() + "; reload and try again",
+		"updated_at": updatedAt,
+	})
+	return false
+}
+
+func productETag(productID int, updatedAt time.Time) string {
+	return fmt.Sprintf(`"%d-%d"`, productID, updatedAt.UnixMicro())
+}
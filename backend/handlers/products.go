@@ -1,18 +1,24 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
 	"stock-management/database"
+	"stock-management/middleware"
 	"stock-management/models"
+	"stock-management/search"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Page size when GET /products is paged without page_size
+const defaultProductPageSize = 50
+
 func GetSubcategories(c *gin.Context) {
     categoryIDStr := c.Param("id")
     categoryID, err := strconv.Atoi(categoryIDStr)
@@ -38,27 +44,176 @@ func CreateSubcategory(c *gin.Context) {
 		return
 	}
 
+	if !checkTaxonomyName(c, models.KindSubcategory, subcategory.Name, subcategory.CategoryID, 0) {
+		return
+	}
+	subcategory.Name = strings.TrimSpace(subcategory.Name)
+
 	db := database.GetDB()
 	if err := models.CreateSubcategory(db, &subcategory); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondTaxonomyError(c, err)
 		return
 	}
 
+	middleware.RecordAudit(c, "create", "subcategories", subcategory.ID, nil, subcategory)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Subcategory created successfully",
 		"data": subcategory,
 	})
 }
 
+// UpdateSubcategory renames or moves a subcategory and can deactivate (with
+// reassign_to) or reactivate it through is_active
+func UpdateSubcategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subcategory ID"})
+		return
+	}
+
+	var req taxonomyUpdate
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.CategoryID <= 0 {
+		c.JSON(http.StatusBadRequest, models.FieldError{Field: "category_id", Message: "category_id is required"})
+		return
+	}
+
+	if !checkTaxonomyName(c, models.KindSubcategory, req.Name, req.CategoryID, id) {
+		return
+	}
+
+	subcategory := models.Subcategory{
+		ID:          id,
+		Name:        strings.TrimSpace(req.Name),
+		CategoryID:  req.CategoryID,
+		Description: req.Description,
+	}
+	moved, ok := updateTaxonomy(c, models.KindSubcategory, id, req, func(tx *sql.Tx) error {
+		return models.UpdateSubcategoryTx(tx, &subcategory)
+	})
+	if !ok {
+		return
+	}
+
+	middleware.RecordAudit(c, "update", "subcategories", id, nil, req)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Subcategory updated successfully",
+		"products_reassigned": moved,
+	})
+}
+
+func DeleteSubcategory(c *gin.Context) {
+	deactivateTaxonomy(c, models.KindSubcategory)
+}
+
+func ReorderSubcategories(c *gin.Context) {
+	reorderTaxonomy(c, models.KindSubcategory)
+}
+
+// GetProducts lists active products. Query parameters:
+//
+//	q                      search item name, item_id, model, SKU and barcode
+//	category_id, subcategory_id, brand_id
+//	gender, size, color, min_price, max_price, in_stock=true
+//	sort                   name, item_id, created_at, updated_at or price; "-" prefix for descending
+//	page, page_size        numbered pages, or
+//	cursor, page_size      the X-Next-Cursor of the previous page
+//
+// The body stays a plain array; X-Total-Count carries the number of matches.
+// Without page, page_size or cursor every match is returned.
 func GetProducts(c *gin.Context) {
+	filter := models.ProductFilter{
+		StoreID: c.GetInt("store_id"),
+		Search:  c.Query("q"),
+		Size:    strings.TrimSpace(c.Query("size")),
+		Color:   strings.TrimSpace(c.Query("color")),
+		Sort:    c.Query("sort"),
+		Cursor:  c.Query("cursor"),
+		InStock: c.Query("in_stock") == "true" || c.Query("in_stock") == "1",
+	}
+
+	for key, target := range map[string]*int{
+		"category_id":    &filter.CategoryID,
+		"subcategory_id": &filter.SubcategoryID,
+		"brand_id":       &filter.BrandID,
+		"page":           &filter.Page,
+		"page_size":      &filter.PageSize,
+	} {
+		value, err := queryInt(c, key)
+		if err != nil || value < 0 {
+			c.JSON(http.StatusBadRequest, models.FieldError{Field: key, Message: "must be a non-negative integer"})
+			return
+		}
+		*target = value
+	}
+
+	for key, target := range map[string]**float64{
+		"min_price": &filter.MinPrice,
+		"max_price": &filter.MaxPrice,
+	} {
+		if value := c.Query(key); value != "" {
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil || price < 0 {
+				c.JSON(http.StatusBadRequest, models.FieldError{Field: key, Message: "must be a non-negative number"})
+				return
+			}
+			*target = &price
+		}
+	}
+
+	if gender := strings.ToLower(strings.TrimSpace(c.Query("gender"))); gender != "" {
+		if !variantGenders[gender] {
+			c.JSON(http.StatusBadRequest, models.FieldError{Field: "gender", Message: "must be male, female, kids or unisex"})
+			return
+		}
+		filter.Gender = gender
+	}
+
+	if _, ok := models.ProductSorts[strings.TrimPrefix(filter.Sort, "-")]; filter.Sort != "" && !ok {
+		c.JSON(http.StatusBadRequest, models.FieldError{Field: "sort", Message: "must be name, item_id, created_at, updated_at or price"})
+		return
+	}
+
+	paged := filter.Page > 0 || filter.PageSize > 0 || filter.Cursor != ""
+	if paged {
+		if filter.PageSize == 0 {
+			filter.PageSize = defaultProductPageSize
+		}
+		if filter.PageSize > models.MaxProductPageSize {
+			filter.PageSize = models.MaxProductPageSize
+		}
+		if filter.Page == 0 {
+			filter.Page = 1
+		}
+	}
+
 	db := database.GetDB()
-	products, err := models.GetAllProducts(db)
+	page, err := models.SearchProducts(db, filter)
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, models.FieldError{Field: "cursor", Message: "invalid or from a different sort"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, products)
+	c.Header("X-Total-Count", strconv.Itoa(page.Total))
+	if paged {
+		c.Header("X-Page-Size", strconv.Itoa(filter.PageSize))
+		if filter.Cursor == "" {
+			c.Header("X-Page", strconv.Itoa(filter.Page))
+		}
+		if page.NextCursor != "" {
+			c.Header("X-Next-Cursor", page.NextCursor)
+		}
+	}
+	c.JSON(http.StatusOK, page.Products)
 }
 
 // Updated CreateProduct to handle variants
@@ -81,6 +236,16 @@ func CreateProduct(c *gin.Context) {
         return
     }
 
+    // Opening stock on new variants is placed in the caller's store
+    storeID, ok := writeStoreID(c)
+    if !ok {
+        return
+    }
+
+    req.CategoryID = models.NormalizeRef(req.CategoryID)
+    req.SubcategoryID = models.NormalizeRef(req.SubcategoryID)
+    req.BrandID = models.NormalizeRef(req.BrandID)
+
     db := database.GetDB()
 
     // Start transaction
@@ -90,6 +255,16 @@ func CreateProduct(c *gin.Context) {
         return
     }
 
+    if !validateProductRefsTx(c, tx, 0, models.ProductRefs{
+        ItemID:        req.ItemID,
+        CategoryID:    req.CategoryID,
+        SubcategoryID: req.SubcategoryID,
+        BrandID:       req.BrandID,
+    }) {
+        tx.Rollback()
+        return
+    }
+
     // Create main product
     product := models.Product{
         ItemID:           req.ItemID,
@@ -109,18 +284,45 @@ func CreateProduct(c *gin.Context) {
     }
 
     // Create variants
-   for i, variant := range req.Variants {
+   for _, variant := range req.Variants {
     variant.ProductID = product.ID
     
     // Generate SKU if not provided
-    if variant.SKU == "" {
-        timestamp := time.Now().Unix()
-        variant.SKU = fmt.Sprintf("SKU-%d-%d-%d", timestamp, product.ID, i)
+    if err := applyVariantSKUTx(tx, &variant); err != nil {
+        tx.Rollback()
+        if !respondVariantCodeError(c, err) {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate SKU: " + err.Error()})
+        }
+        return
+    }
+
+    if err := checkVariantBarcodeTx(tx, &variant); err != nil {
+        tx.Rollback()
+        if !respondVariantCodeError(c, err) {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        }
+        return
     }
 
     if err := models.CreateProductVariantTx(tx, &variant); err != nil {
         tx.Rollback()
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create variant: " + err.Error()})
+        if !respondVariantCodeError(c, err) {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create variant: " + err.Error()})
+        }
+        return
+    }
+
+    if err := assignVariantBarcodeTx(tx, &variant); err != nil {
+        tx.Rollback()
+        if !respondVariantCodeError(c, err) {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not assign barcode: " + err.Error()})
+        }
+        return
+    }
+
+    if err := models.SetStoreStockTx(tx, storeID, variant.ID, variant.CurrentStock); err != nil {
+        tx.Rollback()
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not set variant stock: " + err.Error()})
         return
     }
 }
@@ -131,9 +333,12 @@ func CreateProduct(c *gin.Context) {
         return
     }
 
+    search.RefreshProducts(product.ID)
+
     // Get the complete product with variants
     completeProduct, err := models.GetProductByID(db, product.ID)
     if err != nil {
+        middleware.RecordAudit(c, "create", "products", product.ID, nil, product)
         c.JSON(http.StatusOK, gin.H{
             "message": "Product created successfully",
             "product_id": product.ID,
@@ -141,6 +346,7 @@ func CreateProduct(c *gin.Context) {
         return
     }
 
+    middleware.RecordAudit(c, "create", "products", product.ID, nil, completeProduct)
     c.JSON(http.StatusCreated, completeProduct)
 }
 
@@ -163,6 +369,9 @@ func UpdateProduct(c *gin.Context) {
         LowStockThreshold int                    `json:"low_stock_threshold"`
         IsActive         *bool                   `json:"is_active"`
         Variants         []models.ProductVariant `json:"variants"`
+        // Variants to remove; those with stock on hand need force_remove
+        RemoveVariantIDs []int                   `json:"remove_variant_ids"`
+        ForceRemove      bool                    `json:"force_remove"`
     }
 
     if err := c.BindJSON(&req); err != nil {
@@ -171,8 +380,26 @@ func UpdateProduct(c *gin.Context) {
         return
     }
 
+    // PUT replaces the whole product, so the required fields must be sent
+    if req.ItemID == "" {
+        c.JSON(http.StatusBadRequest, models.FieldError{Field: "item_id", Message: "item_id is required"})
+        return
+    }
+    if req.ItemName == "" {
+        c.JSON(http.StatusBadRequest, models.FieldError{Field: "item_name", Message: "item_name is required"})
+        return
+    }
+
+    storeID, ok := writeStoreID(c)
+    if !ok {
+        return
+    }
+
     db := database.GetDB()
 
+    // Snapshot for the audit log; inactive products have no snapshot
+    previousProduct, _ := models.GetProductByID(db, productID)
+
     // Start transaction
     tx, err := db.Begin()
     if err != nil {
@@ -180,10 +407,29 @@ func UpdateProduct(c *gin.Context) {
         return
     }
 
+    // Honour If-Match so a stale edit cannot overwrite a newer one
+    if !checkProductIfMatch(c, tx, productID) {
+        tx.Rollback()
+        return
+    }
+
+    req.CategoryID = models.NormalizeRef(req.CategoryID)
+    req.SubcategoryID = models.NormalizeRef(req.SubcategoryID)
+    req.BrandID = models.NormalizeRef(req.BrandID)
+    if !validateProductRefsTx(c, tx, productID, models.ProductRefs{
+        ItemID:        req.ItemID,
+        CategoryID:    req.CategoryID,
+        SubcategoryID: req.SubcategoryID,
+        BrandID:       req.BrandID,
+    }) {
+        tx.Rollback()
+        return
+    }
+
     // Update main product
     query := `UPDATE products SET 
         item_id = ?, item_name = ?, model = ?, description = ?, 
-        low_stock_threshold = ?, updated_at = NOW()`
+        low_stock_threshold = ?, updated_at = NOW(6)`
 
     var args []interface{}
     args = append(args, req.ItemID, req.ItemName, req.Model, req.Description, req.LowStockThreshold)
@@ -235,32 +481,123 @@ func UpdateProduct(c *gin.Context) {
         return
     }
 
+    // A new threshold or is_active changes which alerts apply
+    if err := models.EvaluateProductStockAlertsTx(tx, productID); err != nil {
+        tx.Rollback()
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update stock alerts: " + err.Error()})
+        return
+    }
+
     // Update variants
     for _, variant := range req.Variants {
     if variant.ID > 0 {
+        // Clients send back the quantity they were shown (store or total).
+        // Stock only changes through stock adjustments, which are recorded
+        // and subject to approval, so a different value is refused.
+        shownStock, err := models.GetVariantStockTx(tx, variant.ID, c.GetInt("store_id"))
+        if err != nil {
+            tx.Rollback()
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not read variant stock: " + err.Error()})
+            return
+        }
+        if variant.CurrentStock != shownStock {
+            tx.Rollback()
+            c.JSON(http.StatusConflict, models.FieldError{
+                Field: "current_stock",
+                Message: fmt.Sprintf("variant %d has %d in stock, not %d; reload the product, and change stock with POST /stock-adjustments",
+                    variant.ID, shownStock, variant.CurrentStock),
+            })
+            return
+        }
+
+        // A cleared SKU is regenerated from the template
+        variant.ProductID = productID
+        if err := applyVariantSKUTx(tx, &variant); err != nil {
+            tx.Rollback()
+            if !respondVariantCodeError(c, err) {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate SKU: " + err.Error()})
+            }
+            return
+        }
+
+        if err := checkVariantBarcodeTx(tx, &variant); err != nil {
+            tx.Rollback()
+            if !respondVariantCodeError(c, err) {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            }
+            return
+        }
+
         // Update existing variant
         if err := models.UpdateProductVariantTx(tx, &variant); err != nil {
             tx.Rollback()
-            log.Printf("❌ Variant update error: %v", err)
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update variant: " + err.Error()})
+            if !respondVariantCodeError(c, err) {
+                log.Printf("❌ Variant update error: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update variant: " + err.Error()})
+            }
             return
         }
+
+        // Clearing a barcode gets a generated one rather than leaving it blank
+        if err := assignVariantBarcodeTx(tx, &variant); err != nil {
+            tx.Rollback()
+            if !respondVariantCodeError(c, err) {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not assign barcode: " + err.Error()})
+            }
+            return
+        }
+
     } else {
         // Create new variant
         variant.ProductID = productID
-        if variant.SKU == "" {
-            timestamp := time.Now().Unix()
-            variant.SKU = fmt.Sprintf("SKU-%d-%d-%d", timestamp, productID, rand.Intn(1000))
+        if err := applyVariantSKUTx(tx, &variant); err != nil {
+            tx.Rollback()
+            if !respondVariantCodeError(c, err) {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate SKU: " + err.Error()})
+            }
+            return
+        }
+        if err := checkVariantBarcodeTx(tx, &variant); err != nil {
+            tx.Rollback()
+            if !respondVariantCodeError(c, err) {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            }
+            return
         }
         if err := models.CreateProductVariantTx(tx, &variant); err != nil {
             tx.Rollback()
-            log.Printf("❌ Variant creation error: %v", err)
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create variant: " + err.Error()})
+            if !respondVariantCodeError(c, err) {
+                log.Printf("❌ Variant creation error: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create variant: " + err.Error()})
+            }
+            return
+        }
+        if err := assignVariantBarcodeTx(tx, &variant); err != nil {
+            tx.Rollback()
+            if !respondVariantCodeError(c, err) {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not assign barcode: " + err.Error()})
+            }
+            return
+        }
+        if err := models.SetStoreStockTx(tx, storeID, variant.ID, variant.CurrentStock); err != nil {
+            tx.Rollback()
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not set variant stock: " + err.Error()})
             return
         }
     }
 }
 
+    removedVariants := gin.H{}
+    for _, variantID := range req.RemoveVariantIDs {
+        outcome, err := models.RemoveProductVariantTx(tx, productID, variantID, c.GetInt("user_id"), req.ForceRemove)
+        if err != nil {
+            tx.Rollback()
+            respondVariantRemovalError(c, err)
+            return
+        }
+        removedVariants[strconv.Itoa(variantID)] = outcome
+    }
+
     // Commit transaction
     if err := tx.Commit(); err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed: " + err.Error()})
@@ -268,17 +605,24 @@ func UpdateProduct(c *gin.Context) {
     }
 
     log.Printf("✅ Product updated successfully: ID %d", productID)
+    search.RefreshProducts(productID)
+    removeOrphanedFiles(productFileURLs(previousProduct)...)
     
     // Return updated product with variants
     updatedProduct, err := models.GetProductByID(db, productID)
     if err != nil {
+        middleware.RecordAudit(c, "update", "products", productID, previousProduct, nil)
         c.JSON(http.StatusOK, gin.H{"message": "Product updated successfully"})
         return
     }
-    
+
+    middleware.RecordAudit(c, "update", "products", productID, previousProduct, updatedProduct)
+
+    c.Header("ETag", productETag(updatedProduct.ID, updatedProduct.UpdatedAt))
     c.JSON(http.StatusOK, gin.H{
         "message": "Product updated successfully",
         "product": updatedProduct,
+        "removed_variants": removedVariants,
     })
 }
 
@@ -291,10 +635,15 @@ func DeleteProduct(c *gin.Context) {
 	}
 
 	db := database.GetDB()
+	previousProduct, _ := models.GetProductByID(db, productID)
+
 	if err := models.DeleteProduct(db, productID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	search.RefreshProducts(productID)
+
+	middleware.RecordAudit(c, "delete", "products", productID, previousProduct, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
@@ -309,7 +658,7 @@ func GetProductVariants(c *gin.Context) {
 	}
 
 	db := database.GetDB()
-	variants, err := models.GetVariantsByProductID(db, productID)
+	variants, err := models.GetStoreVariantsByProductID(db, productID, c.GetInt("store_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -318,6 +667,71 @@ func GetProductVariants(c *gin.Context) {
 	c.JSON(http.StatusOK, variants)
 }
 
+// DeleteProductVariant removes one variant: deleted outright when it has no
+// history, deactivated otherwise. Pass force=true to write off stock on hand.
+func DeleteProductVariant(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	variantID, err := strconv.Atoi(c.Param("variantId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	db := database.GetDB()
+	previousProduct, _ := models.GetProductByID(db, productID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start transaction"})
+		return
+	}
+
+	outcome, err := models.RemoveProductVariantTx(tx, productID, variantID, c.GetInt("user_id"), c.Query("force") == "true")
+	if err != nil {
+		tx.Rollback()
+		respondVariantRemovalError(c, err)
+		return
+	}
+
+	if err := models.TouchProductTx(tx, productID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed: " + err.Error()})
+		return
+	}
+
+	search.RefreshProducts(productID)
+	removeOrphanedFiles(productFileURLs(previousProduct)...)
+
+	updatedProduct, _ := models.GetProductByID(db, productID)
+	middleware.RecordAudit(c, "delete_variant", "products", productID, previousProduct, updatedProduct)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Variant " + outcome,
+		"result":  outcome,
+	})
+}
+
+func respondVariantRemovalError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrVariantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrVariantHasStock):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error() + "; pass force to write it off"})
+	default:
+		log.Printf("❌ Variant removal error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 
 // package handlers
 
@@ -575,4 +989,22 @@ func GetProductVariants(c *gin.Context) {
 // 	}
 
 // 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
-// }
\ No newline at end of file
+// }
+
+// validateProductRefsTx runs models.ValidateProductRefsTx and writes the
+// field-level error response. It returns false when the request must stop.
+func validateProductRefsTx(c *gin.Context, tx *sql.Tx, productID int, refs models.ProductRefs) bool {
+	err := models.ValidateProductRefsTx(tx, productID, refs)
+	if err == nil {
+		return true
+	}
+
+	var fieldErr *models.FieldError
+	if errors.As(err, &fieldErr) {
+		c.JSON(http.StatusBadRequest, fieldErr)
+	} else {
+		log.Printf("❌ Product validation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return false
+}
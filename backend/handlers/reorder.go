@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"stock-management/config"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetReorderSuggestions lists variants at or below their reorder point.
+// ?days= and ?cover_days= override the velocity window and the days of
+// demand an order covers; ?supplier_id= and ?category_id= filter.
+func GetReorderSuggestions(c *gin.Context) {
+	opts, ok := reorderOptions(c, c.GetInt("store_id"))
+	if !ok {
+		return
+	}
+
+	suggestions, err := models.GetReorderSuggestions(database.GetDB(), opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if suggestions == nil {
+		suggestions = []models.ReorderSuggestion{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"store_id":      opts.StoreID,
+		"velocity_days": opts.VelocityDays,
+		"cover_days":    opts.CoverDays,
+		"suggestions":   suggestions,
+	})
+}
+
+// CreatePurchaseOrdersFromSuggestions converts the current suggestions for
+// the selected store into draft purchase orders, one per supplier. "items"
+// limits the conversion to some variants and may override their quantity.
+func CreatePurchaseOrdersFromSuggestions(c *gin.Context) {
+	var req struct {
+		Notes string `json:"notes"`
+		Items []struct {
+			ProductVariantID int `json:"product_variant_id"`
+			Quantity         int `json:"quantity"`
+		} `json:"items"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+	}
+
+	storeID, ok := writeStoreID(c)
+	if !ok {
+		return
+	}
+	opts, ok := reorderOptions(c, storeID)
+	if !ok {
+		return
+	}
+
+	overrides := map[int]int{}
+	for _, item := range req.Items {
+		if item.ProductVariantID <= 0 || item.Quantity < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Each item needs a product_variant_id and a non-negative quantity"})
+			return
+		}
+		overrides[item.ProductVariantID] = item.Quantity
+		opts.VariantIDs = append(opts.VariantIDs, item.ProductVariantID)
+	}
+
+	db := database.GetDB()
+	suggestions, err := models.GetReorderSuggestions(db, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var skipped []models.SkippedSuggestion
+	suggested := map[int]bool{}
+	for i := range suggestions {
+		suggested[suggestions[i].ProductVariantID] = true
+		if quantity := overrides[suggestions[i].ProductVariantID]; quantity > 0 {
+			suggestions[i].SuggestedQuantity = quantity
+		}
+	}
+	for _, item := range req.Items {
+		if !suggested[item.ProductVariantID] {
+			skipped = append(skipped, models.SkippedSuggestion{
+				ProductVariantID: item.ProductVariantID,
+				Reason:           "not at or below its reorder point",
+			})
+		}
+	}
+
+	orders, unconverted, err := models.CreatePurchaseOrdersFromSuggestions(db, storeID, c.GetInt("user_id"), req.Notes, suggestions)
+	if err != nil {
+		log.Printf("❌ Purchase order creation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create purchase orders: " + err.Error()})
+		return
+	}
+	skipped = append(skipped, unconverted...)
+	if skipped == nil {
+		skipped = []models.SkippedSuggestion{}
+	}
+
+	for _, order := range orders {
+		middleware.RecordAudit(c, "create", "purchase_orders", order.ID, nil, order)
+	}
+
+	status := http.StatusCreated
+	if len(orders) == 0 {
+		status = http.StatusOK
+	}
+	c.JSON(status, gin.H{"purchase_orders": orders, "skipped": skipped})
+}
+
+func GetPurchaseOrders(c *gin.Context) {
+	orders, err := models.GetPurchaseOrders(database.GetDB(), c.GetInt("store_id"), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if orders == nil {
+		orders = []models.PurchaseOrder{}
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+func GetPurchaseOrder(c *gin.Context) {
+	order, ok := loadPurchaseOrder(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// OrderPurchaseOrder marks a draft as sent to its supplier
+func OrderPurchaseOrder(c *gin.Context) {
+	updatePurchaseOrder(c, "order", func(db *sql.DB, order *models.PurchaseOrder) error {
+		return models.MarkPurchaseOrderOrdered(db, order.ID)
+	})
+}
+
+// ReceivePurchaseOrder books an ordered purchase order into its store's
+// stock. "bill_number" is the supplier's invoice, defaulting to the PO number.
+func ReceivePurchaseOrder(c *gin.Context) {
+	var req struct {
+		BillNumber string `json:"bill_number"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+	}
+
+	updatePurchaseOrder(c, "receive", func(db *sql.DB, order *models.PurchaseOrder) error {
+		return models.ReceivePurchaseOrder(db, order.ID, c.GetInt("user_id"), strings.TrimSpace(req.BillNumber))
+	})
+}
+
+func CancelPurchaseOrder(c *gin.Context) {
+	updatePurchaseOrder(c, "cancel", func(db *sql.DB, order *models.PurchaseOrder) error {
+		return models.CancelPurchaseOrder(db, order.ID)
+	})
+}
+
+// updatePurchaseOrder applies a status change to the purchase order named in
+// the URL and responds with the updated order
+func updatePurchaseOrder(c *gin.Context, action string, apply func(*sql.DB, *models.PurchaseOrder) error) {
+	previous, ok := loadPurchaseOrder(c)
+	if !ok {
+		return
+	}
+	if !canAccessStore(c, previous.StoreID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No access to this purchase order's store"})
+		return
+	}
+
+	db := database.GetDB()
+	if err := apply(db, previous); err != nil {
+		if errors.Is(err, models.ErrPurchaseOrderState) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": previous.Status})
+			return
+		}
+		log.Printf("❌ Purchase order %s error: %v", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := models.GetPurchaseOrderByID(db, previous.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.RecordAudit(c, action, "purchase_orders", previous.ID, previous, updated)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// loadPurchaseOrder fetches the purchase order named in the URL, hiding
+// orders of stores other than the caller's selected one
+func loadPurchaseOrder(c *gin.Context) (*models.PurchaseOrder, bool) {
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return nil, false
+	}
+
+	order, err := models.GetPurchaseOrderByID(database.GetDB(), orderID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+
+	if storeID := c.GetInt("store_id"); storeID != 0 && order.StoreID != storeID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return nil, false
+	}
+
+	return order, true
+}
+
+func GetVariantReorderSettings(c *gin.Context) {
+	variantID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	settings, err := models.GetVariantReorderSettings(database.GetDB(), variantID)
+	if err != nil {
+		respondReorderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateVariantReorderSettings replaces a variant's reorder point, reorder
+// quantity and supplier; null clears a value back to the computed default
+func UpdateVariantReorderSettings(c *gin.Context) {
+	variantID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var settings models.ReorderSettings
+	if err := c.BindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	previous, err := models.GetVariantReorderSettings(db, variantID)
+	if err != nil {
+		respondReorderError(c, err)
+		return
+	}
+	if err := models.UpdateVariantReorderSettings(db, variantID, settings); err != nil {
+		respondReorderError(c, err)
+		return
+	}
+
+	middleware.RecordAudit(c, "update", "product_variants", variantID, previous, settings)
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// reorderOptions reads the suggestion parameters shared by the reorder
+// endpoints, writing a 400 and returning false when one is invalid
+func reorderOptions(c *gin.Context, storeID int) (models.ReorderOptions, bool) {
+	opts := models.ReorderOptions{
+		StoreID:             storeID,
+		VelocityDays:        config.GetReorderVelocityDays(),
+		CoverDays:           config.GetReorderCoverDays(),
+		DefaultLeadTimeDays: config.GetDefaultLeadTimeDays(),
+	}
+
+	params := []struct {
+		key   string
+		value *int
+		min   int
+	}{
+		{"days", &opts.VelocityDays, 1},
+		{"cover_days", &opts.CoverDays, 0},
+		{"supplier_id", &opts.SupplierID, 0},
+		{"category_id", &opts.CategoryID, 0},
+	}
+	for _, param := range params {
+		if c.Query(param.key) == "" {
+			continue
+		}
+		value, err := queryInt(c, param.key)
+		if err != nil || value < param.min {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param.key})
+			return opts, false
+		}
+		*param.value = value
+	}
+	return opts, true
+}
+
+func respondReorderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrVariantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+	case errors.Is(err, models.ErrSupplierNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidReorderConfig):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
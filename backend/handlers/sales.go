@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
 	"time"
 	"github.com/gin-gonic/gin"
 )
@@ -23,6 +25,7 @@ type SaleRequest struct {
 
 type SaleItemRequest struct {
 	ProductID    int     `json:"product_id"`
+	ProductVariantID int `json:"product_variant_id"`
 	Quantity     int     `json:"quantity"`
 	UnitPrice    float64 `json:"unit_price"`
 	StockEntryID int     `json:"stock_entry_id"`
@@ -35,6 +38,11 @@ func CreateSale(c *gin.Context) {
 		return
 	}
 
+	storeID, ok := writeStoreID(c)
+	if !ok {
+		return
+	}
+
 	userID := c.GetInt("user_id")
 	saleNumber := fmt.Sprintf("SALE-%d", time.Now().Unix())
 
@@ -49,9 +57,9 @@ func CreateSale(c *gin.Context) {
 
 	// Insert sale
 	result, err := tx.Exec(`
-		INSERT INTO sales (sale_number, customer_name, customer_contact, total_amount, discount_amount, tax_amount, final_amount, payment_method, sold_by, notes)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		saleNumber, saleReq.CustomerName, saleReq.CustomerContact, saleReq.TotalAmount, 
+		INSERT INTO sales (sale_number, store_id, customer_name, customer_contact, total_amount, discount_amount, tax_amount, final_amount, payment_method, sold_by, notes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		saleNumber, storeID, saleReq.CustomerName, saleReq.CustomerContact, saleReq.TotalAmount, 
 		saleReq.DiscountAmount, saleReq.TaxAmount, saleReq.FinalAmount, saleReq.PaymentMethod, 
 		userID, saleReq.Notes)
 	if err != nil {
@@ -64,27 +72,42 @@ func CreateSale(c *gin.Context) {
 
 	// Insert sale items and update stock
 	for _, item := range saleReq.Items {
-		// Check stock availability
-		var currentQuantity int
-		err := tx.QueryRow("SELECT current_quantity FROM stock_entries WHERE id = ?", item.StockEntryID).Scan(&currentQuantity)
-		if err != nil {
+		if item.StockEntryID == 0 && item.ProductVariantID == 0 {
 			tx.Rollback()
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stock entry"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Each item needs a stock_entry_id or product_variant_id"})
 			return
 		}
 
-		if currentQuantity < item.Quantity {
-			tx.Rollback()
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock"})
-			return
+		if item.StockEntryID > 0 {
+			// Check stock availability
+			var currentQuantity, entryStoreID int
+			err := tx.QueryRow("SELECT current_quantity, COALESCE(store_id, 0) FROM stock_entries WHERE id = ? FOR UPDATE", item.StockEntryID).
+				Scan(&currentQuantity, &entryStoreID)
+			if err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stock entry"})
+				return
+			}
+
+			if entryStoreID != 0 && entryStoreID != storeID {
+				tx.Rollback()
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Stock entry belongs to another store"})
+				return
+			}
+
+			if currentQuantity < item.Quantity {
+				tx.Rollback()
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock"})
+				return
+			}
 		}
 
 		// Insert sale item
 		totalPrice := item.UnitPrice * float64(item.Quantity)
 		_, err = tx.Exec(`
-			INSERT INTO sale_items (sale_id, product_id, quantity, unit_price, total_price, stock_entry_id)
-			VALUES (?, ?, ?, ?, ?, ?)`,
-			saleID, item.ProductID, item.Quantity, item.UnitPrice, totalPrice, item.StockEntryID)
+			INSERT INTO sale_items (sale_id, product_id, product_variant_id, quantity, unit_price, total_price, stock_entry_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			saleID, item.ProductID, nullIfZero(item.ProductVariantID), item.Quantity, item.UnitPrice, totalPrice, nullIfZero(item.StockEntryID))
 		if err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not add sale item: " + err.Error()})
@@ -92,15 +115,30 @@ func CreateSale(c *gin.Context) {
 		}
 
 		// Update stock quantity
-		_, err = tx.Exec(`
-			UPDATE stock_entries 
-			SET current_quantity = current_quantity - ? 
-			WHERE id = ?`,
-			item.Quantity, item.StockEntryID)
-		if err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update stock: " + err.Error()})
-			return
+		if item.StockEntryID > 0 {
+			_, err = tx.Exec(`
+				UPDATE stock_entries 
+				SET current_quantity = current_quantity - ? 
+				WHERE id = ?`,
+				item.Quantity, item.StockEntryID)
+			if err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update stock: " + err.Error()})
+				return
+			}
+		}
+
+		// Sold variants leave this store's stock
+		if item.ProductVariantID > 0 {
+			if err := models.AdjustStoreStockTx(tx, storeID, item.ProductVariantID, -item.Quantity); err != nil {
+				tx.Rollback()
+				if err == models.ErrInsufficientStock {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update stock: " + err.Error()})
+				return
+			}
 		}
 	}
 
@@ -110,24 +148,33 @@ func CreateSale(c *gin.Context) {
 		return
 	}
 
+	middleware.RecordAudit(c, "create", "sales", int(saleID), nil, gin.H{
+		"sale_number": saleNumber,
+		"store_id":    storeID,
+		"sale":        saleReq,
+	})
+
 	c.JSON(http.StatusCreated, gin.H{
 		"id":          saleID,
 		"sale_number": saleNumber,
+		"store_id":    storeID,
 		"message":     "Sale completed successfully",
 	})
 }
 
 func GetSales(c *gin.Context) {
 	db := database.GetDB()
+	storeID := c.GetInt("store_id")
 	
 	rows, err := db.Query(`
-		SELECT s.id, s.sale_number, s.customer_name, s.customer_contact, s.total_amount, 
+		SELECT s.id, s.sale_number, COALESCE(s.store_id, 0), s.customer_name, s.customer_contact, s.total_amount, 
 		       s.discount_amount, s.tax_amount, s.final_amount, s.payment_method, 
 		       s.payment_status, s.sold_by, s.sale_date, s.notes,
 		       u.username as sold_by_name
 		FROM sales s
 		LEFT JOIN users u ON s.sold_by = u.id
-		ORDER BY s.sale_date DESC`)
+		WHERE ? = 0 OR s.store_id = ?
+		ORDER BY s.sale_date DESC`, storeID, storeID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -139,6 +186,7 @@ func GetSales(c *gin.Context) {
 		var sale struct {
 			ID             int       `json:"id"`
 			SaleNumber     string    `json:"sale_number"`
+			StoreID        int       `json:"store_id"`
 			CustomerName   string    `json:"customer_name"`
 			CustomerContact string   `json:"customer_contact"`
 			TotalAmount    float64   `json:"total_amount"`
@@ -154,7 +202,7 @@ func GetSales(c *gin.Context) {
 		}
 		
 		if err := rows.Scan(
-			&sale.ID, &sale.SaleNumber, &sale.CustomerName, &sale.CustomerContact,
+			&sale.ID, &sale.SaleNumber, &sale.StoreID, &sale.CustomerName, &sale.CustomerContact,
 			&sale.TotalAmount, &sale.DiscountAmount, &sale.TaxAmount, &sale.FinalAmount,
 			&sale.PaymentMethod, &sale.PaymentStatus, &sale.SoldBy, &sale.SaleDate, &sale.Notes,
 			&sale.SoldByName,
@@ -166,6 +214,7 @@ func GetSales(c *gin.Context) {
 		sales = append(sales, map[string]interface{}{
 			"id":              sale.ID,
 			"sale_number":     sale.SaleNumber,
+			"store_id":        sale.StoreID,
 			"customer_name":   sale.CustomerName,
 			"customer_contact": sale.CustomerContact,
 			"total_amount":    sale.TotalAmount,
@@ -193,6 +242,7 @@ func GetSaleDetails(c *gin.Context) {
 	var sale struct {
 		ID             int       `json:"id"`
 		SaleNumber     string    `json:"sale_number"`
+		StoreID        int       `json:"store_id"`
 		CustomerName   string    `json:"customer_name"`
 		CustomerContact string   `json:"customer_contact"`
 		TotalAmount    float64   `json:"total_amount"`
@@ -207,15 +257,16 @@ func GetSaleDetails(c *gin.Context) {
 		SoldByName     string    `json:"sold_by_name"`
 	}
 	
+	storeID := c.GetInt("store_id")
 	err := db.QueryRow(`
-		SELECT s.id, s.sale_number, s.customer_name, s.customer_contact, s.total_amount, 
+		SELECT s.id, s.sale_number, COALESCE(s.store_id, 0), s.customer_name, s.customer_contact, s.total_amount, 
 		       s.discount_amount, s.tax_amount, s.final_amount, s.payment_method, 
 		       s.payment_status, s.sold_by, s.sale_date, s.notes,
 		       u.username as sold_by_name
 		FROM sales s
 		LEFT JOIN users u ON s.sold_by = u.id
-		WHERE s.id = ?`, saleID).Scan(
-		&sale.ID, &sale.SaleNumber, &sale.CustomerName, &sale.CustomerContact,
+		WHERE s.id = ? AND (? = 0 OR s.store_id = ?)`, saleID, storeID, storeID).Scan(
+		&sale.ID, &sale.SaleNumber, &sale.StoreID, &sale.CustomerName, &sale.CustomerContact,
 		&sale.TotalAmount, &sale.DiscountAmount, &sale.TaxAmount, &sale.FinalAmount,
 		&sale.PaymentMethod, &sale.PaymentStatus, &sale.SoldBy, &sale.SaleDate, &sale.Notes,
 		&sale.SoldByName,
@@ -286,4 +337,12 @@ func GetSaleDetails(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, response)
-}
\ No newline at end of file
+}
+
+// nullIfZero maps an unset optional ID to SQL NULL
+func nullIfZero(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
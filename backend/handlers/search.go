@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"stock-management/database"
+	"stock-management/models"
+	"stock-management/search"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+type productSearchResult struct {
+	models.ProductWithVariants
+	Score float64 `json:"score"`
+}
+
+// SearchProducts answers GET /products/search?q=...&limit=... from the
+// in-memory catalogue index. Matching tolerates typos and partial words in
+// item names, models, brands and descriptions; when the query names a size,
+// colour or SKU only the variants it matched are returned.
+func SearchProducts(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, models.FieldError{Field: "q", Message: "q is required"})
+		return
+	}
+
+	limit, err := queryInt(c, "limit")
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, models.FieldError{Field: "limit", Message: "must be a non-negative integer"})
+		return
+	}
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	hits := search.Catalogue().Search(query, limit)
+	ids := make([]int, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ProductID
+	}
+
+	db := database.GetDB()
+	products, err := models.GetProductsByIDs(db, ids, c.GetInt("store_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	byID := make(map[int]models.ProductWithVariants, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+
+	results := []productSearchResult{}
+	for _, hit := range hits {
+		product, ok := byID[hit.ProductID]
+		if !ok {
+			// Deactivated since it was indexed
+			continue
+		}
+		if hit.VariantIDs != nil {
+			matched := map[int]bool{}
+			for _, id := range hit.VariantIDs {
+				matched[id] = true
+			}
+			variants := []models.ProductVariant{}
+			for _, variant := range product.Variants {
+				if matched[variant.ID] {
+					variants = append(variants, variant)
+				}
+			}
+			product.Variants = variants
+		}
+		results = append(results, productSearchResult{ProductWithVariants: product, Score: hit.Score})
+	}
+
+	c.JSON(http.StatusOK, results)
+}
@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"errors"
+	"io"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"stock-management/config"
 	"stock-management/database"
+	"stock-management/middleware"
 	"stock-management/models"
+	"stock-management/storage"
+	"stock-management/utils"
 	"strconv"
 	"time"
 
@@ -15,7 +19,7 @@ import (
 
 func GetStockEntries(c *gin.Context) {
 	db := database.GetDB()
-	entries, err := models.GetAllStockEntries(db)
+	entries, err := models.GetAllStockEntries(db, c.GetInt("store_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -31,8 +35,14 @@ func CreateStockEntry(c *gin.Context) {
 		return
 	}
 
+	storeID, ok := writeStoreID(c)
+	if !ok {
+		return
+	}
+
 	userID := c.GetInt("user_id")
 	entry.AddedBy = userID
+	entry.StoreID = storeID
 
 	db := database.GetDB()
 	if err := models.CreateStockEntry(db, &entry); err != nil {
@@ -40,9 +50,15 @@ func CreateStockEntry(c *gin.Context) {
 		return
 	}
 
+	middleware.RecordAudit(c, "create", "stock_entries", entry.ID, nil, entry)
+
 	c.JSON(http.StatusCreated, entry)
 }
 
+// UploadImage accepts a JPEG, PNG or WebP upload, checked by content rather
+// than extension, and stores it re-encoded at each of utils.ImageSizes with
+// its metadata stripped. imageUrl is the full-size rendition; urls lists
+// every size.
 func UploadImage(c *gin.Context) {
 	file, err := c.FormFile("image")
 	if err != nil {
@@ -56,26 +72,49 @@ func UploadImage(c *gin.Context) {
 		return
 	}
 
-	// Create uploads directory if not exists
-	uploadDir := "./uploads"
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create upload directory"})
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read image"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(src, config.GetMaxFileSize()+1))
+	src.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read image"})
 		return
 	}
 
-	// Generate unique filename
-	ext := filepath.Ext(file.Filename)
-	filename := strconv.FormatInt(int64(file.Size), 10) + "_" + strconv.FormatInt(makeTimestamp(), 10) + ext
-	filepath := filepath.Join(uploadDir, filename)
-
-	// Save file
-	if err := c.SaveUploadedFile(file, filepath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save image"})
+	renditions, err := utils.ProcessImage(data)
+	if err != nil {
+		if errors.Is(err, utils.ErrUnsupportedImage) || errors.Is(err, utils.ErrImageTooLarge) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			log.Printf("❌ Image processing failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not process image"})
+		}
 		return
 	}
 
-	imageURL := "/uploads/" + filename
-	c.JSON(http.StatusOK, gin.H{"imageUrl": imageURL})
+	// Renditions of one upload share a unique base name
+	files := storage.Files()
+	base := strconv.FormatInt(file.Size, 10) + "_" + strconv.FormatInt(makeTimestamp(), 10)
+	urls := gin.H{}
+	var saved []string
+	for _, rendition := range renditions {
+		key := base + "_" + rendition.Size + rendition.Extension
+		if err := files.Put(key, rendition.Data, rendition.ContentType); err != nil {
+			log.Printf("❌ Could not store %s: %v", key, err)
+			for _, done := range saved {
+				files.Delete(done)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save image"})
+			return
+		}
+		saved = append(saved, key)
+		urls[rendition.Size] = files.URL(key)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"imageUrl": urls["full"], "urls": urls})
 }
 
 func makeTimestamp() int64 {
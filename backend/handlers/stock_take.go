@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetStockTakes(c *gin.Context) {
+	db := database.GetDB()
+	takes, err := models.GetStockTakes(db, c.GetInt("store_id"), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if takes == nil {
+		takes = []models.StockTake{}
+	}
+	c.JSON(http.StatusOK, takes)
+}
+
+func GetStockTake(c *gin.Context) {
+	take, ok := loadStockTake(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, take)
+}
+
+// CreateStockTake opens a counting session for the caller's store, optionally
+// limited to one category and/or brand
+func CreateStockTake(c *gin.Context) {
+	var req struct {
+		CategoryID *int   `json:"category_id"`
+		BrandID    *int   `json:"brand_id"`
+		Notes      string `json:"notes"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+	}
+
+	storeID, ok := writeStoreID(c)
+	if !ok {
+		return
+	}
+
+	take := models.StockTake{
+		StoreID:    storeID,
+		CategoryID: req.CategoryID,
+		BrandID:    req.BrandID,
+		Notes:      req.Notes,
+		CreatedBy:  c.GetInt("user_id"),
+	}
+
+	db := database.GetDB()
+	if err := models.CreateStockTake(db, &take); err != nil {
+		log.Printf("❌ Stock take creation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start stock take: " + err.Error()})
+		return
+	}
+
+	created, err := models.GetStockTakeByID(db, take.ID)
+	if err != nil {
+		created = &take
+	}
+
+	middleware.RecordAudit(c, "create", "stock_takes", take.ID, nil, created)
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetStockTakeVariances lists expected vs counted quantities. Pass
+// differences=true to only see counted lines that do not match.
+func GetStockTakeVariances(c *gin.Context) {
+	take, ok := loadStockTake(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	lines, err := models.GetStockTakeLines(db, take.ID, c.Query("differences") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if lines == nil {
+		lines = []models.StockTakeLine{}
+	}
+
+	var totalVariance int
+	var totalValue float64
+	for _, line := range lines {
+		totalVariance += line.Variance
+		totalValue += line.VarianceValue
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stock_take":     take,
+		"lines":          lines,
+		"total_variance": totalVariance,
+		"variance_value": totalValue,
+	})
+}
+
+// RecordStockTakeCounts takes a batch of scans from one device. By default
+// each scan adds to the running count; mode "set" overwrites it instead.
+func RecordStockTakeCounts(c *gin.Context) {
+	take, ok := loadStockTake(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		DeviceID string                 `json:"device_id"`
+		Mode     string                 `json:"mode"`
+		Items    []models.StockTakeScan `json:"items" binding:"required"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if req.Mode != "" && req.Mode != "add" && req.Mode != "set" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be add or set"})
+		return
+	}
+	for _, item := range req.Items {
+		if (item.ProductVariantID <= 0 && item.Code == "") || item.Quantity < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Each item needs a code or product_variant_id and a non-negative quantity"})
+			return
+		}
+	}
+
+	if !canAccessStore(c, take.StoreID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No access to this store"})
+		return
+	}
+
+	db := database.GetDB()
+	unmatched, err := models.RecordStockTakeScans(db, take.ID, c.GetInt("user_id"), req.DeviceID, req.Items, req.Mode == "set")
+	if err != nil {
+		respondStockTakeError(c, err)
+		return
+	}
+
+	if unmatched == nil {
+		unmatched = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"recorded":  len(req.Items) - len(unmatched),
+		"unmatched": unmatched,
+	})
+}
+
+// ApproveStockTake posts every variance as a stock adjustment. Set
+// zero_uncounted to treat lines nobody scanned as counted at zero.
+func ApproveStockTake(c *gin.Context) {
+	take, ok := loadStockTake(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ZeroUncounted bool `json:"zero_uncounted"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+
+	if !canAccessStore(c, take.StoreID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No access to this store"})
+		return
+	}
+
+	db := database.GetDB()
+	adjusted, err := models.ApproveStockTake(db, take.ID, c.GetInt("user_id"), req.ZeroUncounted)
+	if err != nil {
+		respondStockTakeError(c, err)
+		return
+	}
+
+	updated, err := models.GetStockTakeByID(db, take.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.RecordAudit(c, "approve", "stock_takes", take.ID, take, updated)
+
+	c.JSON(http.StatusOK, gin.H{
+		"stock_take":       updated,
+		"adjustments_made": adjusted,
+	})
+}
+
+func CancelStockTake(c *gin.Context) {
+	take, ok := loadStockTake(c)
+	if !ok {
+		return
+	}
+
+	if !canAccessStore(c, take.StoreID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No access to this store"})
+		return
+	}
+
+	db := database.GetDB()
+	if err := models.CancelStockTake(db, take.ID); err != nil {
+		respondStockTakeError(c, err)
+		return
+	}
+
+	updated, err := models.GetStockTakeByID(db, take.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.RecordAudit(c, "cancel", "stock_takes", take.ID, take, updated)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+func loadStockTake(c *gin.Context) (*models.StockTake, bool) {
+	takeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stock take ID"})
+		return nil, false
+	}
+
+	db := database.GetDB()
+	take, err := models.GetStockTakeByID(db, takeID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Stock take not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+
+	if storeID := c.GetInt("store_id"); storeID != 0 && take.StoreID != storeID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock take not found"})
+		return nil, false
+	}
+
+	return take, true
+}
+
+func respondStockTakeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrStockTakeClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidStockTakeCount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("❌ Stock take error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
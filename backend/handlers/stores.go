@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStores lists every store for admins and the caller's own stores
+// otherwise. Admins see deactivated stores too with ?include_inactive=true.
+func GetStores(c *gin.Context) {
+	db := database.GetDB()
+
+	var stores []models.Store
+	var err error
+	if c.GetString("role") == "admin" {
+		stores, err = models.GetAllStores(db, c.Query("include_inactive") == "true")
+	} else {
+		stores, err = models.GetStoresForUser(db, c.GetInt("user_id"))
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if stores == nil {
+		stores = []models.Store{}
+	}
+	c.JSON(http.StatusOK, stores)
+}
+
+func CreateStore(c *gin.Context) {
+	var req struct {
+		Code    string `json:"code" binding:"required"`
+		Name    string `json:"name" binding:"required"`
+		Address string `json:"address"`
+		Phone   string `json:"phone"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	store := models.Store{Code: req.Code, Name: req.Name, Address: req.Address, Phone: req.Phone}
+
+	db := database.GetDB()
+	if err := models.CreateStore(db, &store); err != nil {
+		log.Printf("❌ Store creation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create store: " + err.Error()})
+		return
+	}
+
+	middleware.RecordAudit(c, "create", "stores", store.ID, nil, store)
+
+	c.JSON(http.StatusCreated, store)
+}
+
+// GetStore returns one store, active or not, for admins
+func GetStore(c *gin.Context) {
+	storeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		return
+	}
+
+	store, err := models.GetStoreByIDAnyStatus(database.GetDB(), storeID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, store)
+}
+
+func UpdateStore(c *gin.Context) {
+	storeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		return
+	}
+
+	var req struct {
+		Code     *string `json:"code"`
+		Name     *string `json:"name"`
+		Address  *string `json:"address"`
+		Phone    *string `json:"phone"`
+		IsActive *bool   `json:"is_active"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	db := database.GetDB()
+	// Deactivated stores can be edited and reactivated here
+	existing, err := models.GetStoreByIDAnyStatus(db, storeID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		return
+	}
+
+	updated := *existing
+	if req.Code != nil {
+		updated.Code = *req.Code
+	}
+	if req.Name != nil {
+		updated.Name = *req.Name
+	}
+	if req.Address != nil {
+		updated.Address = *req.Address
+	}
+	if req.Phone != nil {
+		updated.Phone = *req.Phone
+	}
+	if req.IsActive != nil {
+		updated.IsActive = *req.IsActive
+	}
+
+	if err := models.UpdateStore(db, &updated); err != nil {
+		log.Printf("❌ Store update error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update store: " + err.Error()})
+		return
+	}
+
+	middleware.RecordAudit(c, "update", "stores", storeID, existing, updated)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+func GetUserStores(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	db := database.GetDB()
+	stores, err := models.GetStoresForUser(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if stores == nil {
+		stores = []models.Store{}
+	}
+	c.JSON(http.StatusOK, stores)
+}
+
+// UpdateUserStores replaces the stores a user is assigned to
+func UpdateUserStores(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		StoreIDs       []int `json:"store_ids" binding:"required"`
+		DefaultStoreID int   `json:"default_store_id"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	db := database.GetDB()
+	if _, err := models.GetUserByID(db, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if status, msg := validateStoreAssignment(db, req.StoreIDs, req.DefaultStoreID); status != 0 {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	previousStores, _ := models.GetStoresForUser(db, userID)
+
+	if err := models.SetUserStores(db, userID, req.StoreIDs, req.DefaultStoreID); err != nil {
+		log.Printf("❌ User store assignment error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update user stores"})
+		return
+	}
+
+	stores, _ := models.GetStoresForUser(db, userID)
+	middleware.RecordAudit(c, "assign_stores", "users", userID, previousStores, stores)
+
+	c.JSON(http.StatusOK, stores)
+}
+
+// GetVariantStock shows how much of a variant each store holds
+func GetVariantStock(c *gin.Context) {
+	variantID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	db := database.GetDB()
+	stock, err := models.GetVariantStoreStock(db, variantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Non-admins only see the stores they are assigned to
+	if c.GetString("role") != "admin" {
+		var visible []models.VariantStoreStock
+		for _, item := range stock {
+			if ok, _ := models.UserHasStore(db, c.GetInt("user_id"), item.StoreID); ok {
+				visible = append(visible, item)
+			}
+		}
+		stock = visible
+	}
+
+	if stock == nil {
+		stock = []models.VariantStoreStock{}
+	}
+	c.JSON(http.StatusOK, stock)
+}
+
+// validateStoreAssignment returns a non-zero HTTP status and message when the
+// store list is empty, references unknown stores or omits the default store
+func validateStoreAssignment(db *sql.DB, storeIDs []int, defaultStoreID int) (int, string) {
+	if len(storeIDs) == 0 {
+		return http.StatusBadRequest, "At least one store is required"
+	}
+
+	hasDefault := defaultStoreID == 0
+	for _, storeID := range storeIDs {
+		if _, err := models.GetStoreByID(db, storeID); err != nil {
+			return http.StatusBadRequest, "Store " + strconv.Itoa(storeID) + " does not exist"
+		}
+		if storeID == defaultStoreID {
+			hasDefault = true
+		}
+	}
+	if !hasDefault {
+		return http.StatusBadRequest, "Default store must be one of the assigned stores"
+	}
+	return 0, ""
+}
+
+// writeStoreID returns the store that stock-changing writes apply to. Admins
+// viewing consolidated data write to their default store. It responds with
+// an error and returns false when no store can be determined.
+func writeStoreID(c *gin.Context) (int, bool) {
+	if storeID := c.GetInt("store_id"); storeID > 0 {
+		return storeID, true
+	}
+
+	storeID, err := models.GetDefaultStoreID(database.GetDB(), c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not resolve store"})
+		return 0, false
+	}
+	if storeID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Select a store with the X-Store-ID header"})
+		return 0, false
+	}
+	return storeID, true
+}
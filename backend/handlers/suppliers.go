@@ -3,7 +3,10 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"stock-management/config"
 	"stock-management/database"
+	"stock-management/middleware"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,7 +15,7 @@ func GetSuppliers(c *gin.Context) {
 	db := database.GetDB()
 	
 	rows, err := db.Query(`
-		SELECT id, name, contact_person, email, phone, address, gst_number, is_active, created_at 
+		SELECT id, name, contact_person, email, phone, address, gst_number, lead_time_days, is_active, created_at 
 		FROM suppliers 
 		WHERE is_active = true 
 		ORDER BY name`)
@@ -32,13 +35,14 @@ func GetSuppliers(c *gin.Context) {
 			Phone        string `json:"phone"`
 			Address      string `json:"address"`
 			GSTNumber    string `json:"gst_number"`
+			LeadTimeDays int    `json:"lead_time_days"`
 			IsActive     bool   `json:"is_active"`
 			CreatedAt    string `json:"created_at"`
 		}
 		
 		if err := rows.Scan(
 			&supplier.ID, &supplier.Name, &supplier.ContactPerson, &supplier.Email,
-			&supplier.Phone, &supplier.Address, &supplier.GSTNumber, &supplier.IsActive,
+			&supplier.Phone, &supplier.Address, &supplier.GSTNumber, &supplier.LeadTimeDays, &supplier.IsActive,
 			&supplier.CreatedAt,
 		); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -53,6 +57,7 @@ func GetSuppliers(c *gin.Context) {
 			"phone":         supplier.Phone,
 			"address":       supplier.Address,
 			"gst_number":    supplier.GSTNumber,
+			"lead_time_days": supplier.LeadTimeDays,
 			"is_active":     supplier.IsActive,
 			"created_at":    supplier.CreatedAt,
 		})
@@ -69,6 +74,7 @@ func CreateSupplier(c *gin.Context) {
 		Phone        string `json:"phone"`
 		Address      string `json:"address"`
 		GSTNumber    string `json:"gst_number"`
+		LeadTimeDays *int   `json:"lead_time_days"`
 	}
 	
 	if err := c.BindJSON(&supplier); err != nil {
@@ -76,13 +82,22 @@ func CreateSupplier(c *gin.Context) {
 		return
 	}
 
+	leadTimeDays := config.GetDefaultLeadTimeDays()
+	if supplier.LeadTimeDays != nil {
+		if *supplier.LeadTimeDays < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "lead_time_days cannot be negative"})
+			return
+		}
+		leadTimeDays = *supplier.LeadTimeDays
+	}
+
 	db := database.GetDB()
 	
 	result, err := db.Exec(`
-		INSERT INTO suppliers (name, contact_person, email, phone, address, gst_number) 
-		VALUES (?, ?, ?, ?, ?, ?)`,
+		INSERT INTO suppliers (name, contact_person, email, phone, address, gst_number, lead_time_days) 
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		supplier.Name, supplier.ContactPerson, supplier.Email, supplier.Phone, 
-		supplier.Address, supplier.GSTNumber)
+		supplier.Address, supplier.GSTNumber, leadTimeDays)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -99,16 +114,17 @@ func CreateSupplier(c *gin.Context) {
 		Phone        string `json:"phone"`
 		Address      string `json:"address"`
 		GSTNumber    string `json:"gst_number"`
+		LeadTimeDays int    `json:"lead_time_days"`
 		IsActive     bool   `json:"is_active"`
 		CreatedAt    string `json:"created_at"`
 	}
 	
 	err = db.QueryRow(`
-		SELECT id, name, contact_person, email, phone, address, gst_number, is_active, created_at 
+		SELECT id, name, contact_person, email, phone, address, gst_number, lead_time_days, is_active, created_at 
 		FROM suppliers WHERE id = ?`, id).Scan(
 		&createdSupplier.ID, &createdSupplier.Name, &createdSupplier.ContactPerson,
 		&createdSupplier.Email, &createdSupplier.Phone, &createdSupplier.Address,
-		&createdSupplier.GSTNumber, &createdSupplier.IsActive, &createdSupplier.CreatedAt,
+		&createdSupplier.GSTNumber, &createdSupplier.LeadTimeDays, &createdSupplier.IsActive, &createdSupplier.CreatedAt,
 	)
 	
 	if err != nil {
@@ -116,6 +132,8 @@ func CreateSupplier(c *gin.Context) {
 		return
 	}
 
+	middleware.RecordAudit(c, "create", "suppliers", createdSupplier.ID, nil, createdSupplier)
+
 	c.JSON(http.StatusCreated, createdSupplier)
 }
 
@@ -132,16 +150,17 @@ func GetSupplier(c *gin.Context) {
 		Phone        string `json:"phone"`
 		Address      string `json:"address"`
 		GSTNumber    string `json:"gst_number"`
+		LeadTimeDays int    `json:"lead_time_days"`
 		IsActive     bool   `json:"is_active"`
 		CreatedAt    string `json:"created_at"`
 	}
 	
 	err := db.QueryRow(`
-		SELECT id, name, contact_person, email, phone, address, gst_number, is_active, created_at 
+		SELECT id, name, contact_person, email, phone, address, gst_number, lead_time_days, is_active, created_at 
 		FROM suppliers 
 		WHERE id = ? AND is_active = true`, supplierID).Scan(
 		&supplier.ID, &supplier.Name, &supplier.ContactPerson, &supplier.Email,
-		&supplier.Phone, &supplier.Address, &supplier.GSTNumber, &supplier.IsActive,
+		&supplier.Phone, &supplier.Address, &supplier.GSTNumber, &supplier.LeadTimeDays, &supplier.IsActive,
 		&supplier.CreatedAt,
 	)
 	
@@ -155,4 +174,64 @@ func GetSupplier(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, supplier)
-}
\ No newline at end of file
+}
+
+// UpdateSupplier replaces a supplier's details; lead_time_days is kept
+// when omitted
+func UpdateSupplier(c *gin.Context) {
+	supplierID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+		return
+	}
+
+	var req struct {
+		Name          string `json:"name" binding:"required"`
+		ContactPerson string `json:"contact_person"`
+		Email         string `json:"email"`
+		Phone         string `json:"phone"`
+		Address       string `json:"address"`
+		GSTNumber     string `json:"gst_number"`
+		LeadTimeDays  *int   `json:"lead_time_days"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if req.LeadTimeDays != nil && *req.LeadTimeDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lead_time_days cannot be negative"})
+		return
+	}
+
+	db := database.GetDB()
+	var previous struct {
+		Name         string `json:"name"`
+		LeadTimeDays int    `json:"lead_time_days"`
+	}
+	err = db.QueryRow(`SELECT name, lead_time_days FROM suppliers WHERE id = ? AND is_active = true`, supplierID).
+		Scan(&previous.Name, &previous.LeadTimeDays)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	leadTimeDays := previous.LeadTimeDays
+	if req.LeadTimeDays != nil {
+		leadTimeDays = *req.LeadTimeDays
+	}
+	if _, err := db.Exec(`
+		UPDATE suppliers SET name = ?, contact_person = ?, email = ?, phone = ?, address = ?, gst_number = ?, lead_time_days = ?
+		WHERE id = ?`,
+		req.Name, req.ContactPerson, req.Email, req.Phone, req.Address, req.GSTNumber, leadTimeDays, supplierID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.RecordAudit(c, "update", "suppliers", supplierID, previous, req)
+
+	GetSupplier(c)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"stock-management/search"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Shared handling for categories, subcategories and brands
+
+// taxonomyUpdate is the body of PUT /categories/:id, /subcategories/:id and
+// /brands/:id. Setting is_active to false deactivates the row, moving its
+// active products to reassign_to when given.
+type taxonomyUpdate struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	CategoryID  int    `json:"category_id"`
+	IsActive    *bool  `json:"is_active"`
+	ReassignTo  *int   `json:"reassign_to"`
+}
+
+func GetCategoryTree(c *gin.Context) {
+	db := database.GetDB()
+	tree, err := models.GetCategoryTree(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if tree == nil {
+		tree = []models.CategoryNode{}
+	}
+	c.JSON(http.StatusOK, tree)
+}
+
+// checkTaxonomyName rejects blank names and names already in use, writing
+// the response. It returns false when the request must stop.
+func checkTaxonomyName(c *gin.Context, kind models.TaxonomyKind, name string, parentID, excludeID int) bool {
+	if strings.TrimSpace(name) == "" {
+		c.JSON(http.StatusBadRequest, models.FieldError{Field: "name", Message: "name is required"})
+		return false
+	}
+
+	taken, err := models.TaxonomyNameTaken(database.GetDB(), kind, name, parentID, excludeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if taken {
+		c.JSON(http.StatusConflict, models.FieldError{Field: "name", Message: models.ErrDuplicateName.Error() + ": " + name})
+		return false
+	}
+	return true
+}
+
+// updateTaxonomy runs rename and the is_active change of an update body in
+// one transaction, so a rejected deactivation leaves the name unchanged. It
+// returns the number of products reassigned and false if it wrote an error
+// response.
+func updateTaxonomy(c *gin.Context, kind models.TaxonomyKind, id int, req taxonomyUpdate, rename func(*sql.Tx) error) (int, bool) {
+	tx, err := database.GetDB().Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start transaction"})
+		return 0, false
+	}
+
+	moved := 0
+	err = rename(tx)
+	if err == nil && req.IsActive != nil {
+		if *req.IsActive {
+			err = models.ActivateTaxonomyTx(tx, kind, id)
+		} else {
+			moved, err = models.DeactivateTaxonomyTx(tx, kind, id, req.ReassignTo)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		respondTaxonomyError(c, err)
+		return 0, false
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed: " + err.Error()})
+		return 0, false
+	}
+	return moved, true
+}
+
+// deactivateTaxonomy backs DELETE on categories, subcategories and brands.
+// Rows are only deactivated; ?reassign_to=<id> moves active products first.
+func deactivateTaxonomy(c *gin.Context, kind models.TaxonomyKind) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var reassignTo *int
+	if value := c.Query("reassign_to"); value != "" {
+		target, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.FieldError{Field: "reassign_to", Message: "must be an ID"})
+			return
+		}
+		reassignTo = &target
+	}
+
+	db := database.GetDB()
+	moved, err := models.DeactivateTaxonomy(db, kind, id, reassignTo)
+	if err != nil {
+		respondTaxonomyError(c, err)
+		return
+	}
+
+	if kind == models.KindBrand && moved > 0 {
+		search.RefreshAll()
+	}
+
+	middleware.RecordAudit(c, "deactivate", string(kind), id, nil, gin.H{"reassign_to": reassignTo, "products_reassigned": moved})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Deactivated successfully",
+		"products_reassigned": moved,
+	})
+}
+
+// reorderTaxonomy stores the display order from {"ids": [...]}
+func reorderTaxonomy(c *gin.Context, kind models.TaxonomyKind) {
+	var req struct {
+		IDs []int `json:"ids" binding:"required"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	if err := models.ReorderTaxonomy(db, kind, req.IDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.RecordAudit(c, "reorder", string(kind), 0, nil, req.IDs)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order saved"})
+}
+
+func respondTaxonomyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrTaxonomyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	case errors.Is(err, models.ErrTaxonomyInUse), errors.Is(err, models.ErrParentInactive):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrDuplicateName):
+		c.JSON(http.StatusConflict, models.FieldError{Field: "name", Message: err.Error()})
+	case errors.Is(err, models.ErrInvalidReassign):
+		c.JSON(http.StatusBadRequest, models.FieldError{Field: "reassign_to", Message: err.Error()})
+	default:
+		log.Printf("❌ Taxonomy update error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetStockTransfers(c *gin.Context) {
+	db := database.GetDB()
+	transfers, err := models.GetStockTransfers(db, c.GetInt("store_id"), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if transfers == nil {
+		transfers = []models.StockTransfer{}
+	}
+	c.JSON(http.StatusOK, transfers)
+}
+
+func GetStockTransfer(c *gin.Context) {
+	transfer, ok := loadTransfer(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// CreateStockTransfer raises a transfer request; no stock moves until dispatch
+func CreateStockTransfer(c *gin.Context) {
+	var req struct {
+		SourceStoreID      int    `json:"source_store_id" binding:"required"`
+		DestinationStoreID int    `json:"destination_store_id" binding:"required"`
+		Notes              string `json:"notes"`
+		Items              []struct {
+			ProductVariantID int `json:"product_variant_id"`
+			Quantity         int `json:"quantity"`
+		} `json:"items" binding:"required"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if req.SourceStoreID == req.DestinationStoreID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source and destination stores must differ"})
+		return
+	}
+	if len(req.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A transfer needs at least one item"})
+		return
+	}
+
+	db := database.GetDB()
+	for _, storeID := range []int{req.SourceStoreID, req.DestinationStoreID} {
+		if _, err := models.GetStoreByID(db, storeID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Store " + strconv.Itoa(storeID) + " does not exist"})
+			return
+		}
+	}
+
+	if !canAccessStore(c, req.SourceStoreID) && !canAccessStore(c, req.DestinationStoreID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No access to either store"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	transfer := models.StockTransfer{
+		SourceStoreID:      req.SourceStoreID,
+		DestinationStoreID: req.DestinationStoreID,
+		Notes:              req.Notes,
+		RequestedBy:        &userID,
+	}
+	for _, item := range req.Items {
+		if item.ProductVariantID <= 0 || item.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Each item needs a product_variant_id and a positive quantity"})
+			return
+		}
+		transfer.Items = append(transfer.Items, models.StockTransferItem{
+			ProductVariantID:  item.ProductVariantID,
+			QuantityRequested: item.Quantity,
+		})
+	}
+
+	if err := models.CreateStockTransfer(db, &transfer); err != nil {
+		log.Printf("❌ Stock transfer creation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create transfer: " + err.Error()})
+		return
+	}
+
+	created, err := models.GetStockTransferByID(db, transfer.ID)
+	if err != nil {
+		c.JSON(http.StatusCreated, transfer)
+		return
+	}
+
+	middleware.RecordAudit(c, "create", "stock_transfers", transfer.ID, nil, created)
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// DispatchStockTransfer ships the transfer, taking stock out of the source store
+func DispatchStockTransfer(c *gin.Context) {
+	transfer, ok := loadTransfer(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Items []models.TransferQuantity `json:"items"`
+	}
+	// An empty body dispatches everything as requested
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+
+	if !canAccessStore(c, transfer.SourceStoreID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the source store can dispatch this transfer"})
+		return
+	}
+
+	db := database.GetDB()
+	if err := models.DispatchStockTransfer(db, transfer.ID, c.GetInt("user_id"), req.Items); err != nil {
+		respondTransferError(c, err)
+		return
+	}
+
+	respondWithTransfer(c, "dispatch", transfer)
+}
+
+// ReceiveStockTransfer books received quantities into the destination store.
+// Set complete to close the transfer with a shortfall.
+func ReceiveStockTransfer(c *gin.Context) {
+	transfer, ok := loadTransfer(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Items    []models.TransferQuantity `json:"items"`
+		Complete bool                      `json:"complete"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !canAccessStore(c, transfer.DestinationStoreID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the destination store can receive this transfer"})
+		return
+	}
+
+	db := database.GetDB()
+	if err := models.ReceiveStockTransfer(db, transfer.ID, c.GetInt("user_id"), req.Items, req.Complete); err != nil {
+		respondTransferError(c, err)
+		return
+	}
+
+	respondWithTransfer(c, "receive", transfer)
+}
+
+func CancelStockTransfer(c *gin.Context) {
+	transfer, ok := loadTransfer(c)
+	if !ok {
+		return
+	}
+
+	if !canAccessStore(c, transfer.SourceStoreID) && !canAccessStore(c, transfer.DestinationStoreID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No access to this transfer"})
+		return
+	}
+
+	db := database.GetDB()
+	if err := models.CancelStockTransfer(db, transfer.ID); err != nil {
+		respondTransferError(c, err)
+		return
+	}
+
+	respondWithTransfer(c, "cancel", transfer)
+}
+
+// GetInTransitStock lists quantities dispatched to the selected store (or all
+// stores) that have not arrived yet
+func GetInTransitStock(c *gin.Context) {
+	db := database.GetDB()
+	stock, err := models.GetInTransitStock(db, c.GetInt("store_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if stock == nil {
+		stock = []models.InTransitStock{}
+	}
+	c.JSON(http.StatusOK, stock)
+}
+
+// loadTransfer fetches the transfer named in the URL, hiding transfers that do
+// not touch the caller's selected store
+func loadTransfer(c *gin.Context) (*models.StockTransfer, bool) {
+	transferID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID"})
+		return nil, false
+	}
+
+	db := database.GetDB()
+	transfer, err := models.GetStockTransferByID(db, transferID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+
+	storeID := c.GetInt("store_id")
+	if storeID != 0 && transfer.SourceStoreID != storeID && transfer.DestinationStoreID != storeID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+		return nil, false
+	}
+
+	return transfer, true
+}
+
+func respondWithTransfer(c *gin.Context, action string, previous *models.StockTransfer) {
+	updated, err := models.GetStockTransferByID(database.GetDB(), previous.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.RecordAudit(c, action, "stock_transfers", previous.ID, previous, updated)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+func respondTransferError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrTransferState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidTransferItem), errors.Is(err, models.ErrInsufficientStock):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("❌ Stock transfer error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// canAccessStore reports whether the caller may act for storeID. Admins may
+// act for every store.
+func canAccessStore(c *gin.Context, storeID int) bool {
+	if c.GetString("role") == "admin" {
+		return true
+	}
+	ok, err := models.UserHasStore(database.GetDB(), c.GetInt("user_id"), storeID)
+	if err != nil {
+		log.Printf("❌ Store access check error: %v", err)
+		return false
+	}
+	return ok
+}
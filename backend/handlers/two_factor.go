@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"stock-management/config"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"stock-management/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	mfaTokenTTL       = 5 * time.Minute
+	mfaSetupTokenTTL  = 15 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// VerifyTwoFactorLogin completes a login started with POST /login by checking
+// a TOTP code or a recovery code against the short-lived mfa_token
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var req struct {
+		MFAToken     string `json:"mfa_token" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	claims, err := utils.ValidateJWT(req.MFAToken)
+	if err != nil || claims.Purpose != utils.TokenPurposeMFA {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired two-factor session"})
+		return
+	}
+
+	db := database.GetDB()
+	user, err := models.GetUserByID(db, claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired two-factor session"})
+		return
+	}
+
+	// Each user gets a limited number of codes across tokens, and each
+	// token a few attempts and a single successful login
+	allowed, err := models.ReserveMFAUserAttempt(db, user.ID)
+	if err != nil {
+		log.Printf("❌ Two-factor attempt tracking error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !allowed {
+		lockedUntil, err := models.MFALockedUntil(db, user.ID)
+		if err != nil {
+			log.Printf("❌ Two-factor lockout lookup error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		respondMFALocked(c, user.Username, lockedUntil)
+		return
+	}
+
+	tokenHash := utils.HashToken(req.MFAToken)
+	allowed, err = models.ReserveMFAAttempt(db, tokenHash, user.ID, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		log.Printf("❌ Two-factor attempt tracking error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !allowed {
+		log.Printf("❌ Two-factor session used up for user: %s", user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Too many attempts or session already used; log in again"})
+		return
+	}
+
+	ok, usedRecovery, err := verifySecondFactor(db, user.ID, req.Code, req.RecoveryCode)
+	if err != nil {
+		log.Printf("❌ Two-factor verification error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !ok {
+		log.Printf("❌ Invalid two-factor code for user: %s", user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	if fresh, err := models.CompleteMFAChallenge(db, tokenHash); err != nil || !fresh {
+		if err != nil {
+			log.Printf("❌ Two-factor session update error: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired two-factor session"})
+		return
+	}
+
+	if err := models.ResetMFAFailures(db, user.ID); err != nil {
+		log.Printf("❌ Two-factor attempt reset error: %v", err)
+	}
+
+	extra := gin.H{}
+	if usedRecovery {
+		remaining, _ := models.CountUnusedRecoveryCodes(db, user.ID)
+		extra["recovery_codes_remaining"] = remaining
+	}
+
+	completeLogin(c, user, extra)
+}
+
+// respondMFALocked turns away a user whose two-factor login is locked after
+// too many wrong codes
+func respondMFALocked(c *gin.Context, username string, lockedUntil time.Time) {
+	log.Printf("❌ Two-factor login locked for user: %s", username)
+	retryAfter := int(time.Until(lockedUntil).Seconds()) + 1
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":        "Too many invalid two-factor codes; try again later",
+		"locked_until": lockedUntil,
+	})
+}
+
+func GetTwoFactorStatus(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	db := database.GetDB()
+
+	totp, err := models.GetUserTOTP(db, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	remaining := 0
+	if totp.Enabled {
+		remaining, _ = models.CountUnusedRecoveryCodes(db, userID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  totp.Enabled,
+		"required":                 config.RoleRequiresTOTP(c.GetString("role")),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTwoFactor starts enrollment by generating a secret and the otpauth://
+// provisioning URI the app renders as a QR code
+func SetupTwoFactor(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	db := database.GetDB()
+
+	user, err := models.GetUserByID(db, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("❌ TOTP secret generation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start enrollment"})
+		return
+	}
+
+	if err := models.SetPendingTOTPSecret(db, userID, secret); err != nil {
+		log.Printf("❌ TOTP secret save error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(config.AppConfig.TOTPIssuer, user.Username, secret),
+	})
+}
+
+// EnableTwoFactor confirms enrollment with a code from the authenticator app
+// and returns the recovery codes, which are shown only once
+func EnableTwoFactor(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	db := database.GetDB()
+
+	totp, err := models.GetUserTOTP(db, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if totp.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if totp.Secret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment with POST /2fa/setup first"})
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(totp.Secret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("❌ Recovery code generation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not enable two-factor authentication"})
+		return
+	}
+
+	if err := models.EnableTOTP(db, userID, step, hashes); err != nil {
+		log.Printf("❌ Enable TOTP error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not enable two-factor authentication"})
+		return
+	}
+
+	middleware.RecordAudit(c, "enable_2fa", "users", userID, gin.H{"totp_enabled": false}, gin.H{"totp_enabled": true})
+	log.Printf("✅ Two-factor authentication enabled for user ID: %d", userID)
+
+	// Users enrolling from a restricted setup token finish their login here
+	if c.GetString("token_purpose") == utils.TokenPurposeMFASetup {
+		user, err := models.GetUserByID(db, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		completeLogin(c, user, gin.H{"recovery_codes": codes})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	var req struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if config.RoleRequiresTOTP(c.GetString("role")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	db := database.GetDB()
+
+	ok, _, err := verifySecondFactor(db, userID, req.Code, req.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	if err := models.DisableTOTP(db, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not disable two-factor authentication"})
+		return
+	}
+
+	middleware.RecordAudit(c, "disable_2fa", "users", userID, gin.H{"totp_enabled": true}, gin.H{"totp_enabled": false})
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes invalidates the old recovery codes and returns a new set
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	db := database.GetDB()
+
+	ok, _, err := verifySecondFactor(db, userID, req.Code, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate recovery codes"})
+		return
+	}
+
+	if err := models.ReplaceRecoveryCodes(db, userID, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save recovery codes"})
+		return
+	}
+
+	middleware.RecordAudit(c, "regenerate_recovery_codes", "users", userID, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// ResetUserTwoFactor lets an admin clear 2FA for a user who lost their device
+func ResetUserTwoFactor(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	db := database.GetDB()
+	if _, err := models.GetUserByID(db, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := models.DisableTOTP(db, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not reset two-factor authentication"})
+		return
+	}
+
+	middleware.RecordAudit(c, "reset_2fa", "users", userID, nil, gin.H{"totp_enabled": false})
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery
+// code. The second return value reports whether a recovery code was consumed.
+func verifySecondFactor(db *sql.DB, userID int, code, recoveryCode string) (bool, bool, error) {
+	totp, err := models.GetUserTOTP(db, userID)
+	if err != nil {
+		return false, false, err
+	}
+	if !totp.Enabled || totp.Secret == "" {
+		return false, false, nil
+	}
+
+	if strings.TrimSpace(code) != "" {
+		step, ok := utils.ValidateTOTP(totp.Secret, code, time.Now())
+		if !ok {
+			return false, false, nil
+		}
+		fresh, err := models.MarkTOTPStepUsed(db, userID, step)
+		return fresh, false, err
+	}
+
+	if strings.TrimSpace(recoveryCode) != "" {
+		ok, err := models.UseRecoveryCode(db, userID, utils.HashRecoveryCode(recoveryCode))
+		return ok, ok, err
+	}
+
+	return false, false, nil
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"stock-management/database"
+	"stock-management/middleware"
 	"stock-management/models"
 	"stock-management/utils"
 	"strconv"
@@ -18,6 +19,8 @@ func Register(c *gin.Context) {
         Email    string `json:"email" binding:"required"`
         Password string `json:"password" binding:"required"`
         Role     string `json:"role" binding:"required"`
+        StoreIDs       []int `json:"store_ids"`
+        DefaultStoreID int   `json:"default_store_id"`
     }
 
     if err := c.BindJSON(&req); err != nil {
@@ -35,6 +38,19 @@ func Register(c *gin.Context) {
         return
     }
 
+    // New users work in the creating admin's store unless told otherwise
+    if len(req.StoreIDs) == 0 {
+        storeID, ok := writeStoreID(c)
+        if !ok {
+            return
+        }
+        req.StoreIDs = []int{storeID}
+    }
+    if status, msg := validateStoreAssignment(db, req.StoreIDs, req.DefaultStoreID); status != 0 {
+        c.JSON(status, gin.H{"error": msg})
+        return
+    }
+
     // Store plain text password (no hashing)
     plainPassword := req.Password
 
@@ -49,6 +65,16 @@ func Register(c *gin.Context) {
 
     userID, _ := result.LastInsertId()
 
+    if err := models.SetUserStores(db, int(userID), req.StoreIDs, req.DefaultStoreID); err != nil {
+        log.Printf("❌ User store assignment error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "User created but stores could not be assigned"})
+        return
+    }
+
+    if createdUser, err := models.GetUserByID(db, int(userID)); err == nil {
+        middleware.RecordAudit(c, "create", "users", int(userID), nil, createdUser)
+    }
+
     c.JSON(http.StatusCreated, gin.H{
         "message": "User created successfully",
         "user_id": userID,
@@ -58,7 +84,7 @@ func Register(c *gin.Context) {
 func GetUsers(c *gin.Context) {
 	db := database.GetDB()
 
-	query := `SELECT id, username, email, role, is_active, last_login, created_at, updated_at 
+	query := `SELECT id, username, email, role, is_active, totp_enabled, last_login, created_at, updated_at 
 	          FROM users WHERE is_active = true ORDER BY created_at DESC`
 	
 	rows, err := db.Query(query)
@@ -80,6 +106,7 @@ func GetUsers(c *gin.Context) {
 			&user.Email,
 			&user.Role,
 			&user.IsActive,
+			&user.TOTPEnabled,
 			&lastLogin,
 			&user.CreatedAt,
 			&user.UpdatedAt,
@@ -121,6 +148,7 @@ func UpdateUser(c *gin.Context) {
 	}
 
 	db := database.GetDB()
+	previousUser, _ := models.GetUserByID(db, userID)
 	
 	// Build update query dynamically based on provided fields
 	query := "UPDATE users SET "
@@ -165,6 +193,9 @@ func UpdateUser(c *gin.Context) {
 		}
 	}
 
+	updatedUser, _ := models.GetUserByID(db, userID)
+	middleware.RecordAudit(c, "update", "users", userID, previousUser, updatedUser)
+
 	log.Printf("✅ User updated successfully: ID %d", userID)
 	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
 }
@@ -226,6 +257,7 @@ func DeleteUser(c *gin.Context) {
 	}
 
 	db := database.GetDB()
+	previousUser, _ := models.GetUserByID(db, userID)
 	
 	// Soft delete by setting is_active to false
 	_, err = db.Exec("UPDATE users SET is_active = false WHERE id = ?", userID)
@@ -234,5 +266,7 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	middleware.RecordAudit(c, "delete", "users", userID, previousUser, nil)
+
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
\ No newline at end of file
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"stock-management/config"
+	"stock-management/database"
+	"stock-management/middleware"
+	"stock-management/models"
+	"stock-management/search"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Largest matrix a single request may generate
+const maxGeneratedVariants = 500
+
+var variantGenders = map[string]bool{
+	"male":   true,
+	"female": true,
+	"kids":   true,
+	"unisex": true,
+}
+
+func GetSizeRuns(c *gin.Context) {
+	categoryID, _ := strconv.Atoi(c.Query("category_id"))
+
+	db := database.GetDB()
+	runs, err := models.GetSizeRuns(db, categoryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if runs == nil {
+		runs = []models.SizeRun{}
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+func CreateSizeRun(c *gin.Context) {
+	var run models.SizeRun
+	if err := c.BindJSON(&run); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	run.Code = strings.TrimSpace(run.Code)
+	run.Sizes = cleanAxis(run.Sizes)
+	if run.Code == "" || run.Name == "" || len(run.Sizes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code, name and sizes are required"})
+		return
+	}
+
+	db := database.GetDB()
+	if _, err := models.GetSizeRunByCode(db, run.Code); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A size run with this code already exists"})
+		return
+	}
+
+	if err := models.CreateSizeRun(db, &run); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	middleware.RecordAudit(c, "create", "size_runs", run.ID, nil, run)
+
+	c.JSON(http.StatusCreated, run)
+}
+
+// GenerateVariantMatrix creates one variant per gender x size x color
+// combination, all with the given base prices. Combinations the product
+// already has are skipped. Sizes can come from a size-run preset; set
+// dry_run to preview the matrix without saving.
+func GenerateVariantMatrix(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req struct {
+		Genders      []string `json:"genders"`
+		Sizes        []string `json:"sizes"`
+		SizeRun      string   `json:"size_run"`
+		Colors       []string `json:"colors"`
+		MRP          float64  `json:"mrp"`
+		SellingPrice float64  `json:"selling_price"`
+		CostPrice    float64  `json:"cost_price"`
+		DryRun       bool     `json:"dry_run"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	product, err := models.GetProductByID(db, productID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	sizes := cleanAxis(req.Sizes)
+	if req.SizeRun != "" {
+		run, err := models.GetSizeRunByCode(db, req.SizeRun)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown size_run: " + req.SizeRun})
+			return
+		}
+		if run.CategoryID != nil && (product.CategoryID == nil || *run.CategoryID != *product.CategoryID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Size run " + run.Code + " is not for this product's category"})
+			return
+		}
+		sizes = cleanAxis(append(run.Sizes, sizes...))
+	}
+	if len(sizes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide sizes or a size_run"})
+		return
+	}
+
+	genders := cleanAxis(req.Genders)
+	if len(genders) == 0 {
+		genders = []string{"unisex"}
+	}
+	for i, gender := range genders {
+		genders[i] = strings.ToLower(gender)
+		if !variantGenders[genders[i]] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gender: " + gender})
+			return
+		}
+	}
+
+	colors := cleanAxis(req.Colors)
+	if len(colors) == 0 {
+		colors = []string{""}
+	}
+
+	if total := len(genders) * len(sizes) * len(colors); total > maxGeneratedVariants {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Matrix of " + strconv.Itoa(total) + " variants is larger than " + strconv.Itoa(maxGeneratedVariants)})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start transaction"})
+		return
+	}
+
+	existing, err := models.GetVariantKeysTx(tx, productID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	created := []models.ProductVariant{}
+	skipped := []gin.H{}
+	planned := map[string]bool{}
+	for _, gender := range genders {
+		for _, size := range sizes {
+			for _, color := range colors {
+				if existing[models.VariantKey(gender, size, color)] {
+					skipped = append(skipped, gin.H{"gender": gender, "size": size, "color": color})
+					continue
+				}
+
+				variant := models.ProductVariant{
+					ProductID:    productID,
+					Gender:       gender,
+					Size:         size,
+					Color:        color,
+					MRP:          req.MRP,
+					SellingPrice: req.SellingPrice,
+					CostPrice:    req.CostPrice,
+					IsActive:     true,
+				}
+				// Dry runs insert nothing, so no ids or barcodes are used up;
+				// SKUs planned earlier in the batch count as taken instead
+				if req.DryRun {
+					if err := models.PlanVariantSKUTx(tx, config.GetSKUTemplate(), &variant, planned); err != nil {
+						tx.Rollback()
+						c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate SKU: " + err.Error()})
+						return
+					}
+					planned[variant.SKU] = true
+					existing[models.VariantKey(gender, size, color)] = true
+					created = append(created, variant)
+					continue
+				}
+
+				if err := applyVariantSKUTx(tx, &variant); err != nil {
+					tx.Rollback()
+					if !respondVariantCodeError(c, err) {
+						c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate SKU: " + err.Error()})
+					}
+					return
+				}
+				if err := models.CreateProductVariantTx(tx, &variant); err != nil {
+					tx.Rollback()
+					if !respondVariantCodeError(c, err) {
+						log.Printf("❌ Variant matrix creation error: %v", err)
+						c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create variant: " + err.Error()})
+					}
+					return
+				}
+				if err := assignVariantBarcodeTx(tx, &variant); err != nil {
+					tx.Rollback()
+					if !respondVariantCodeError(c, err) {
+						c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not assign barcode: " + err.Error()})
+					}
+					return
+				}
+
+				existing[models.VariantKey(gender, size, color)] = true
+				created = append(created, variant)
+			}
+		}
+	}
+
+	if req.DryRun {
+		tx.Rollback()
+		c.JSON(http.StatusOK, gin.H{
+			"dry_run": true,
+			"created": created,
+			"skipped": skipped,
+		})
+		return
+	}
+
+	if len(created) > 0 {
+		if err := models.TouchProductTx(tx, productID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed: " + err.Error()})
+		return
+	}
+
+	log.Printf("✅ Generated %d variants for product %d", len(created), productID)
+	search.RefreshProducts(productID)
+	middleware.RecordAudit(c, "generate_variants", "products", productID, nil, created)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"created": created,
+		"skipped": skipped,
+	})
+}
+
+// cleanAxis trims values and drops blanks and case-insensitive duplicates,
+// keeping the first spelling
+func cleanAxis(values []string) []string {
+	seen := map[string]bool{}
+	var cleaned []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		key := strings.ToLower(value)
+		if value == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		cleaned = append(cleaned, value)
+	}
+	return cleaned
+}
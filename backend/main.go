@@ -2,10 +2,13 @@ package main
 
 import (
 	"log"
+	"stock-management/alerts"
 	"stock-management/config"
 	"stock-management/database"
 	"stock-management/handlers"
 	"stock-management/middleware"
+	"stock-management/search"
+	"stock-management/storage"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,14 +21,36 @@ func main() {
 	database.InitDB()
 	defer database.CloseDB()
 
+	// Build the in-memory product search index
+	if err := search.Init(database.GetDB()); err != nil {
+		log.Printf("❌ Search index build failed: %v", err)
+	}
+
 	// Create Gin router
 	router := gin.Default()
 
 	// Middleware
 	router.Use(middleware.CORSMiddleware())
 
-	// Static files
-	router.Static("/uploads", "./uploads")
+	// Uploaded files; the local driver's are also served unsigned
+	if err := storage.Init(); err != nil {
+		log.Fatalf("❌ File storage setup failed: %v", err)
+	}
+	if interval := config.GetOrphanSweepInterval(); interval > 0 {
+		storage.StartOrphanSweep(database.GetDB(), interval, config.GetOrphanGracePeriod())
+	}
+
+	// Stock alert delivery
+	if err := alerts.Init(database.GetDB()); err != nil {
+		log.Fatalf("❌ Stock alert setup failed: %v", err)
+	}
+	if interval := config.GetAlertSettings().DispatchInterval; interval > 0 {
+		alerts.Default().Start(interval)
+	}
+	if config.GetStorageDriver() == "local" {
+		router.Static("/uploads", config.GetUploadDir())
+	}
+	router.GET("/files/*key", handlers.ServeSignedFile)
 
 	// Health check and root endpoint
 	router.GET("/", func(c *gin.Context) {
@@ -50,14 +75,30 @@ func main() {
 
 	// Public routes
 	router.POST("/login", handlers.Login)
+	router.POST("/login/2fa", handlers.VerifyTwoFactorLogin)
+
+	// Two-factor enrollment - also reachable with the restricted setup token
+	// issued to roles that must enroll before they can log in
+	twoFactorSetup := router.Group("/2fa")
+	twoFactorSetup.Use(middleware.MFASetupMiddleware(), middleware.AuditMiddleware())
+	{
+		twoFactorSetup.POST("/setup", handlers.SetupTwoFactor)
+		twoFactorSetup.POST("/enable", handlers.EnableTwoFactor)
+	}
 
 	// Protected routes
 	auth := router.Group("/")
 	auth.Use(middleware.AuthMiddleware())
+	auth.Use(middleware.AuditMiddleware())
+	auth.Use(middleware.StoreMiddleware())
 	{
 		// User routes - Admin only
 		auth.GET("/profile", handlers.GetProfile)
 		auth.POST("/reset-password", handlers.ResetPassword)
+		auth.GET("/stores", handlers.GetStores)
+		auth.GET("/2fa/status", handlers.GetTwoFactorStatus)
+		auth.POST("/2fa/disable", handlers.DisableTwoFactor)
+		auth.POST("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
 		
 		// User management - Admin only
 		userManagement := auth.Group("/")
@@ -67,38 +108,140 @@ func main() {
 			userManagement.POST("/register", handlers.Register)
 			userManagement.PUT("/users/:id", handlers.UpdateUser)
 			userManagement.DELETE("/users/:id", handlers.DeleteUser)
+			userManagement.DELETE("/users/:id/2fa", handlers.ResetUserTwoFactor)
+			userManagement.GET("/users/:id/stores", handlers.GetUserStores)
+			userManagement.PUT("/users/:id/stores", handlers.UpdateUserStores)
+			userManagement.POST("/stores", handlers.CreateStore)
+			userManagement.GET("/stores/:id", handlers.GetStore)
+			userManagement.PUT("/stores/:id", handlers.UpdateStore)
+			userManagement.GET("/audit-logs", handlers.GetAuditLogs)
+			userManagement.GET("/orphaned-uploads", handlers.GetOrphanedUploads)
+			userManagement.DELETE("/orphaned-uploads", handlers.DeleteOrphanedUploads)
+			userManagement.POST("/stock-alerts/dispatch", handlers.DispatchStockAlerts)
+			userManagement.POST("/stock-alerts/test", handlers.TestStockAlertNotifiers)
 		}
 
 		// Product routes - Read access for all authenticated users
 		auth.GET("/products", handlers.GetProducts)
+		auth.GET("/products/search", handlers.SearchProducts)
+		auth.GET("/products/:id", handlers.GetProduct)
+		auth.GET("/products/:id/images", handlers.GetProductImages)
 		auth.GET("/categories", handlers.GetCategories)
+		auth.GET("/categories/tree", handlers.GetCategoryTree)
 		auth.GET("/brands", handlers.GetBrands)
 		auth.GET("/subcategories/category/:id", handlers.GetSubcategories)
+		auth.GET("/size-runs", handlers.GetSizeRuns)
 		
 		// Product write operations - Admin and Manager only
 		productWrite := auth.Group("/")
 		productWrite.Use(middleware.RoleMiddleware("admin", "manager"))
 		{
 			productWrite.POST("/products", handlers.CreateProduct)
+			productWrite.POST("/products/import", handlers.ImportProducts)
 			productWrite.PUT("/products/:id", handlers.UpdateProduct)
+			productWrite.PATCH("/products/:id", handlers.PatchProduct)
 			productWrite.DELETE("/products/:id", handlers.DeleteProduct)
 			productWrite.POST("/categories", handlers.CreateCategory)
 			productWrite.POST("/brands", handlers.CreateBrand)
 			productWrite.POST("/subcategories", handlers.CreateSubcategory)
+			productWrite.PUT("/categories/:id", handlers.UpdateCategory)
+			productWrite.DELETE("/categories/:id", handlers.DeleteCategory)
+			productWrite.POST("/categories/reorder", handlers.ReorderCategories)
+			productWrite.PUT("/subcategories/:id", handlers.UpdateSubcategory)
+			productWrite.DELETE("/subcategories/:id", handlers.DeleteSubcategory)
+			productWrite.POST("/subcategories/reorder", handlers.ReorderSubcategories)
+			productWrite.PUT("/brands/:id", handlers.UpdateBrand)
+			productWrite.DELETE("/brands/:id", handlers.DeleteBrand)
+			productWrite.POST("/brands/reorder", handlers.ReorderBrands)
+			productWrite.POST("/variants/barcodes/generate", handlers.GenerateMissingBarcodes)
+			productWrite.POST("/products/:id/variants/generate", handlers.GenerateVariantMatrix)
+			productWrite.DELETE("/products/:id/variants/:variantId", handlers.DeleteProductVariant)
+			productWrite.POST("/products/:id/images", handlers.AddProductImage)
+			productWrite.POST("/products/:id/images/reorder", handlers.ReorderProductImages)
+			productWrite.POST("/products/:id/images/:imageId/main", handlers.SetMainProductImage)
+			productWrite.DELETE("/products/:id/images/:imageId", handlers.DeleteProductImage)
+			productWrite.POST("/size-runs", handlers.CreateSizeRun)
+		}
+
+		// Bulk exports - Admin and Manager only
+		exports := auth.Group("/export")
+		exports.Use(middleware.RoleMiddleware("admin", "manager"))
+		{
+			exports.GET("/products", handlers.ExportProducts)
+			exports.GET("/stock-entries", handlers.ExportStockEntries)
+			exports.GET("/sales", handlers.ExportSales)
 		}
 
 		// Stock routes
 		auth.GET("/stock-entries", handlers.GetStockEntries)
 		auth.POST("/stock-entries", handlers.CreateStockEntry)
 		auth.POST("/upload-image", handlers.UploadImage)
+		auth.GET("/signed-urls", handlers.GetSignedURL)
+
+		// Manual stock adjustments
+		auth.GET("/stock-adjustments", handlers.GetStockAdjustments)
+		auth.GET("/stock-adjustments/:id", handlers.GetStockAdjustment)
+		auth.POST("/stock-adjustments", handlers.CreateStockAdjustment)
+
+		adjustmentApproval := auth.Group("/")
+		adjustmentApproval.Use(middleware.RoleMiddleware("admin", "manager"))
+		{
+			adjustmentApproval.POST("/stock-adjustments/:id/approve", handlers.ApproveStockAdjustment)
+			adjustmentApproval.POST("/stock-adjustments/:id/reject", handlers.RejectStockAdjustment)
+			adjustmentApproval.POST("/stock-takes/:id/approve", handlers.ApproveStockTake)
+		}
+
+		// Stock-take (cycle count) sessions
+		auth.GET("/stock-takes", handlers.GetStockTakes)
+		auth.GET("/stock-takes/:id", handlers.GetStockTake)
+		auth.GET("/stock-takes/:id/variances", handlers.GetStockTakeVariances)
+		auth.POST("/stock-takes", handlers.CreateStockTake)
+		auth.POST("/stock-takes/:id/counts", handlers.RecordStockTakeCounts)
+		auth.POST("/stock-takes/:id/cancel", handlers.CancelStockTake)
+
+		// Stock transfers between stores
+		auth.GET("/stock-transfers", handlers.GetStockTransfers)
+		auth.GET("/stock-transfers/in-transit", handlers.GetInTransitStock)
+		auth.GET("/stock-transfers/:id", handlers.GetStockTransfer)
+		auth.POST("/stock-transfers", handlers.CreateStockTransfer)
+		auth.POST("/stock-transfers/:id/dispatch", handlers.DispatchStockTransfer)
+		auth.POST("/stock-transfers/:id/receive", handlers.ReceiveStockTransfer)
+		auth.POST("/stock-transfers/:id/cancel", handlers.CancelStockTransfer)
+
 auth.GET("/products/:id/variants", handlers.GetProductVariants)
+		auth.GET("/variants/:id/stock", handlers.GetVariantStock)
+		auth.GET("/variants/by-barcode/:code", handlers.GetVariantByBarcode)
+		auth.GET("/variants/labels", handlers.GetBarcodeLabels)
 		// Dashboard
 		auth.GET("/dashboard-stats", handlers.GetDashboardStats)
 
+		// Stock alerts and in-app notifications
+		auth.GET("/stock-alerts", handlers.GetStockAlerts)
+		auth.POST("/stock-alerts/:id/acknowledge", handlers.AcknowledgeStockAlert)
+		auth.GET("/notifications", handlers.GetNotifications)
+		auth.POST("/notifications/read-all", handlers.MarkAllNotificationsRead)
+		auth.POST("/notifications/:id/read", handlers.MarkNotificationRead)
+
 		// Supplier routes
 		auth.GET("/suppliers", handlers.GetSuppliers)
 		auth.POST("/suppliers", handlers.CreateSupplier)
 		auth.GET("/suppliers/:id", handlers.GetSupplier)
+		auth.GET("/variants/:id/reorder-settings", handlers.GetVariantReorderSettings)
+
+		// Purchasing - Admin and Manager only
+		purchasing := auth.Group("/")
+		purchasing.Use(middleware.RoleMiddleware("admin", "manager"))
+		{
+			purchasing.PUT("/suppliers/:id", handlers.UpdateSupplier)
+			purchasing.PUT("/variants/:id/reorder-settings", handlers.UpdateVariantReorderSettings)
+			purchasing.GET("/reorder-suggestions", handlers.GetReorderSuggestions)
+			purchasing.POST("/reorder-suggestions/purchase-orders", handlers.CreatePurchaseOrdersFromSuggestions)
+			purchasing.GET("/purchase-orders", handlers.GetPurchaseOrders)
+			purchasing.GET("/purchase-orders/:id", handlers.GetPurchaseOrder)
+			purchasing.POST("/purchase-orders/:id/order", handlers.OrderPurchaseOrder)
+			purchasing.POST("/purchase-orders/:id/receive", handlers.ReceivePurchaseOrder)
+			purchasing.POST("/purchase-orders/:id/cancel", handlers.CancelPurchaseOrder)
+		}
 
 		// Sales routes
 		auth.GET("/sales", handlers.GetSales)
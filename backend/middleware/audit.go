@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log"
+	"stock-management/database"
+	"stock-management/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const auditEntriesKey = "audit_entries"
+
+// RecordAudit queues an audit entry for the current request. Handlers pass
+// before/after snapshots (nil when there is none) and AuditMiddleware writes
+// the entries once the handler has finished successfully.
+func RecordAudit(c *gin.Context, action, tableName string, recordID int, oldValues, newValues interface{}) {
+	entry := models.AuditLog{
+		Action:    action,
+		TableName: tableName,
+		OldValues: marshalSnapshot(oldValues),
+		NewValues: marshalSnapshot(newValues),
+	}
+	if recordID > 0 {
+		entry.RecordID = &recordID
+	}
+
+	var entries []models.AuditLog
+	if existing, ok := c.Get(auditEntriesKey); ok {
+		entries = existing.([]models.AuditLog)
+	}
+	c.Set(auditEntriesKey, append(entries, entry))
+}
+
+// AuditMiddleware persists entries queued with RecordAudit to audit_logs,
+// stamping them with the acting user, client IP and user agent
+func AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		value, ok := c.Get(auditEntriesKey)
+		if !ok {
+			return
+		}
+
+		// Failed requests roll back their changes, so there is nothing to record
+		if c.Writer.Status() >= 400 {
+			return
+		}
+
+		var userID *int
+		if id := c.GetInt("user_id"); id > 0 {
+			userID = &id
+		}
+
+		db := database.GetDB()
+		for _, entry := range value.([]models.AuditLog) {
+			entry.UserID = userID
+			entry.IPAddress = c.ClientIP()
+			entry.UserAgent = c.Request.UserAgent()
+
+			if err := models.CreateAuditLog(db, &entry); err != nil {
+				log.Printf("⚠️ Could not write audit log for %s %s: %v", entry.Action, entry.TableName, err)
+			}
+		}
+	}
+}
+
+func marshalSnapshot(value interface{}) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("⚠️ Could not marshal audit snapshot: %v", err)
+		return nil
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	return data
+}
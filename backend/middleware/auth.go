@@ -31,6 +31,14 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Tokens issued mid-way through two-factor login only unlock that flow
+		if claims.Purpose != "" {
+			log.Printf("❌ Restricted %s token used for user %d", claims.Purpose, claims.UserID)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor authentication required"})
+			c.Abort()
+			return
+		}
+
 		log.Printf("✅ Token validated for user %d, role: %s", claims.UserID, claims.Role)
 		c.Set("user_id", claims.UserID)
 		c.Set("role", claims.Role)
@@ -38,6 +46,32 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// MFASetupMiddleware accepts full session tokens as well as the restricted
+// enrollment tokens handed to users whose role requires 2FA but who have not
+// enrolled yet
+func MFASetupMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			c.Abort()
+			return
+		}
+
+		claims, err := utils.ValidateJWT(tokenString)
+		if err != nil || (claims.Purpose != "" && claims.Purpose != utils.TokenPurposeMFASetup) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("role", claims.Role)
+		c.Set("token_purpose", claims.Purpose)
+		c.Next()
+	}
+}
+
 // RoleMiddleware checks if user has required role
 func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"stock-management/database"
+	"stock-management/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NoStore is the store_id set for non-admins who are not assigned to any
+// store. It matches no rows, unlike 0 which means every store.
+const NoStore = -1
+
+// StoreMiddleware resolves which store the request works against from the
+// X-Store-ID header (or store_id query parameter) and sets "store_id".
+// Admins may omit it to see consolidated data across all stores (store_id 0);
+// everyone else falls back to their default store and may only select stores
+// they are assigned to.
+func StoreMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		role := c.GetString("role")
+		db := database.GetDB()
+
+		requested := c.GetHeader("X-Store-ID")
+		if requested == "" {
+			requested = c.Query("store_id")
+		}
+
+		if requested == "" {
+			storeID := 0
+			if role != "admin" {
+				var err error
+				storeID, err = models.GetDefaultStoreID(db, userID)
+				if err != nil {
+					log.Printf("❌ Default store lookup error: %v", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not resolve store"})
+					c.Abort()
+					return
+				}
+				// Unassigned users can still reach their profile, but
+				// store-scoped lists come back empty for them
+				if storeID == 0 {
+					storeID = NoStore
+				}
+			}
+			c.Set("store_id", storeID)
+			c.Next()
+			return
+		}
+
+		storeID, err := strconv.Atoi(requested)
+		if err != nil || storeID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+			c.Abort()
+			return
+		}
+
+		if role == "admin" {
+			if _, err := models.GetStoreByID(db, storeID); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+				c.Abort()
+				return
+			}
+		} else {
+			allowed, err := models.UserHasStore(db, userID, storeID)
+			if err != nil {
+				log.Printf("❌ Store access check error: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not resolve store"})
+				c.Abort()
+				return
+			}
+			if !allowed {
+				log.Printf("❌ User %d denied access to store %d", userID, storeID)
+				c.JSON(http.StatusForbidden, gin.H{"error": "No access to this store"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("store_id", storeID)
+		c.Next()
+	}
+}
@@ -0,0 +1,278 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	AdjustmentPending  = "pending"
+	AdjustmentApproved = "approved"
+	AdjustmentRejected = "rejected"
+)
+
+var (
+	ErrAdjustmentState   = errors.New("adjustment is not pending")
+	ErrInvalidAdjustment = errors.New("invalid adjustment")
+)
+
+// ApprovalRule decides whether a stock change of delta units worth value (at
+// cost) has to wait for manager approval
+type ApprovalRule func(delta int, value float64) bool
+
+// CreateStockAdjustment posts a manual adjustment against a variant's stock
+// at adj.StoreID. For add/remove, adj.Quantity is the number of units; for a
+// correction, adj.NewQuantity is the counted quantity. Adjustments that need
+// approval are saved as pending and leave stock untouched until approved.
+func CreateStockAdjustment(db *sql.DB, adj *StockAdjustment, needsApproval ApprovalRule) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	current, err := GetStoreStockTx(tx, adj.StoreID, adj.ProductVariantID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var costPrice float64
+	if err := tx.QueryRow(`SELECT COALESCE(cost_price, 0) FROM product_variants WHERE id = ?`, adj.ProductVariantID).Scan(&costPrice); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrInvalidAdjustment
+		}
+		return err
+	}
+
+	if err := resolveAdjustment(adj, current); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	delta := adj.NewQuantity - adj.PreviousQuantity
+	value := float64(abs(delta)) * costPrice
+
+	adj.Status = AdjustmentApproved
+	if needsApproval != nil && needsApproval(delta, value) {
+		adj.Status = AdjustmentPending
+	} else {
+		now := time.Now()
+		approver := adj.AdjustedBy
+		adj.ApprovedBy = &approver
+		adj.ApprovedAt = &now
+		if err := SetStoreStockTx(tx, adj.StoreID, adj.ProductVariantID, adj.NewQuantity); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := CreateStockAdjustmentTx(tx, adj); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateStockAdjustmentTx records a stock adjustment row. It does not move
+// stock itself; callers change store stock in the same transaction.
+func CreateStockAdjustmentTx(tx *sql.Tx, adj *StockAdjustment) error {
+	if adj.Status == "" {
+		adj.Status = AdjustmentApproved
+	}
+	if adj.ReasonCode == "" {
+		adj.ReasonCode = "other"
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO stock_adjustments (product_id, product_variant_id, store_id, previous_quantity, new_quantity, quantity,
+		                               adjustment_type, reason_code, reason, status, adjusted_by, approved_by, approved_at)
+		SELECT product_id, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? FROM product_variants WHERE id = ?`,
+		adj.ProductVariantID, adj.StoreID, adj.PreviousQuantity, adj.NewQuantity, adj.Quantity,
+		adj.AdjustmentType, adj.ReasonCode, adj.Reason, adj.Status, adj.AdjustedBy, adj.ApprovedBy, adj.ApprovedAt,
+		adj.ProductVariantID)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	adj.ID = int(id)
+	adj.AdjustedAt = time.Now()
+	return tx.QueryRow(`SELECT product_id FROM product_variants WHERE id = ?`, adj.ProductVariantID).Scan(&adj.ProductID)
+}
+
+// ApproveStockAdjustment applies a pending adjustment. Add/remove keep their
+// requested change against today's stock; corrections set the counted quantity.
+func ApproveStockAdjustment(db *sql.DB, id, approverID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var adj StockAdjustment
+	err = tx.QueryRow(`
+		SELECT id, product_variant_id, store_id, new_quantity, quantity, adjustment_type, status
+		FROM stock_adjustments WHERE id = ? FOR UPDATE`, id).
+		Scan(&adj.ID, &adj.ProductVariantID, &adj.StoreID, &adj.NewQuantity, &adj.Quantity, &adj.AdjustmentType, &adj.Status)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if adj.Status != AdjustmentPending {
+		tx.Rollback()
+		return ErrAdjustmentState
+	}
+
+	current, err := GetStoreStockTx(tx, adj.StoreID, adj.ProductVariantID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	target := adj.NewQuantity
+	if adj.AdjustmentType != "correction" {
+		target = current + adj.Quantity
+	}
+	if target < 0 {
+		tx.Rollback()
+		return ErrInsufficientStock
+	}
+
+	if err := SetStoreStockTx(tx, adj.StoreID, adj.ProductVariantID, target); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE stock_adjustments
+		SET previous_quantity = ?, new_quantity = ?, status = ?, approved_by = ?, approved_at = NOW()
+		WHERE id = ?`,
+		current, target, AdjustmentApproved, approverID, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func RejectStockAdjustment(db *sql.DB, id, approverID int) error {
+	result, err := db.Exec(`
+		UPDATE stock_adjustments SET status = ?, approved_by = ?, approved_at = NOW()
+		WHERE id = ? AND status = ?`,
+		AdjustmentRejected, approverID, id, AdjustmentPending)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrAdjustmentState
+	}
+	return nil
+}
+
+// GetStockAdjustments lists adjustments for storeID (0 for every store),
+// optionally filtered by status
+func GetStockAdjustments(db *sql.DB, storeID int, status string) ([]StockAdjustment, error) {
+	query := adjustmentSelect + ` WHERE (? = 0 OR a.store_id = ?)`
+	args := []interface{}{storeID, storeID}
+	if status != "" {
+		query += " AND a.status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY a.adjusted_at DESC, a.id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var adjustments []StockAdjustment
+	for rows.Next() {
+		adj, err := scanAdjustment(rows)
+		if err != nil {
+			return nil, err
+		}
+		adjustments = append(adjustments, *adj)
+	}
+	return adjustments, rows.Err()
+}
+
+func GetStockAdjustmentByID(db *sql.DB, id int) (*StockAdjustment, error) {
+	return scanAdjustment(db.QueryRow(adjustmentSelect+" WHERE a.id = ?", id))
+}
+
+// resolveAdjustment fills in previous/new quantity and the signed change
+func resolveAdjustment(adj *StockAdjustment, current int) error {
+	adj.PreviousQuantity = current
+
+	switch adj.AdjustmentType {
+	case "add":
+		if adj.Quantity <= 0 {
+			return ErrInvalidAdjustment
+		}
+		adj.NewQuantity = current + adj.Quantity
+	case "remove":
+		if adj.Quantity <= 0 {
+			return ErrInvalidAdjustment
+		}
+		if adj.Quantity > current {
+			return ErrInsufficientStock
+		}
+		adj.NewQuantity = current - adj.Quantity
+		adj.Quantity = -adj.Quantity
+	case "correction":
+		if adj.NewQuantity < 0 {
+			return ErrInvalidAdjustment
+		}
+		adj.Quantity = adj.NewQuantity - current
+	default:
+		return ErrInvalidAdjustment
+	}
+	return nil
+}
+
+const adjustmentSelect = `
+	SELECT a.id, COALESCE(a.product_id, 0), COALESCE(a.product_variant_id, 0), COALESCE(a.store_id, 0),
+	       a.previous_quantity, a.new_quantity, a.quantity, a.adjustment_type, COALESCE(a.reason_code, 'other'),
+	       COALESCE(a.reason, ''), a.status, COALESCE(a.adjusted_by, 0), a.adjusted_at, a.approved_by, a.approved_at,
+	       COALESCE(v.sku, ''), COALESCE(p.item_name, ''), COALESCE(v.size, ''), COALESCE(v.color, '')
+	FROM stock_adjustments a
+	LEFT JOIN product_variants v ON v.id = a.product_variant_id
+	LEFT JOIN products p ON p.id = a.product_id`
+
+func scanAdjustment(row rowScanner) (*StockAdjustment, error) {
+	var adj StockAdjustment
+	var approvedBy sql.NullInt64
+	var approvedAt sql.NullTime
+
+	if err := row.Scan(&adj.ID, &adj.ProductID, &adj.ProductVariantID, &adj.StoreID,
+		&adj.PreviousQuantity, &adj.NewQuantity, &adj.Quantity, &adj.AdjustmentType, &adj.ReasonCode,
+		&adj.Reason, &adj.Status, &adj.AdjustedBy, &adj.AdjustedAt, &approvedBy, &approvedAt,
+		&adj.SKU, &adj.ItemName, &adj.Size, &adj.Color); err != nil {
+		return nil, err
+	}
+
+	adj.ApprovedBy = nullIntPtr(approvedBy)
+	if approvedAt.Valid {
+		adj.ApprovedAt = &approvedAt.Time
+	}
+	return &adj, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
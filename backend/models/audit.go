@@ -0,0 +1,145 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+type AuditLog struct {
+	ID        int             `json:"id"`
+	UserID    *int            `json:"user_id,omitempty"`
+	Username  string          `json:"username,omitempty"`
+	Action    string          `json:"action"`
+	TableName string          `json:"table_name"`
+	RecordID  *int            `json:"record_id,omitempty"`
+	OldValues json.RawMessage `json:"old_values,omitempty"`
+	NewValues json.RawMessage `json:"new_values,omitempty"`
+	IPAddress string          `json:"ip_address"`
+	UserAgent string          `json:"user_agent"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditLogFilter narrows GetAuditLogs; zero values are ignored
+type AuditLogFilter struct {
+	UserID    int
+	Action    string
+	TableName string
+	RecordID  int
+	From      *time.Time
+	To        *time.Time
+	Limit     int
+	Offset    int
+}
+
+func CreateAuditLog(db *sql.DB, entry *AuditLog) error {
+	result, err := db.Exec(`
+		INSERT INTO audit_logs (user_id, action, table_name, record_id, old_values, new_values, ip_address, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.UserID, entry.Action, entry.TableName, entry.RecordID,
+		nullableJSON(entry.OldValues), nullableJSON(entry.NewValues),
+		entry.IPAddress, entry.UserAgent)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	entry.ID = int(id)
+	return nil
+}
+
+func GetAuditLogs(db *sql.DB, filter AuditLogFilter) ([]AuditLog, error) {
+	query := `
+		SELECT a.id, a.user_id, COALESCE(u.username, ''), a.action, a.table_name, a.record_id,
+		       a.old_values, a.new_values, COALESCE(a.ip_address, ''), COALESCE(a.user_agent, ''), a.created_at
+		FROM audit_logs a
+		LEFT JOIN users u ON a.user_id = u.id
+		WHERE 1 = 1`
+	var args []interface{}
+
+	if filter.UserID > 0 {
+		query += " AND a.user_id = ?"
+		args = append(args, filter.UserID)
+	}
+	if filter.Action != "" {
+		query += " AND a.action = ?"
+		args = append(args, filter.Action)
+	}
+	if filter.TableName != "" {
+		query += " AND a.table_name = ?"
+		args = append(args, filter.TableName)
+	}
+	if filter.RecordID > 0 {
+		query += " AND a.record_id = ?"
+		args = append(args, filter.RecordID)
+	}
+	if filter.From != nil {
+		query += " AND a.created_at >= ?"
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		query += " AND a.created_at < ?"
+		args = append(args, *filter.To)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query += " ORDER BY a.created_at DESC, a.id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, filter.Offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logs []AuditLog
+	for rows.Next() {
+		var entry AuditLog
+		var userID, recordID sql.NullInt64
+		var oldValues, newValues []byte
+
+		if err := rows.Scan(
+			&entry.ID, &userID, &entry.Username, &entry.Action, &entry.TableName, &recordID,
+			&oldValues, &newValues, &entry.IPAddress, &entry.UserAgent, &entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		if userID.Valid {
+			id := int(userID.Int64)
+			entry.UserID = &id
+		}
+		if recordID.Valid {
+			id := int(recordID.Int64)
+			entry.RecordID = &id
+		}
+		if len(oldValues) > 0 {
+			entry.OldValues = json.RawMessage(oldValues)
+		}
+		if len(newValues) > 0 {
+			entry.NewValues = json.RawMessage(newValues)
+		}
+
+		logs = append(logs, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
+
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+var ErrDuplicateBarcode = errors.New("barcode is already assigned to another variant")
+
+// VariantLookup is a variant with the product details a till or scanner needs
+type VariantLookup struct {
+	ProductVariant
+	ItemID       string `json:"item_id"`
+	ItemName     string `json:"item_name"`
+	Model        string `json:"model"`
+	BrandName    string `json:"brand_name"`
+	CategoryName string `json:"category_name"`
+}
+
+// GetVariantByCode finds an active variant by barcode or SKU, preferring a
+// barcode match. Stock is reported for storeID (0 for the total).
+func GetVariantByCode(db *sql.DB, code string, storeID int) (*VariantLookup, error) {
+	return scanVariantLookup(db.QueryRow(variantLookupSelect+`
+		WHERE (v.barcode = ? OR v.sku = ?) AND v.is_active = true
+		ORDER BY v.barcode = ? DESC
+		LIMIT 1`, storeID, storeID, code, code, code))
+}
+
+// GetVariantsForLabels loads the given variants (or every active variant of
+// productID when ids is empty) for printing
+func GetVariantsForLabels(db *sql.DB, ids []int, productID int) ([]VariantLookup, error) {
+	query := variantLookupSelect + " WHERE v.is_active = true"
+	args := []interface{}{0, 0}
+	if len(ids) > 0 {
+		query += " AND v.id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	} else {
+		query += " AND v.product_id = ?"
+		args = append(args, productID)
+	}
+	query += " ORDER BY p.item_name, v.gender, v.size, v.color"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []VariantLookup
+	for rows.Next() {
+		variant, err := scanVariantLookup(rows)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, *variant)
+	}
+	return variants, rows.Err()
+}
+
+// BarcodeTakenTx reports whether another variant (other than variantID)
+// already uses barcode
+func BarcodeTakenTx(tx *sql.Tx, barcode string, variantID int) (bool, error) {
+	var taken bool
+	err := tx.QueryRow(`SELECT COUNT(*) > 0 FROM product_variants WHERE barcode = ? AND id <> ?`,
+		barcode, variantID).Scan(&taken)
+	return taken, err
+}
+
+func SetVariantBarcodeTx(tx *sql.Tx, variantID int, barcode string) error {
+	_, err := tx.Exec(`UPDATE product_variants SET barcode = ? WHERE id = ?`, barcode, variantID)
+	return variantCodeError(err, "", barcode)
+}
+
+// GetVariantIDsWithoutBarcode lists active variants that have no barcode yet
+func GetVariantIDsWithoutBarcode(db *sql.DB) ([]int, error) {
+	rows, err := db.Query(`
+		SELECT id FROM product_variants
+		WHERE (barcode IS NULL OR barcode = '') AND is_active = true
+		ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+const variantLookupSelect = `
+	SELECT v.id, v.product_id, v.gender, v.size, COALESCE(v.color, ''), COALESCE(v.mrp, 0), COALESCE(v.selling_price, 0),
+	       COALESCE(v.cost_price, 0), COALESCE(v.sku, ''), COALESCE(v.barcode, ''),
+	       CASE WHEN ? <> 0 THEN COALESCE(ss.quantity, 0) ELSE v.current_stock END,
+	       COALESCE(v.image_url, ''), v.is_active,
+	       p.item_id, p.item_name, COALESCE(p.model, ''), COALESCE(b.name, ''), COALESCE(c.name, '')
+	FROM product_variants v
+	JOIN products p ON p.id = v.product_id
+	LEFT JOIN brands b ON b.id = p.brand_id
+	LEFT JOIN categories c ON c.id = p.category_id
+	LEFT JOIN store_stock ss ON ss.product_variant_id = v.id AND ss.store_id = ?`
+
+func scanVariantLookup(row rowScanner) (*VariantLookup, error) {
+	var v VariantLookup
+	if err := row.Scan(&v.ID, &v.ProductID, &v.Gender, &v.Size, &v.Color, &v.MRP, &v.SellingPrice,
+		&v.CostPrice, &v.SKU, &v.Barcode, &v.CurrentStock, &v.ImageURL, &v.IsActive,
+		&v.ItemID, &v.ItemName, &v.Model, &v.BrandName, &v.CategoryName); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"database/sql"
+	"math"
+	"time"
+)
+
+type DashboardStats struct {
+	StoreID       int            `json:"store_id"`
+	TotalProducts int            `json:"total_products"`
+	TotalVariants int            `json:"total_variants"`
+	TotalUnits    int            `json:"total_units"`
+	StockValue    StockValuation `json:"stock_value"`
+	// TotalStockValue is StockValue.AtSellingPrice, kept for older clients
+	TotalStockValue float64 `json:"total_stock_value"`
+	// Variants in stock but below their product's low_stock_threshold, and
+	// variants with none left (see StockLevel)
+	LowStockItems   int `json:"low_stock_items"`
+	OutOfStockItems int `json:"out_of_stock_items"`
+	// TodaySales and MonthlySales repeat the current figures of the
+	// comparisons, kept for older clients
+	TodaySales   float64          `json:"today_sales"`
+	MonthlySales float64          `json:"monthly_sales"`
+	Today        PeriodComparison `json:"today"`
+	MonthToDate  PeriodComparison `json:"month_to_date"`
+	GeneratedAt  time.Time        `json:"generated_at"`
+}
+
+// StockValuation values stock on hand at each of a variant's prices.
+// Units whose variant has no cost price are left out of AtCost and counted
+// in UnitsWithoutCost.
+type StockValuation struct {
+	AtCost           float64 `json:"at_cost"`
+	AtSellingPrice   float64 `json:"at_selling_price"`
+	AtMRP            float64 `json:"at_mrp"`
+	UnitsWithoutCost int     `json:"units_without_cost"`
+}
+
+// SalesPeriod sums sales, refunds excluded, from From up to but not
+// including To
+type SalesPeriod struct {
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Revenue   float64   `json:"revenue"`
+	SaleCount int       `json:"sale_count"`
+}
+
+type PeriodComparison struct {
+	Current  SalesPeriod `json:"current"`
+	Previous SalesPeriod `json:"previous"`
+	Change   float64     `json:"change"`
+	// ChangePercent is nil when the previous period had no revenue
+	ChangePercent *float64 `json:"change_percent"`
+}
+
+// GetDashboardStats computes the dashboard for storeID (every store when 0)
+// as of now. Stock is counted per active variant of an active product:
+// store_stock for one store, current_stock across all of them.
+func GetDashboardStats(db *sql.DB, storeID int, now time.Time) (*DashboardStats, error) {
+	stats := &DashboardStats{StoreID: storeID, GeneratedAt: now}
+
+	if err := db.QueryRow(`SELECT COUNT(*) FROM products WHERE is_active = true`).Scan(&stats.TotalProducts); err != nil {
+		return nil, err
+	}
+
+	if err := db.QueryRow(`
+		SELECT COUNT(*),
+		       COALESCE(SUM(stock.quantity), 0),
+		       COALESCE(SUM(stock.quantity * v.cost_price), 0),
+		       COALESCE(SUM(stock.quantity * COALESCE(v.selling_price, 0)), 0),
+		       COALESCE(SUM(stock.quantity * COALESCE(v.mrp, 0)), 0),
+		       COALESCE(SUM(CASE WHEN v.cost_price IS NULL THEN stock.quantity ELSE 0 END), 0),
+		       COALESCE(SUM(CASE WHEN stock.quantity > 0 AND stock.quantity < COALESCE(p.low_stock_threshold, 0) THEN 1 ELSE 0 END), 0),
+		       COALESCE(SUM(CASE WHEN stock.quantity <= 0 THEN 1 ELSE 0 END), 0)
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		JOIN (
+			SELECT v2.id AS variant_id,
+			       CASE WHEN ? = 0 THEN v2.current_stock ELSE COALESCE(ss.quantity, 0) END AS quantity
+			FROM product_variants v2
+			LEFT JOIN store_stock ss ON ss.product_variant_id = v2.id AND ss.store_id = ?
+		) stock ON stock.variant_id = v.id
+		WHERE v.is_active = true AND p.is_active = true`, storeID, storeID).Scan(
+		&stats.TotalVariants, &stats.TotalUnits,
+		&stats.StockValue.AtCost, &stats.StockValue.AtSellingPrice, &stats.StockValue.AtMRP,
+		&stats.StockValue.UnitsWithoutCost,
+		&stats.LowStockItems, &stats.OutOfStockItems,
+	); err != nil {
+		return nil, err
+	}
+	stats.StockValue.AtCost = roundMoney(stats.StockValue.AtCost)
+	stats.StockValue.AtSellingPrice = roundMoney(stats.StockValue.AtSellingPrice)
+	stats.StockValue.AtMRP = roundMoney(stats.StockValue.AtMRP)
+	stats.TotalStockValue = stats.StockValue.AtSellingPrice
+
+	// Each current period is compared with the same stretch of the one
+	// before: yesterday up to this time of day, and last month up to this
+	// day and time, clamped to its last day
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	yesterday := today.AddDate(0, 0, -1)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	lastMonth := month.AddDate(0, -1, 0)
+	periods := []*SalesPeriod{
+		&stats.Today.Current, &stats.Today.Previous,
+		&stats.MonthToDate.Current, &stats.MonthToDate.Previous,
+	}
+	*periods[0] = SalesPeriod{From: today, To: now}
+	*periods[1] = SalesPeriod{From: yesterday, To: sameTimeOn(yesterday, now)}
+	*periods[2] = SalesPeriod{From: month, To: now}
+	*periods[3] = SalesPeriod{From: lastMonth, To: month}
+	if lastDay := month.AddDate(0, 0, -1).Day(); now.Day() <= lastDay {
+		day := time.Date(lastMonth.Year(), lastMonth.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		periods[3].To = sameTimeOn(day, now)
+	}
+
+	// One pass over sales since the start of last month, which also covers
+	// yesterday
+	query := `SELECT `
+	var args []interface{}
+	var dest []interface{}
+	for i, period := range periods {
+		if i > 0 {
+			query += `, `
+		}
+		query += `COALESCE(SUM(CASE WHEN sale_date >= ? AND sale_date < ? THEN final_amount END), 0),
+		          COUNT(CASE WHEN sale_date >= ? AND sale_date < ? THEN 1 END)`
+		args = append(args, period.From, period.To, period.From, period.To)
+		dest = append(dest, &period.Revenue, &period.SaleCount)
+	}
+	query += `
+		FROM sales
+		WHERE sale_date >= ? AND sale_date < ? AND payment_status <> 'refunded' AND (? = 0 OR store_id = ?)`
+	args = append(args, periods[3].From, now, storeID, storeID)
+	if err := db.QueryRow(query, args...).Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	for _, comparison := range []*PeriodComparison{&stats.Today, &stats.MonthToDate} {
+		comparison.Current.Revenue = roundMoney(comparison.Current.Revenue)
+		comparison.Previous.Revenue = roundMoney(comparison.Previous.Revenue)
+		comparison.Change = roundMoney(comparison.Current.Revenue - comparison.Previous.Revenue)
+		if comparison.Previous.Revenue != 0 {
+			percent := math.Round(comparison.Change/comparison.Previous.Revenue*1000) / 10
+			comparison.ChangePercent = &percent
+		}
+	}
+	stats.TodaySales = stats.Today.Current.Revenue
+	stats.MonthlySales = stats.MonthToDate.Current.Revenue
+	return stats, nil
+}
+
+// sameTimeOn returns the time of day of t on day
+func sameTimeOn(day, t time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+func roundMoney(value float64) float64 {
+	return math.Round(value*100) / 100
+}
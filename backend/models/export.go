@@ -0,0 +1,223 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ExportFilter narrows a bulk export. From is inclusive and To exclusive;
+// StoreID 0 exports every store.
+type ExportFilter struct {
+	From       *time.Time
+	To         *time.Time
+	CategoryID int
+	StoreID    int
+}
+
+// Kinds of export column, deciding how NULLs and types are scanned
+const (
+	exportString = iota
+	exportInt
+	exportFloat
+	exportTime
+)
+
+type exportColumn struct {
+	name string
+	kind int
+}
+
+// ExportRows streams the rows of an export query; use it like sql.Rows
+type ExportRows struct {
+	Columns []string
+	kinds   []int
+	rows    *sql.Rows
+}
+
+func (r *ExportRows) Next() bool { return r.rows.Next() }
+func (r *ExportRows) Err() error { return r.rows.Err() }
+func (r *ExportRows) Close() error {
+	return r.rows.Close()
+}
+
+// Values scans the current row, with nil for NULL columns
+func (r *ExportRows) Values() ([]interface{}, error) {
+	dest := make([]interface{}, len(r.kinds))
+	for i, kind := range r.kinds {
+		switch kind {
+		case exportInt:
+			dest[i] = &sql.NullInt64{}
+		case exportFloat:
+			dest[i] = &sql.NullFloat64{}
+		case exportTime:
+			dest[i] = &sql.NullTime{}
+		default:
+			dest[i] = &sql.NullString{}
+		}
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(dest))
+	for i, d := range dest {
+		switch v := d.(type) {
+		case *sql.NullInt64:
+			if v.Valid {
+				values[i] = v.Int64
+			}
+		case *sql.NullFloat64:
+			if v.Valid {
+				values[i] = v.Float64
+			}
+		case *sql.NullTime:
+			if v.Valid {
+				values[i] = v.Time
+			}
+		case *sql.NullString:
+			if v.Valid {
+				values[i] = v.String
+			}
+		}
+	}
+	return values, nil
+}
+
+func queryExport(db *sql.DB, columns []exportColumn, query string, args ...interface{}) (*ExportRows, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &ExportRows{rows: rows}
+	for _, column := range columns {
+		export.Columns = append(export.Columns, column.name)
+		export.kinds = append(export.kinds, column.kind)
+	}
+	return export, nil
+}
+
+// exportConditions appends the date range and category filters to a WHERE
+// clause
+func (f ExportFilter) exportConditions(dateColumn, categoryColumn string) (string, []interface{}) {
+	var where string
+	var args []interface{}
+	if f.From != nil {
+		where += " AND " + dateColumn + " >= ?"
+		args = append(args, *f.From)
+	}
+	if f.To != nil {
+		where += " AND " + dateColumn + " < ?"
+		args = append(args, *f.To)
+	}
+	if f.CategoryID > 0 {
+		where += " AND " + categoryColumn + " = ?"
+		args = append(args, f.CategoryID)
+	}
+	return where, args
+}
+
+var productExportColumns = []exportColumn{
+	{"product_id", exportInt}, {"item_id", exportString}, {"item_name", exportString},
+	{"category", exportString}, {"subcategory", exportString}, {"brand", exportString},
+	{"model", exportString}, {"description", exportString}, {"low_stock_threshold", exportInt},
+	{"variant_id", exportInt}, {"gender", exportString}, {"size", exportString}, {"color", exportString},
+	{"sku", exportString}, {"barcode", exportString},
+	{"mrp", exportFloat}, {"selling_price", exportFloat}, {"cost_price", exportFloat},
+	{"stock", exportInt}, {"created_at", exportTime},
+}
+
+// ExportProducts streams active products with one row per active variant
+// (one row with empty variant columns for products without variants). The
+// date range applies to when the product was created; stock is for
+// filter.StoreID, or the total when it is 0.
+func ExportProducts(db *sql.DB, filter ExportFilter) (*ExportRows, error) {
+	conditions, args := filter.exportConditions("p.created_at", "p.category_id")
+	args = append([]interface{}{filter.StoreID, filter.StoreID}, args...)
+
+	return queryExport(db, productExportColumns, `
+		SELECT p.id, p.item_id, p.item_name, c.name, sc.name, b.name,
+		       p.model, p.description, p.low_stock_threshold,
+		       v.id, v.gender, v.size, v.color, v.sku, v.barcode,
+		       v.mrp, v.selling_price, v.cost_price,
+		       CASE WHEN v.id IS NULL THEN NULL WHEN ? <> 0 THEN COALESCE(ss.quantity, 0) ELSE v.current_stock END,
+		       p.created_at
+		FROM products p
+		LEFT JOIN categories c ON c.id = p.category_id
+		LEFT JOIN subcategories sc ON sc.id = p.subcategory_id
+		LEFT JOIN brands b ON b.id = p.brand_id
+		LEFT JOIN product_variants v ON v.product_id = p.id AND v.is_active = true
+		LEFT JOIN store_stock ss ON ss.product_variant_id = v.id AND ss.store_id = ?
+		WHERE p.is_active = true`+conditions+`
+		ORDER BY p.item_name, p.id, v.gender, v.size, v.color, v.id`, args...)
+}
+
+var stockEntryExportColumns = []exportColumn{
+	{"entry_id", exportInt}, {"entry_date", exportTime}, {"store", exportString}, {"bill_number", exportString},
+	{"product_id", exportInt}, {"item_id", exportString}, {"item_name", exportString}, {"category", exportString},
+	{"variant_id", exportInt}, {"sku", exportString}, {"size", exportString}, {"color", exportString},
+	{"purchase_quantity", exportInt}, {"current_quantity", exportInt},
+	{"purchase_price", exportFloat}, {"mrp", exportFloat}, {"selling_price", exportFloat},
+	{"supplier_name", exportString}, {"supplier_contact", exportString},
+	{"status", exportString}, {"added_by", exportString}, {"notes", exportString},
+}
+
+// ExportStockEntries streams stock entries in date order, filtered by entry
+// date, product category and store
+func ExportStockEntries(db *sql.DB, filter ExportFilter) (*ExportRows, error) {
+	conditions, args := filter.exportConditions("se.entry_date", "p.category_id")
+	args = append([]interface{}{filter.StoreID, filter.StoreID}, args...)
+
+	return queryExport(db, stockEntryExportColumns, `
+		SELECT se.id, se.entry_date, st.name, se.bill_number,
+		       p.id, p.item_id, p.item_name, c.name,
+		       v.id, v.sku, v.size, v.color,
+		       se.purchase_quantity, se.current_quantity,
+		       se.purchase_price, se.mrp, se.selling_price,
+		       se.supplier_name, se.supplier_contact,
+		       se.status, u.username, se.notes
+		FROM stock_entries se
+		JOIN products p ON p.id = se.product_id
+		LEFT JOIN categories c ON c.id = p.category_id
+		LEFT JOIN product_variants v ON v.id = se.product_variant_id
+		LEFT JOIN stores st ON st.id = se.store_id
+		LEFT JOIN users u ON u.id = se.added_by
+		WHERE (? = 0 OR se.store_id = ?)`+conditions+`
+		ORDER BY se.entry_date, se.id`, args...)
+}
+
+var saleExportColumns = []exportColumn{
+	{"sale_id", exportInt}, {"sale_number", exportString}, {"sale_date", exportTime}, {"store", exportString},
+	{"customer_name", exportString}, {"customer_contact", exportString},
+	{"payment_method", exportString}, {"payment_status", exportString}, {"sold_by", exportString},
+	{"sale_total", exportFloat}, {"sale_discount", exportFloat}, {"sale_tax", exportFloat}, {"sale_final_amount", exportFloat},
+	{"line_id", exportInt}, {"product_id", exportInt}, {"item_id", exportString}, {"item_name", exportString},
+	{"category", exportString}, {"variant_id", exportInt}, {"sku", exportString}, {"size", exportString}, {"color", exportString},
+	{"quantity", exportInt}, {"unit_price", exportFloat}, {"line_total", exportFloat},
+}
+
+// ExportSales streams sales with one row per sale item, the sale's own
+// columns repeated on each. With a category filter only the items in that
+// category are exported.
+func ExportSales(db *sql.DB, filter ExportFilter) (*ExportRows, error) {
+	conditions, args := filter.exportConditions("s.sale_date", "p.category_id")
+	args = append([]interface{}{filter.StoreID, filter.StoreID}, args...)
+
+	return queryExport(db, saleExportColumns, `
+		SELECT s.id, s.sale_number, s.sale_date, st.name,
+		       s.customer_name, s.customer_contact,
+		       s.payment_method, s.payment_status, u.username,
+		       s.total_amount, s.discount_amount, s.tax_amount, s.final_amount,
+		       si.id, p.id, p.item_id, p.item_name,
+		       c.name, v.id, v.sku, v.size, v.color,
+		       si.quantity, si.unit_price, si.total_price
+		FROM sales s
+		JOIN sale_items si ON si.sale_id = s.id
+		LEFT JOIN products p ON p.id = si.product_id
+		LEFT JOIN categories c ON c.id = p.category_id
+		LEFT JOIN product_variants v ON v.id = si.product_variant_id
+		LEFT JOIN stores st ON st.id = s.store_id
+		LEFT JOIN users u ON u.id = s.sold_by
+		WHERE (? = 0 OR s.store_id = ?)`+conditions+`
+		ORDER BY s.sale_date, s.id, si.id`, args...)
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// Notification is an in-app message. Those with a store are shown to users
+// working in that store; the rest to everyone.
+type Notification struct {
+	ID           int       `json:"id"`
+	StoreID      *int      `json:"store_id,omitempty"`
+	StockAlertID *int      `json:"stock_alert_id,omitempty"`
+	Title        string    `json:"title"`
+	Message      string    `json:"message"`
+	CreatedAt    time.Time `json:"created_at"`
+	Read         bool      `json:"read"`
+}
+
+func CreateNotification(db *sql.DB, n *Notification) error {
+	result, err := db.Exec(`
+		INSERT INTO notifications (store_id, stock_alert_id, title, message) VALUES (?, ?, ?, ?)`,
+		n.StoreID, n.StockAlertID, n.Title, n.Message)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	n.ID = int(id)
+	n.CreatedAt = time.Now()
+	return nil
+}
+
+// GetNotifications lists the newest notifications for userID in storeID
+// (every store when 0), with whether the user has read each
+func GetNotifications(db *sql.DB, userID, storeID int, unreadOnly bool, limit int) ([]Notification, error) {
+	query := `
+		SELECT n.id, n.store_id, n.stock_alert_id, n.title, COALESCE(n.message, ''), n.created_at, r.user_id IS NOT NULL
+		FROM notifications n
+		LEFT JOIN notification_reads r ON r.notification_id = n.id AND r.user_id = ?
+		WHERE (? = 0 OR n.store_id IS NULL OR n.store_id = ?)`
+	args := []interface{}{userID, storeID, storeID}
+	if unreadOnly {
+		query += " AND r.user_id IS NULL"
+	}
+	query += " ORDER BY n.created_at DESC, n.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		var storeIDValue, alertID sql.NullInt64
+		if err := rows.Scan(&n.ID, &storeIDValue, &alertID, &n.Title, &n.Message, &n.CreatedAt, &n.Read); err != nil {
+			return nil, err
+		}
+		n.StoreID = nullIntPtr(storeIDValue)
+		n.StockAlertID = nullIntPtr(alertID)
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// CountUnreadNotifications counts what GetNotifications would return unread
+func CountUnreadNotifications(db *sql.DB, userID, storeID int) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM notifications n
+		LEFT JOIN notification_reads r ON r.notification_id = n.id AND r.user_id = ?
+		WHERE (? = 0 OR n.store_id IS NULL OR n.store_id = ?) AND r.user_id IS NULL`,
+		userID, storeID, storeID).Scan(&count)
+	return count, err
+}
+
+func MarkNotificationRead(db *sql.DB, id, userID int) error {
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM notifications WHERE id = ?)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %d", ErrNotificationNotFound, id)
+	}
+	_, err := db.Exec(`INSERT IGNORE INTO notification_reads (notification_id, user_id) VALUES (?, ?)`, id, userID)
+	return err
+}
+
+// MarkAllNotificationsRead marks every notification visible in storeID read
+func MarkAllNotificationsRead(db *sql.DB, userID, storeID int) error {
+	_, err := db.Exec(`
+		INSERT IGNORE INTO notification_reads (notification_id, user_id)
+		SELECT n.id, ? FROM notifications n
+		WHERE (? = 0 OR n.store_id IS NULL OR n.store_id = ?)`,
+		userID, storeID, storeID)
+	return err
+}
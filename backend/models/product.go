@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
 	// "image/color"
 	"time"
 )
@@ -11,6 +12,7 @@ type Category struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	IsActive    bool      `json:"is_active"`
+	SortOrder   int       `json:"sort_order"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -19,6 +21,7 @@ type Brand struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	IsActive    bool      `json:"is_active"`
+	SortOrder   int       `json:"sort_order"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -28,6 +31,7 @@ type Subcategory struct {
 	CategoryID  int       `json:"category_id"`
 	Description string    `json:"description"`
 	IsActive    bool      `json:"is_active"`
+	SortOrder   int       `json:"sort_order"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -67,16 +71,31 @@ type ProductVariant struct {
 type ProductWithVariants struct {
 	Product
 	Variants []ProductVariant `json:"variants"`
+	Images   []ProductImage   `json:"images"`
 }
+// UpdateProductVariantTx updates a variant's attributes. Stock is held per
+// store, so current_stock is changed through SetStoreStockTx/AdjustStoreStockTx.
 func UpdateProductVariantTx(tx *sql.Tx, variant *ProductVariant) error {
 	_, err := tx.Exec(`
 		UPDATE product_variants 
-		SET gender=?, size=?, color=?, mrp=?, selling_price=?, cost_price=?, sku=?, barcode=?, current_stock=?, image_url=?
+		SET gender=?, size=?, color=?, mrp=?, selling_price=?, cost_price=?, sku=?, barcode=NULLIF(?, ''), image_url=?
 		WHERE id=?`,
 		variant.Gender, variant.Size, variant.Color, variant.MRP, variant.SellingPrice,
-		variant.CostPrice, variant.SKU, variant.Barcode, variant.CurrentStock, variant.ImageURL, // Add ImageURL
+		variant.CostPrice, variant.SKU, variant.Barcode, variant.ImageURL,
 		variant.ID)
-	return err
+	return variantCodeError(err, variant.SKU, variant.Barcode)
+}
+
+// GetVariantStockTx returns a variant's quantity at storeID, or its total
+// across all stores when storeID is 0
+func GetVariantStockTx(tx *sql.Tx, variantID, storeID int) (int, error) {
+	if storeID != 0 {
+		return GetStoreStockTx(tx, storeID, variantID)
+	}
+
+	var quantity int
+	err := tx.QueryRow(`SELECT current_stock FROM product_variants WHERE id = ?`, variantID).Scan(&quantity)
+	return quantity, err
 }
 func CreateProductTx(tx *sql.Tx, product *Product) error {
 	result, err := tx.Exec(`
@@ -101,11 +120,11 @@ func CreateProductTx(tx *sql.Tx, product *Product) error {
 func CreateProductVariantTx(tx *sql.Tx, variant *ProductVariant) error {
 	result, err := tx.Exec(`
 		INSERT INTO product_variants (product_id, gender, size, color, mrp, selling_price, cost_price, sku, barcode, current_stock, image_url)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)`,
 		variant.ProductID, variant.Gender, variant.Size, variant.Color, variant.MRP, variant.SellingPrice,
 		variant.CostPrice, variant.SKU, variant.Barcode, variant.CurrentStock, variant.ImageURL) // Add ImageURL
 	if err != nil {
-		return err
+		return variantCodeError(err, variant.SKU, variant.Barcode)
 	}
 
 	id, err := result.LastInsertId()
@@ -119,7 +138,7 @@ func CreateProductVariantTx(tx *sql.Tx, variant *ProductVariant) error {
 }
 
 func GetAllCategories(db *sql.DB) ([]Category, error) {
-	rows, err := db.Query("SELECT id, name, description, is_active, created_at FROM categories WHERE is_active = true ORDER BY name")
+	rows, err := db.Query("SELECT id, name, COALESCE(description, ''), is_active, sort_order, created_at FROM categories WHERE is_active = true ORDER BY sort_order, name")
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +147,7 @@ func GetAllCategories(db *sql.DB) ([]Category, error) {
 	var categories []Category
 	for rows.Next() {
 		var cat Category
-		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.IsActive, &cat.CreatedAt); err != nil {
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.IsActive, &cat.SortOrder, &cat.CreatedAt); err != nil {
 			return nil, err
 		}
 		categories = append(categories, cat)
@@ -139,6 +158,9 @@ func GetAllCategories(db *sql.DB) ([]Category, error) {
 func CreateCategory(db *sql.DB, category *Category) error {
 	result, err := db.Exec("INSERT INTO categories (name, description) VALUES (?, ?)", category.Name, category.Description)
 	if err != nil {
+		if isDuplicateKey(err) {
+			return fmt.Errorf("%w: %s", ErrDuplicateName, category.Name)
+		}
 		return err
 	}
 
@@ -153,7 +175,7 @@ func CreateCategory(db *sql.DB, category *Category) error {
 }
 
 func GetAllBrands(db *sql.DB) ([]Brand, error) {
-	rows, err := db.Query("SELECT id, name, description, is_active, created_at FROM brands WHERE is_active = true ORDER BY name")
+	rows, err := db.Query("SELECT id, name, COALESCE(description, ''), is_active, sort_order, created_at FROM brands WHERE is_active = true ORDER BY sort_order, name")
 	if err != nil {
 		return nil, err
 	}
@@ -162,7 +184,7 @@ func GetAllBrands(db *sql.DB) ([]Brand, error) {
 	var brands []Brand
 	for rows.Next() {
 		var brand Brand
-		if err := rows.Scan(&brand.ID, &brand.Name, &brand.Description, &brand.IsActive, &brand.CreatedAt); err != nil {
+		if err := rows.Scan(&brand.ID, &brand.Name, &brand.Description, &brand.IsActive, &brand.SortOrder, &brand.CreatedAt); err != nil {
 			return nil, err
 		}
 		brands = append(brands, brand)
@@ -173,6 +195,9 @@ func GetAllBrands(db *sql.DB) ([]Brand, error) {
 func CreateBrand(db *sql.DB, brand *Brand) error {
 	result, err := db.Exec("INSERT INTO brands (name, description) VALUES (?, ?)", brand.Name, brand.Description)
 	if err != nil {
+		if isDuplicateKey(err) {
+			return fmt.Errorf("%w: %s", ErrDuplicateName, brand.Name)
+		}
 		return err
 	}
 
@@ -187,7 +212,7 @@ func CreateBrand(db *sql.DB, brand *Brand) error {
 }
 
 func GetSubcategoriesByCategory(db *sql.DB, categoryID int) ([]Subcategory, error) {
-	rows, err := db.Query("SELECT id, name, category_id, description, is_active, created_at FROM subcategories WHERE category_id = ? AND is_active = true ORDER BY name", categoryID)
+	rows, err := db.Query("SELECT id, name, category_id, COALESCE(description, ''), is_active, sort_order, created_at FROM subcategories WHERE category_id = ? AND is_active = true ORDER BY sort_order, name", categoryID)
 	if err != nil {
 		return nil, err
 	}
@@ -196,7 +221,7 @@ func GetSubcategoriesByCategory(db *sql.DB, categoryID int) ([]Subcategory, erro
 	var subcategories []Subcategory
 	for rows.Next() {
 		var sub Subcategory
-		if err := rows.Scan(&sub.ID, &sub.Name, &sub.CategoryID, &sub.Description, &sub.IsActive, &sub.CreatedAt); err != nil {
+		if err := rows.Scan(&sub.ID, &sub.Name, &sub.CategoryID, &sub.Description, &sub.IsActive, &sub.SortOrder, &sub.CreatedAt); err != nil {
 			return nil, err
 		}
 		subcategories = append(subcategories, sub)
@@ -208,6 +233,9 @@ func CreateSubcategory(db *sql.DB, subcategory *Subcategory) error {
 	result, err := db.Exec("INSERT INTO subcategories (name, category_id, description) VALUES (?, ?, ?)", 
 		subcategory.Name, subcategory.CategoryID, subcategory.Description)
 	if err != nil {
+		if isDuplicateKey(err) {
+			return fmt.Errorf("%w: %s", ErrDuplicateName, subcategory.Name)
+		}
 		return err
 	}
 
@@ -246,7 +274,7 @@ func CreateProduct(db *sql.DB, product *Product) error {
 func CreateProductVariant(db *sql.DB, variant *ProductVariant) error {
 	result, err := db.Exec(`
 		INSERT INTO product_variants (product_id, gender, size, color, mrp, selling_price, cost_price, sku, barcode, current_stock)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?)`,
 		variant.ProductID, variant.Gender, variant.Size, variant.Color, variant.MRP, variant.SellingPrice,
 		variant.CostPrice, variant.SKU, variant.Barcode, variant.CurrentStock)
 	if err != nil {
@@ -264,11 +292,20 @@ func CreateProductVariant(db *sql.DB, variant *ProductVariant) error {
 }
 
 func GetVariantsByProductID(db *sql.DB, productID int) ([]ProductVariant, error) {
+    return GetStoreVariantsByProductID(db, productID, 0)
+}
+
+// GetStoreVariantsByProductID reports current_stock held at storeID, or the
+// total across all stores when storeID is 0
+func GetStoreVariantsByProductID(db *sql.DB, productID int, storeID int) ([]ProductVariant, error) {
     rows, err := db.Query(`
-        SELECT id, product_id, gender, size, color, mrp, selling_price, cost_price, sku, barcode, current_stock, is_active, image_url
-        FROM product_variants 
-        WHERE product_id = ? AND is_active = true 
-        ORDER BY gender, size, color`, productID)
+        SELECT v.id, v.product_id, v.gender, v.size, v.color, v.mrp, v.selling_price, v.cost_price, v.sku, COALESCE(v.barcode, ''),
+               CASE WHEN ? <> 0 THEN COALESCE(ss.quantity, 0) ELSE v.current_stock END,
+               v.is_active, v.image_url
+        FROM product_variants v
+        LEFT JOIN store_stock ss ON ss.product_variant_id = v.id AND ss.store_id = ?
+        WHERE v.product_id = ? AND v.is_active = true 
+        ORDER BY v.gender, v.size, v.color`, storeID, storeID, productID)
     if err != nil {
         return nil, err
     }
@@ -295,7 +332,10 @@ func GetVariantsByProductID(db *sql.DB, productID int) ([]ProductVariant, error)
     return variants, nil
 }
 
-func GetAllProducts(db *sql.DB) ([]ProductWithVariants, error) {
+// GetAllProducts lists active products; variant stock is scoped to storeID
+// (0 for the total across all stores). Variants are loaded in batches rather
+// than per product.
+func GetAllProducts(db *sql.DB, storeID int) ([]ProductWithVariants, error) {
     rows, err := db.Query(`
         SELECT id, item_id, item_name, category_id, subcategory_id, brand_id, model, 
                description, is_active, low_stock_threshold, created_at, updated_at
@@ -305,7 +345,7 @@ func GetAllProducts(db *sql.DB) ([]ProductWithVariants, error) {
     }
     defer rows.Close()
 
-    var products []ProductWithVariants
+    products := []ProductWithVariants{}
     for rows.Next() {
         var p ProductWithVariants
         var categoryID, subcategoryID, brandID sql.NullInt64
@@ -318,28 +358,10 @@ func GetAllProducts(db *sql.DB) ([]ProductWithVariants, error) {
             return nil, err
         }
         
-        // Handle nullable foreign keys properly
-        if categoryID.Valid {
-            catID := int(categoryID.Int64)
-            p.CategoryID = &catID
-        }
-        if subcategoryID.Valid {
-            subcatID := int(subcategoryID.Int64)
-            p.SubcategoryID = &subcatID
-        }
-        if brandID.Valid {
-            brID := int(brandID.Int64)
-            p.BrandID = &brID
-        }
-        
-        // Get variants for this product
-        variants, err := GetVariantsByProductID(db, p.ID)
-        if err != nil {
-            // Instead of returning error, continue with empty variants
-            p.Variants = []ProductVariant{}
-        } else {
-            p.Variants = variants
-        }
+        p.CategoryID = nullIntPtr(categoryID)
+        p.SubcategoryID = nullIntPtr(subcategoryID)
+        p.BrandID = nullIntPtr(brandID)
+        p.Variants = []ProductVariant{}
         
         products = append(products, p)
     }
@@ -348,7 +370,14 @@ func GetAllProducts(db *sql.DB) ([]ProductWithVariants, error) {
     if err = rows.Err(); err != nil {
         return nil, err
     }
+    rows.Close()
     
+    if err := loadProductVariants(db, products, ProductFilter{StoreID: storeID}); err != nil {
+        return nil, err
+    }
+    if err := loadProductImages(db, products); err != nil {
+        return nil, err
+    }
     return products, nil
 }
 
@@ -386,6 +415,12 @@ func GetProductByID(db *sql.DB, id int) (*ProductWithVariants, error) {
 		return nil, err
 	}
 	p.Variants = variants
+
+	images, err := GetProductImages(db, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	p.Images = images
 	
 	return &p, nil
 }
@@ -394,7 +429,7 @@ func GetProductByID(db *sql.DB, id int) (*ProductWithVariants, error) {
 func UpdateProductVariant(db *sql.DB, variant *ProductVariant) error {
 	_, err := db.Exec(`
 		UPDATE product_variants 
-		SET gender=?, size=?, color=?, mrp=?, selling_price=?, cost_price=?, sku=?, barcode=?, current_stock=?
+		SET gender=?, size=?, color=?, mrp=?, selling_price=?, cost_price=?, sku=?, barcode=NULLIF(?, ''), current_stock=?
 		WHERE id=?`,
 		variant.Gender, variant.Size, variant.Color, variant.MRP, variant.SellingPrice,
 		variant.CostPrice, variant.SKU, variant.Barcode, variant.CurrentStock,
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The benchmarks run GetAllProducts against an in-memory catalogue served
+// through a fake database/sql driver. Each query waits for a simulated
+// network round trip, which is what the per-product variant queries used to
+// multiply.
+
+const (
+	benchProducts  = 5000
+	benchVariants  = 6
+	benchRoundTrip = 50 * time.Microsecond
+)
+
+var benchQueries int64
+
+type catalogueDriver struct{}
+
+func (catalogueDriver) Open(string) (driver.Conn, error) { return catalogueConn{}, nil }
+
+type catalogueConn struct{}
+
+func (catalogueConn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepare not supported")
+}
+func (catalogueConn) Close() error              { return nil }
+func (catalogueConn) Begin() (driver.Tx, error) { return nil, fmt.Errorf("transactions not supported") }
+
+func (catalogueConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	atomic.AddInt64(&benchQueries, 1)
+	time.Sleep(benchRoundTrip)
+
+	if strings.Contains(query, "FROM product_images") {
+		return &memoryRows{columns: make([]string, 8)}, nil
+	}
+	if !strings.Contains(query, "FROM product_variants") {
+		return productRows(), nil
+	}
+
+	// Both the batched and the per-product variant queries take the store
+	// ID twice followed by the product IDs
+	return variantRows(args[2:]), nil
+}
+
+type memoryRows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (r *memoryRows) Columns() []string { return r.columns }
+func (r *memoryRows) Close() error      { return nil }
+
+func (r *memoryRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
+
+func productRows() *memoryRows {
+	rows := &memoryRows{columns: make([]string, 12)}
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for id := 1; id <= benchProducts; id++ {
+		rows.values = append(rows.values, []driver.Value{
+			int64(id), fmt.Sprintf("ITEM%05d", id), fmt.Sprintf("Product %05d", id),
+			int64(1), nil, int64(1), "M1", "", true, int64(5), created, created,
+		})
+	}
+	return rows
+}
+
+func variantRows(productIDs []driver.Value) *memoryRows {
+	rows := &memoryRows{columns: make([]string, 13)}
+	for _, arg := range productIDs {
+		id := arg.(int64)
+		for n := 0; n < benchVariants; n++ {
+			rows.values = append(rows.values, []driver.Value{
+				id*100 + int64(n), id, "unisex", fmt.Sprint(6 + n), "Black",
+				1999.0, 1799.0, 900.0, fmt.Sprintf("SKU-%d-%d", id, n), "", int64(10), true, "",
+			})
+		}
+	}
+	return rows
+}
+
+func init() {
+	sql.Register("catalogue", catalogueDriver{})
+}
+
+func openCatalogue(b *testing.B) *sql.DB {
+	db, err := sql.Open("catalogue", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	return db
+}
+
+// getAllProductsPerProduct is the previous implementation: one variant
+// query per product
+func getAllProductsPerProduct(db *sql.DB, storeID int) ([]ProductWithVariants, error) {
+	rows, err := db.Query(`SELECT id, item_id, item_name, category_id, subcategory_id, brand_id, model,
+		description, is_active, low_stock_threshold, created_at, updated_at FROM products`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []ProductWithVariants
+	for rows.Next() {
+		var p ProductWithVariants
+		var categoryID, subcategoryID, brandID sql.NullInt64
+		if err := rows.Scan(&p.ID, &p.ItemID, &p.ItemName, &categoryID, &subcategoryID, &brandID,
+			&p.Model, &p.Description, &p.IsActive, &p.LowStockThreshold, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		variants, err := GetStoreVariantsByProductID(db, p.ID, storeID)
+		if err != nil {
+			return nil, err
+		}
+		p.Variants = variants
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+func benchmarkCatalogue(b *testing.B, load func(*sql.DB, int) ([]ProductWithVariants, error)) {
+	db := openCatalogue(b)
+	atomic.StoreInt64(&benchQueries, 0)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		products, err := load(db, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(products) != benchProducts || len(products[benchProducts-1].Variants) != benchVariants {
+			b.Fatalf("loaded %d products", len(products))
+		}
+	}
+
+	b.ReportMetric(float64(atomic.LoadInt64(&benchQueries))/float64(b.N), "queries/op")
+}
+
+func BenchmarkGetAllProducts(b *testing.B) {
+	benchmarkCatalogue(b, GetAllProducts)
+}
+
+func BenchmarkGetAllProductsPerProduct(b *testing.B) {
+	benchmarkCatalogue(b, getAllProductsPerProduct)
+}
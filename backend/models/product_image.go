@@ -0,0 +1,350 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Image types; a product and each of its variants have at most one main
+// image
+const (
+	ImageMain      = "main"
+	ImageThumbnail = "thumbnail"
+	ImageGallery   = "gallery"
+)
+
+var (
+	ErrImageNotFound    = errors.New("image not found for this product")
+	ErrInvalidImageType = errors.New("image_type must be main, thumbnail or gallery")
+	ErrImageOrder       = errors.New("ids must list images of this product exactly once")
+)
+
+// ProductImage is one image in a product's gallery. Images with a
+// ProductVariantID belong to that variant; the rest to the product itself.
+type ProductImage struct {
+	ID               int       `json:"id"`
+	ProductID        int       `json:"product_id"`
+	ProductVariantID *int      `json:"product_variant_id"`
+	ImageURL         string    `json:"image_url"`
+	ImageType        string    `json:"image_type"`
+	DisplayOrder     int       `json:"display_order"`
+	UploadedBy       *int      `json:"uploaded_by,omitempty"`
+	UploadedAt       time.Time `json:"uploaded_at"`
+}
+
+func ValidImageType(imageType string) bool {
+	switch imageType {
+	case ImageMain, ImageThumbnail, ImageGallery:
+		return true
+	}
+	return false
+}
+
+const productImageColumns = `
+	id, product_id, product_variant_id, image_url, COALESCE(image_type, 'gallery'),
+	COALESCE(display_order, 0), uploaded_by, uploaded_at`
+
+func scanProductImage(row rowScanner) (ProductImage, error) {
+	var image ProductImage
+	var variantID, uploadedBy sql.NullInt64
+	err := row.Scan(&image.ID, &image.ProductID, &variantID, &image.ImageURL, &image.ImageType,
+		&image.DisplayOrder, &uploadedBy, &image.UploadedAt)
+	image.ProductVariantID = nullIntPtr(variantID)
+	image.UploadedBy = nullIntPtr(uploadedBy)
+	return image, err
+}
+
+// GetProductImages returns the product's images, variant images included,
+// in display order
+func GetProductImages(db *sql.DB, productID int) ([]ProductImage, error) {
+	rows, err := db.Query(`SELECT `+productImageColumns+`
+		FROM product_images WHERE product_id = ?
+		ORDER BY display_order, id`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []ProductImage{}
+	for rows.Next() {
+		image, err := scanProductImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// loadProductImages fills in the image galleries of products, with one
+// query per variantBatchSize products
+func loadProductImages(db *sql.DB, products []ProductWithVariants) error {
+	index := make(map[int]int, len(products))
+	for i := range products {
+		products[i].Images = []ProductImage{}
+		index[products[i].ID] = i
+	}
+
+	for start := 0; start < len(products); start += variantBatchSize {
+		end := start + variantBatchSize
+		if end > len(products) {
+			end = len(products)
+		}
+
+		args := make([]interface{}, 0, end-start)
+		for _, p := range products[start:end] {
+			args = append(args, p.ID)
+		}
+		rows, err := db.Query(`SELECT `+productImageColumns+`
+			FROM product_images WHERE product_id IN (`+placeholders(len(args))+`)
+			ORDER BY product_id, display_order, id`, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			image, err := scanProductImage(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if i, ok := index[image.ProductID]; ok {
+				products[i].Images = append(products[i].Images, image)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getProductImageTx(tx *sql.Tx, productID, imageID int) (ProductImage, error) {
+	image, err := scanProductImage(tx.QueryRow(`SELECT `+productImageColumns+`
+		FROM product_images WHERE id = ? AND product_id = ? FOR UPDATE`, imageID, productID))
+	if err == sql.ErrNoRows {
+		return image, fmt.Errorf("%w: %d", ErrImageNotFound, imageID)
+	}
+	return image, err
+}
+
+// imageScope is the WHERE fragment selecting the images that share a main
+// image with one belonging to variantID (nil for the product itself)
+func imageScope(productID int, variantID *int) (string, []interface{}) {
+	if variantID == nil {
+		return `product_id = ? AND product_variant_id IS NULL`, []interface{}{productID}
+	}
+	return `product_id = ? AND product_variant_id = ?`, []interface{}{productID, *variantID}
+}
+
+// AddProductImageTx appends an image to the end of the product's gallery.
+// An image added without a type becomes the main image of the product or
+// variant when it has none yet, and a gallery image otherwise; an explicit
+// type is kept, and type main replaces the current main image.
+func AddProductImageTx(tx *sql.Tx, image *ProductImage) error {
+	defaultType := image.ImageType == ""
+	if defaultType {
+		image.ImageType = ImageGallery
+	}
+	if !ValidImageType(image.ImageType) {
+		return ErrInvalidImageType
+	}
+
+	if image.ProductVariantID != nil {
+		var exists bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM product_variants WHERE id = ? AND product_id = ? AND is_active = true)`,
+			*image.ProductVariantID, image.ProductID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: %d", ErrVariantNotFound, *image.ProductVariantID)
+		}
+	}
+
+	if defaultType {
+		scope, args := imageScope(image.ProductID, image.ProductVariantID)
+		var hasMain bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM product_images WHERE `+scope+` AND image_type = 'main')`,
+			args...).Scan(&hasMain); err != nil {
+			return err
+		}
+		if !hasMain {
+			image.ImageType = ImageMain
+		}
+	}
+
+	if err := tx.QueryRow(`
+		SELECT COALESCE(MAX(display_order), -1) + 1 FROM product_images WHERE product_id = ?`,
+		image.ProductID).Scan(&image.DisplayOrder); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO product_images (product_id, product_variant_id, image_url, image_type, display_order, uploaded_by)
+		VALUES (?, ?, ?, 'gallery', ?, ?)`,
+		image.ProductID, image.ProductVariantID, image.ImageURL, image.DisplayOrder, image.UploadedBy)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	image.ID = int(id)
+	image.UploadedAt = time.Now()
+
+	if image.ImageType == ImageMain {
+		return setMainImageTx(tx, *image)
+	}
+	_, err = tx.Exec(`UPDATE product_images SET image_type = ? WHERE id = ?`, image.ImageType, image.ID)
+	return err
+}
+
+// SetMainProductImageTx makes an image the main image of the product, or of
+// its variant, demoting the previous main image to the gallery
+func SetMainProductImageTx(tx *sql.Tx, productID, imageID int) (ProductImage, error) {
+	image, err := getProductImageTx(tx, productID, imageID)
+	if err != nil {
+		return image, err
+	}
+	image.ImageType = ImageMain
+	return image, setMainImageTx(tx, image)
+}
+
+func setMainImageTx(tx *sql.Tx, image ProductImage) error {
+	scope, args := imageScope(image.ProductID, image.ProductVariantID)
+	if _, err := tx.Exec(`UPDATE product_images SET image_type = 'gallery' WHERE `+scope+` AND image_type = 'main'`,
+		args...); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE product_images SET image_type = 'main' WHERE id = ?`, image.ID); err != nil {
+		return err
+	}
+	return syncVariantImageTx(tx, image.ProductID, image.ProductVariantID)
+}
+
+// syncVariantImageTx copies a variant's main image to
+// product_variants.image_url, clearing it when the variant has none
+func syncVariantImageTx(tx *sql.Tx, productID int, variantID *int) error {
+	if variantID == nil {
+		return nil
+	}
+	_, err := tx.Exec(`
+		UPDATE product_variants v
+		SET v.image_url = COALESCE((
+			SELECT i.image_url FROM product_images i
+			WHERE i.product_id = ? AND i.product_variant_id = v.id AND i.image_type = 'main'
+			LIMIT 1), '')
+		WHERE v.id = ?`, productID, *variantID)
+	return err
+}
+
+// ReorderProductImagesTx sets the display order of all of a product's
+// images from ids, which must list each of them once. The caller locks the
+// product first (LockProductTx) so concurrent uploads cannot slip an image
+// past the check.
+func ReorderProductImagesTx(tx *sql.Tx, productID int, ids []int) error {
+	rows, err := tx.Query(`SELECT id FROM product_images WHERE product_id = ? FOR UPDATE`, productID)
+	if err != nil {
+		return err
+	}
+	existing := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[id] = true
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	if len(ids) != len(existing) {
+		return ErrImageOrder
+	}
+	for _, id := range ids {
+		if !existing[id] {
+			return fmt.Errorf("%w: %d", ErrImageOrder, id)
+		}
+		delete(existing, id)
+	}
+
+	for position, id := range ids {
+		if _, err := tx.Exec(`UPDATE product_images SET display_order = ? WHERE id = ?`, position, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteProductImageTx removes an image and returns it. When it was a main
+// image, the next image in display order of the same product or variant
+// takes its place.
+func DeleteProductImageTx(tx *sql.Tx, productID, imageID int) (ProductImage, error) {
+	image, err := getProductImageTx(tx, productID, imageID)
+	if err != nil {
+		return image, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM product_images WHERE id = ?`, imageID); err != nil {
+		return image, err
+	}
+	if image.ImageType != ImageMain {
+		return image, nil
+	}
+
+	scope, args := imageScope(productID, image.ProductVariantID)
+	next, err := scanProductImage(tx.QueryRow(`SELECT `+productImageColumns+`
+		FROM product_images WHERE `+scope+`
+		ORDER BY display_order, id LIMIT 1`, args...))
+	if err == sql.ErrNoRows {
+		return image, syncVariantImageTx(tx, productID, image.ProductVariantID)
+	}
+	if err != nil {
+		return image, err
+	}
+	return image, setMainImageTx(tx, next)
+}
+
+// FileURLInUse reports whether a variant or product image still points at
+// fileURL
+func FileURLInUse(db *sql.DB, fileURL string) (bool, error) {
+	var inUse bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM product_variants WHERE image_url = ?)
+		    OR EXISTS (SELECT 1 FROM product_images WHERE image_url = ?)`,
+		fileURL, fileURL).Scan(&inUse)
+	return inUse, err
+}
+
+// GetReferencedFileURLs returns every file URL a variant or product image
+// points at
+func GetReferencedFileURLs(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query(`
+		SELECT image_url FROM product_variants WHERE image_url IS NOT NULL AND image_url <> ''
+		UNION
+		SELECT image_url FROM product_images`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := map[string]bool{}
+	for rows.Next() {
+		var fileURL string
+		if err := rows.Scan(&fileURL); err != nil {
+			return nil, err
+		}
+		urls[fileURL] = true
+	}
+	return urls, rows.Err()
+}
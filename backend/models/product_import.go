@@ -0,0 +1,68 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// ImportLookup resolves the category, subcategory and brand names used in a
+// product import to the IDs of active rows. Names match case-insensitively.
+type ImportLookup struct {
+	Categories    map[string]int
+	Subcategories map[int]map[string]int // by category ID
+	Brands        map[string]int
+}
+
+func LoadImportLookupTx(tx *sql.Tx) (*ImportLookup, error) {
+	lookup := &ImportLookup{
+		Categories:    map[string]int{},
+		Subcategories: map[int]map[string]int{},
+		Brands:        map[string]int{},
+	}
+
+	for table, names := range map[string]map[string]int{
+		"categories": lookup.Categories,
+		"brands":     lookup.Brands,
+	} {
+		rows, err := tx.Query(`SELECT id, name FROM ` + table + ` WHERE is_active = true`)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			names[ImportKey(name)] = id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.Query(`SELECT id, category_id, name FROM subcategories WHERE is_active = true AND category_id IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, categoryID int
+		var name string
+		if err := rows.Scan(&id, &categoryID, &name); err != nil {
+			return nil, err
+		}
+		if lookup.Subcategories[categoryID] == nil {
+			lookup.Subcategories[categoryID] = map[string]int{}
+		}
+		lookup.Subcategories[categoryID][ImportKey(name)] = id
+	}
+	return lookup, rows.Err()
+}
+
+// ImportKey normalises a name for lookup: trimmed, lower-case, single spaces
+func ImportKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
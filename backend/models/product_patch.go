@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrProductModified = errors.New("product was modified by someone else")
+
+// ProductPatchColumns are the products columns a merge patch may set
+var ProductPatchColumns = map[string]bool{
+	"item_id":             true,
+	"item_name":           true,
+	"category_id":         true,
+	"subcategory_id":      true,
+	"brand_id":            true,
+	"model":               true,
+	"description":         true,
+	"low_stock_threshold": true,
+	"is_active":           true,
+}
+
+// LockProductTx locks a product row (active or not) and returns its
+// updated_at, which doubles as its version for optimistic concurrency
+func LockProductTx(tx *sql.Tx, id int) (time.Time, error) {
+	var updatedAt time.Time
+	err := tx.QueryRow(`SELECT updated_at FROM products WHERE id = ? FOR UPDATE`, id).Scan(&updatedAt)
+	return updatedAt, err
+}
+
+// PatchProductTx sets only the given columns and bumps updated_at. A nil
+// value stores NULL. Columns outside ProductPatchColumns are ignored.
+// Changing low_stock_threshold or is_active re-evaluates stock alerts.
+func PatchProductTx(tx *sql.Tx, id int, fields map[string]interface{}) error {
+	columns := make([]string, 0, len(fields))
+	for column := range fields {
+		if ProductPatchColumns[column] {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+
+	sets := []string{"updated_at = NOW(6)"}
+	var args []interface{}
+	for _, column := range columns {
+		sets = append(sets, column+" = ?")
+		args = append(args, fields[column])
+	}
+	args = append(args, id)
+
+	if _, err := tx.Exec(`UPDATE products SET `+strings.Join(sets, ", ")+` WHERE id = ?`, args...); err != nil {
+		return err
+	}
+
+	_, thresholdChanged := fields["low_stock_threshold"]
+	_, activeChanged := fields["is_active"]
+	if thresholdChanged || activeChanged {
+		return EvaluateProductStockAlertsTx(tx, id)
+	}
+	return nil
+}
+
+// TouchProductTx bumps updated_at after a change to the product's variants
+// so clients holding the old version see the conflict
+func TouchProductTx(tx *sql.Tx, id int) error {
+	_, err := tx.Exec(`UPDATE products SET updated_at = NOW(6) WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,326 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Largest page GET /products will return
+const MaxProductPageSize = 200
+
+// ProductSorts maps the sort names GET /products accepts to the expression
+// ordered by; prefix a name with "-" to sort descending
+var ProductSorts = map[string]string{
+	"name":       "p.item_name",
+	"item_id":    "p.item_id",
+	"created_at": "p.created_at",
+	"updated_at": "p.updated_at",
+	"price":      "COALESCE(pr.min_price, 0)",
+}
+
+// ProductFilter narrows a product listing. Gender, size, color, price and
+// in-stock filters apply to variants: a product matches when at least one
+// active variant does, and only the matching variants are returned.
+type ProductFilter struct {
+	StoreID       int
+	Search        string
+	CategoryID    int
+	SubcategoryID int
+	BrandID       int
+	Gender        string
+	Size          string
+	Color         string
+	MinPrice      *float64
+	MaxPrice      *float64
+	InStock       bool
+
+	Sort string
+	// Page (1-based) or Cursor select the page; neither with PageSize 0
+	// returns every match
+	Page     int
+	PageSize int
+	Cursor   string
+}
+
+// ProductPage is one page of a product listing
+type ProductPage struct {
+	Products   []ProductWithVariants
+	Total      int
+	NextCursor string
+}
+
+type productCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// hasVariantFilter reports whether any filter applies to variants
+func (f ProductFilter) hasVariantFilter() bool {
+	return f.Gender != "" || f.Size != "" || f.Color != "" || f.MinPrice != nil || f.MaxPrice != nil || f.InStock
+}
+
+// variantConditions returns the SQL conditions on product_variants v for the
+// variant filters
+func (f ProductFilter) variantConditions() (string, []interface{}) {
+	conditions := "v.is_active = true"
+	var args []interface{}
+
+	if f.Gender != "" {
+		conditions += " AND v.gender = ?"
+		args = append(args, f.Gender)
+	}
+	if f.Size != "" {
+		conditions += " AND v.size = ?"
+		args = append(args, f.Size)
+	}
+	if f.Color != "" {
+		conditions += " AND LOWER(v.color) = LOWER(?)"
+		args = append(args, f.Color)
+	}
+	if f.MinPrice != nil {
+		conditions += " AND v.selling_price >= ?"
+		args = append(args, *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		conditions += " AND v.selling_price <= ?"
+		args = append(args, *f.MaxPrice)
+	}
+	if f.InStock {
+		conditions += ` AND ((? = 0 AND v.current_stock > 0) OR EXISTS (
+			SELECT 1 FROM store_stock ss WHERE ss.product_variant_id = v.id AND ss.store_id = ? AND ss.quantity > 0))`
+		args = append(args, f.StoreID, f.StoreID)
+	}
+	return conditions, args
+}
+
+// SearchProducts lists active products matching filter. Search matches
+// item_name, item_id and model by substring and variant SKU and barcode by
+// prefix. Variant stock is scoped to filter.StoreID as in GetAllProducts.
+func SearchProducts(db *sql.DB, filter ProductFilter) (*ProductPage, error) {
+	sortName := strings.TrimPrefix(filter.Sort, "-")
+	if sortName == "" {
+		sortName = "name"
+	}
+	sortExpr, ok := ProductSorts[sortName]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q", filter.Sort)
+	}
+	descending := strings.HasPrefix(filter.Sort, "-")
+
+	from := `
+		FROM products p
+		LEFT JOIN (
+			SELECT product_id, MIN(selling_price) AS min_price
+			FROM product_variants WHERE is_active = true GROUP BY product_id
+		) pr ON pr.product_id = p.id`
+	where := " WHERE p.is_active = true"
+	var args []interface{}
+
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		like := "%" + escapeLike(search) + "%"
+		prefix := escapeLike(search) + "%"
+		where += ` AND (p.item_name LIKE ? OR p.item_id LIKE ? OR p.model LIKE ? OR EXISTS (
+			SELECT 1 FROM product_variants sv
+			WHERE sv.product_id = p.id AND sv.is_active = true AND (sv.sku LIKE ? OR sv.barcode LIKE ?)))`
+		args = append(args, like, like, like, prefix, prefix)
+	}
+	if filter.CategoryID > 0 {
+		where += " AND p.category_id = ?"
+		args = append(args, filter.CategoryID)
+	}
+	if filter.SubcategoryID > 0 {
+		where += " AND p.subcategory_id = ?"
+		args = append(args, filter.SubcategoryID)
+	}
+	if filter.BrandID > 0 {
+		where += " AND p.brand_id = ?"
+		args = append(args, filter.BrandID)
+	}
+	if filter.hasVariantFilter() {
+		conditions, variantArgs := filter.variantConditions()
+		where += " AND EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.id AND " + conditions + ")"
+		args = append(args, variantArgs...)
+	}
+
+	page := &ProductPage{}
+	if err := db.QueryRow(`SELECT COUNT(*)`+from+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	// Keyset condition for cursor pages; ties on the sort value are broken
+	// by id in the same direction
+	pageWhere := where
+	pageArgs := append([]interface{}{}, args...)
+	if filter.Cursor != "" {
+		cursor, err := decodeProductCursor(filter.Cursor)
+		if err != nil || cursor.Sort != filter.Sort {
+			return nil, ErrInvalidCursor
+		}
+		op := ">"
+		if descending {
+			op = "<"
+		}
+		pageWhere += fmt.Sprintf(" AND (%s %s ? OR (%s = ? AND p.id %s ?))", sortExpr, op, sortExpr, op)
+		pageArgs = append(pageArgs, cursor.Value, cursor.Value, cursor.ID)
+	}
+
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+	query := `
+		SELECT p.id, p.item_id, p.item_name, p.category_id, p.subcategory_id, p.brand_id, p.model,
+		       p.description, p.is_active, p.low_stock_threshold, p.created_at, p.updated_at,
+		       CAST(` + sortExpr + ` AS CHAR)` + from + pageWhere +
+		fmt.Sprintf(" ORDER BY %s %s, p.id %s", sortExpr, direction, direction)
+
+	// One row past the page tells whether there is a next one
+	if filter.PageSize > 0 {
+		query += " LIMIT ?"
+		pageArgs = append(pageArgs, filter.PageSize+1)
+		if filter.Cursor == "" && filter.Page > 1 {
+			query += " OFFSET ?"
+			pageArgs = append(pageArgs, (filter.Page-1)*filter.PageSize)
+		}
+	}
+
+	rows, err := db.Query(query, pageArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page.Products = []ProductWithVariants{}
+	var last productCursor
+	more := false
+	for rows.Next() {
+		if filter.PageSize > 0 && len(page.Products) == filter.PageSize {
+			more = true
+			break
+		}
+
+		var p ProductWithVariants
+		var categoryID, subcategoryID, brandID sql.NullInt64
+		var sortValue sql.NullString
+		if err := rows.Scan(
+			&p.ID, &p.ItemID, &p.ItemName, &categoryID, &subcategoryID, &brandID,
+			&p.Model, &p.Description, &p.IsActive, &p.LowStockThreshold,
+			&p.CreatedAt, &p.UpdatedAt, &sortValue,
+		); err != nil {
+			return nil, err
+		}
+		p.CategoryID = nullIntPtr(categoryID)
+		p.SubcategoryID = nullIntPtr(subcategoryID)
+		p.BrandID = nullIntPtr(brandID)
+		p.Variants = []ProductVariant{}
+
+		page.Products = append(page.Products, p)
+		last = productCursor{Sort: filter.Sort, Value: sortValue.String, ID: p.ID}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := loadProductVariants(db, page.Products, filter); err != nil {
+		return nil, err
+	}
+	if err := loadProductImages(db, page.Products); err != nil {
+		return nil, err
+	}
+
+	if more {
+		page.NextCursor = encodeProductCursor(last)
+	}
+	return page, nil
+}
+
+// Products whose variants are fetched per query; keeps the IN list well
+// under MySQL's placeholder limit
+const variantBatchSize = 1000
+
+// loadProductVariants fills in the variants of products, applying the
+// filter's variant conditions, with one query per variantBatchSize products
+func loadProductVariants(db *sql.DB, products []ProductWithVariants, filter ProductFilter) error {
+	index := make(map[int]int, len(products))
+	for i, p := range products {
+		index[p.ID] = i
+	}
+
+	for start := 0; start < len(products); start += variantBatchSize {
+		end := start + variantBatchSize
+		if end > len(products) {
+			end = len(products)
+		}
+		if err := loadVariantBatch(db, products, products[start:end], index, filter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadVariantBatch(db *sql.DB, products, batch []ProductWithVariants, index map[int]int, filter ProductFilter) error {
+	placeholders := make([]string, len(batch))
+	args := []interface{}{filter.StoreID, filter.StoreID}
+	for i, p := range batch {
+		placeholders[i] = "?"
+		args = append(args, p.ID)
+	}
+
+	conditions, variantArgs := filter.variantConditions()
+	args = append(args, variantArgs...)
+
+	rows, err := db.Query(`
+		SELECT v.id, v.product_id, v.gender, v.size, v.color, v.mrp, v.selling_price, v.cost_price, v.sku, COALESCE(v.barcode, ''),
+		       CASE WHEN ? <> 0 THEN COALESCE(ss.quantity, 0) ELSE v.current_stock END,
+		       v.is_active, v.image_url
+		FROM product_variants v
+		LEFT JOIN store_stock ss ON ss.product_variant_id = v.id AND ss.store_id = ?
+		WHERE v.product_id IN (`+strings.Join(placeholders, ", ")+`) AND `+conditions+`
+		ORDER BY v.product_id, v.gender, v.size, v.color`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var variant ProductVariant
+		if err := rows.Scan(
+			&variant.ID, &variant.ProductID, &variant.Gender, &variant.Size, &variant.Color,
+			&variant.MRP, &variant.SellingPrice, &variant.CostPrice,
+			&variant.SKU, &variant.Barcode, &variant.CurrentStock, &variant.IsActive, &variant.ImageURL,
+		); err != nil {
+			return err
+		}
+		if i, ok := index[variant.ProductID]; ok {
+			products[i].Variants = append(products[i].Variants, variant)
+		}
+	}
+	return rows.Err()
+}
+
+func encodeProductCursor(cursor productCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeProductCursor(value string) (productCursor, error) {
+	var cursor productCursor
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(raw, &cursor) != nil || cursor.ID <= 0 {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// escapeLike escapes the LIKE wildcards in a user-supplied search term
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// FieldError points a validation failure at one request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"error"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ProductRefs are the product fields that reference other tables
+type ProductRefs struct {
+	ItemID        string
+	CategoryID    *int
+	SubcategoryID *int
+	BrandID       *int
+}
+
+// GetProductRefsTx reads a product's current references, for validating a
+// partial update against the values it leaves untouched
+func GetProductRefsTx(tx *sql.Tx, productID int) (ProductRefs, error) {
+	var refs ProductRefs
+	var categoryID, subcategoryID, brandID sql.NullInt64
+	err := tx.QueryRow(`SELECT item_id, category_id, subcategory_id, brand_id FROM products WHERE id = ?`, productID).
+		Scan(&refs.ItemID, &categoryID, &subcategoryID, &brandID)
+	refs.CategoryID = nullIntPtr(categoryID)
+	refs.SubcategoryID = nullIntPtr(subcategoryID)
+	refs.BrandID = nullIntPtr(brandID)
+	return refs, err
+}
+
+// ValidateProductRefsTx checks that item_id is free (ignoring productID
+// itself) and that the category, subcategory and brand exist and are
+// active, with the subcategory belonging to the category. It returns the
+// first problem as a *FieldError; other errors are database failures.
+func ValidateProductRefsTx(tx *sql.Tx, productID int, refs ProductRefs) error {
+	if refs.ItemID != "" {
+		var taken bool
+		if err := tx.QueryRow(`SELECT COUNT(*) > 0 FROM products WHERE item_id = ? AND id <> ?`,
+			refs.ItemID, productID).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			return &FieldError{"item_id", fmt.Sprintf("item_id %s is already used by another product", refs.ItemID)}
+		}
+	}
+
+	if refs.CategoryID != nil {
+		if err := checkActiveRefTx(tx, "categories", "category_id", *refs.CategoryID); err != nil {
+			return err
+		}
+	}
+
+	if refs.SubcategoryID != nil {
+		var categoryID sql.NullInt64
+		var active bool
+		err := tx.QueryRow(`SELECT category_id, is_active FROM subcategories WHERE id = ?`, *refs.SubcategoryID).
+			Scan(&categoryID, &active)
+		if err == sql.ErrNoRows {
+			return &FieldError{"subcategory_id", fmt.Sprintf("subcategory %d does not exist", *refs.SubcategoryID)}
+		}
+		if err != nil {
+			return err
+		}
+		if !active {
+			return &FieldError{"subcategory_id", fmt.Sprintf("subcategory %d is inactive", *refs.SubcategoryID)}
+		}
+		if refs.CategoryID == nil {
+			return &FieldError{"subcategory_id", "subcategory_id requires category_id"}
+		}
+		if !categoryID.Valid || int(categoryID.Int64) != *refs.CategoryID {
+			return &FieldError{"subcategory_id", fmt.Sprintf("subcategory %d does not belong to category %d", *refs.SubcategoryID, *refs.CategoryID)}
+		}
+	}
+
+	if refs.BrandID != nil {
+		if err := checkActiveRefTx(tx, "brands", "brand_id", *refs.BrandID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkActiveRefTx reports a FieldError unless table has an active row id.
+// table is always a constant from this file.
+func checkActiveRefTx(tx *sql.Tx, table, field string, id int) error {
+	var active bool
+	err := tx.QueryRow(`SELECT is_active FROM `+table+` WHERE id = ?`, id).Scan(&active)
+	if err == sql.ErrNoRows {
+		return &FieldError{field, fmt.Sprintf("%s %d does not exist", field, id)}
+	}
+	if err != nil {
+		return err
+	}
+	if !active {
+		return &FieldError{field, fmt.Sprintf("%s %d is inactive", field, id)}
+	}
+	return nil
+}
+
+// NormalizeRef turns the 0 some clients send for "none" into nil
+func NormalizeRef(id *int) *int {
+	if id == nil || *id <= 0 {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,355 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	PurchaseOrderDraft     = "draft"
+	PurchaseOrderOrdered   = "ordered"
+	PurchaseOrderReceived  = "received"
+	PurchaseOrderCancelled = "cancelled"
+)
+
+var ErrPurchaseOrderState = errors.New("purchase order is not in a state that allows this action")
+
+type PurchaseOrder struct {
+	ID           int                 `json:"id"`
+	PONumber     string              `json:"po_number"`
+	SupplierID   int                 `json:"supplier_id"`
+	SupplierName string              `json:"supplier_name"`
+	StoreID      int                 `json:"store_id"`
+	StoreName    string              `json:"store_name"`
+	Status       string              `json:"status"`
+	Notes        string              `json:"notes"`
+	CreatedBy    *int                `json:"created_by,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+	TotalCost    float64             `json:"total_cost"`
+	Items        []PurchaseOrderItem `json:"items,omitempty"`
+}
+
+type PurchaseOrderItem struct {
+	ID               int     `json:"id"`
+	PurchaseOrderID  int     `json:"purchase_order_id"`
+	ProductVariantID int     `json:"product_variant_id"`
+	SKU              string  `json:"sku"`
+	ItemName         string  `json:"item_name"`
+	Size             string  `json:"size"`
+	Color            string  `json:"color"`
+	Quantity         int     `json:"quantity"`
+	UnitCost         float64 `json:"unit_cost"`
+}
+
+// SkippedSuggestion is a suggestion left out of the generated orders
+type SkippedSuggestion struct {
+	ProductVariantID int    `json:"product_variant_id"`
+	SKU              string `json:"sku"`
+	Reason           string `json:"reason"`
+}
+
+// CreatePurchaseOrderTx inserts a purchase order with its items, numbering
+// it PO-<id>
+func CreatePurchaseOrderTx(tx *sql.Tx, order *PurchaseOrder) error {
+	if order.Status == "" {
+		order.Status = PurchaseOrderDraft
+	}
+	result, err := tx.Exec(`
+		INSERT INTO purchase_orders (po_number, supplier_id, store_id, status, notes, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		fmt.Sprintf("PO-%d", time.Now().UnixNano()), order.SupplierID, order.StoreID,
+		order.Status, order.Notes, order.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	// Readable number derived from the id, replacing the placeholder above
+	order.ID = int(id)
+	order.PONumber = fmt.Sprintf("PO-%06d", id)
+	if _, err := tx.Exec(`UPDATE purchase_orders SET po_number = ? WHERE id = ?`, order.PONumber, id); err != nil {
+		return err
+	}
+
+	order.TotalCost = 0
+	for i := range order.Items {
+		item := &order.Items[i]
+		result, err := tx.Exec(`
+			INSERT INTO purchase_order_items (purchase_order_id, product_variant_id, quantity, unit_cost)
+			VALUES (?, ?, ?, ?)`,
+			order.ID, item.ProductVariantID, item.Quantity, item.UnitCost)
+		if err != nil {
+			return err
+		}
+		itemID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		item.ID = int(itemID)
+		item.PurchaseOrderID = order.ID
+		order.TotalCost += item.UnitCost * float64(item.Quantity)
+	}
+	order.TotalCost = math.Round(order.TotalCost*100) / 100
+	return nil
+}
+
+// CreatePurchaseOrdersFromSuggestions turns reorder suggestions into one
+// draft purchase order per supplier for storeID. Suggestions without a
+// supplier or with a non-positive quantity are skipped and reported.
+func CreatePurchaseOrdersFromSuggestions(db *sql.DB, storeID, userID int, notes string, suggestions []ReorderSuggestion) ([]PurchaseOrder, []SkippedSuggestion, error) {
+	var skipped []SkippedSuggestion
+	bySupplier := map[int]*PurchaseOrder{}
+	for _, s := range suggestions {
+		switch {
+		case s.SupplierID == nil:
+			skipped = append(skipped, SkippedSuggestion{s.ProductVariantID, s.SKU, "no supplier for this variant"})
+			continue
+		case s.SuggestedQuantity <= 0:
+			skipped = append(skipped, SkippedSuggestion{s.ProductVariantID, s.SKU, "quantity must be positive"})
+			continue
+		}
+
+		order, ok := bySupplier[*s.SupplierID]
+		if !ok {
+			order = &PurchaseOrder{
+				SupplierID:   *s.SupplierID,
+				SupplierName: s.SupplierName,
+				StoreID:      storeID,
+				Status:       PurchaseOrderDraft,
+				Notes:        notes,
+				CreatedBy:    &userID,
+			}
+			bySupplier[*s.SupplierID] = order
+		}
+		order.Items = append(order.Items, PurchaseOrderItem{
+			ProductVariantID: s.ProductVariantID,
+			SKU:              s.SKU,
+			ItemName:         s.ItemName,
+			Size:             s.Size,
+			Color:            s.Color,
+			Quantity:         s.SuggestedQuantity,
+			UnitCost:         s.UnitCost,
+		})
+	}
+
+	orders := make([]PurchaseOrder, 0, len(bySupplier))
+	for _, order := range bySupplier {
+		orders = append(orders, *order)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].SupplierName < orders[j].SupplierName })
+	if len(orders) == 0 {
+		return orders, skipped, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range orders {
+		if err := CreatePurchaseOrderTx(tx, &orders[i]); err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return orders, skipped, nil
+}
+
+const purchaseOrderSelect = `
+	SELECT po.id, po.po_number, po.supplier_id, sup.name, po.store_id, st.name, po.status,
+	       COALESCE(po.notes, ''), po.created_by, po.created_at,
+	       COALESCE((SELECT SUM(poi.quantity * poi.unit_cost) FROM purchase_order_items poi WHERE poi.purchase_order_id = po.id), 0)
+	FROM purchase_orders po
+	JOIN suppliers sup ON sup.id = po.supplier_id
+	JOIN stores st ON st.id = po.store_id`
+
+func scanPurchaseOrder(row rowScanner) (*PurchaseOrder, error) {
+	var order PurchaseOrder
+	var createdBy sql.NullInt64
+	if err := row.Scan(&order.ID, &order.PONumber, &order.SupplierID, &order.SupplierName, &order.StoreID, &order.StoreName,
+		&order.Status, &order.Notes, &createdBy, &order.CreatedAt, &order.TotalCost); err != nil {
+		return nil, err
+	}
+	order.CreatedBy = nullIntPtr(createdBy)
+	return &order, nil
+}
+
+// GetPurchaseOrders lists the purchase orders of storeID, or of every store
+// when storeID is 0
+func GetPurchaseOrders(db *sql.DB, storeID int, status string) ([]PurchaseOrder, error) {
+	query := purchaseOrderSelect + ` WHERE (? = 0 OR po.store_id = ?)`
+	args := []interface{}{storeID, storeID}
+	if status != "" {
+		query += " AND po.status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY po.created_at DESC, po.id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []PurchaseOrder
+	for rows.Next() {
+		order, err := scanPurchaseOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *order)
+	}
+	return orders, rows.Err()
+}
+
+func GetPurchaseOrderByID(db *sql.DB, id int) (*PurchaseOrder, error) {
+	order, err := scanPurchaseOrder(db.QueryRow(purchaseOrderSelect+" WHERE po.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT poi.id, poi.purchase_order_id, poi.product_variant_id, COALESCE(v.sku, ''), p.item_name, v.size, COALESCE(v.color, ''),
+		       poi.quantity, poi.unit_cost
+		FROM purchase_order_items poi
+		JOIN product_variants v ON v.id = poi.product_variant_id
+		JOIN products p ON p.id = v.product_id
+		WHERE poi.purchase_order_id = ?
+		ORDER BY poi.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item PurchaseOrderItem
+		if err := rows.Scan(&item.ID, &item.PurchaseOrderID, &item.ProductVariantID, &item.SKU, &item.ItemName, &item.Size, &item.Color,
+			&item.Quantity, &item.UnitCost); err != nil {
+			return nil, err
+		}
+		order.Items = append(order.Items, item)
+	}
+	return order, rows.Err()
+}
+
+// MarkPurchaseOrderOrdered records that a draft has been sent to its supplier
+func MarkPurchaseOrderOrdered(db *sql.DB, id int) error {
+	return setPurchaseOrderStatus(db, id, PurchaseOrderOrdered, PurchaseOrderDraft)
+}
+
+// CancelPurchaseOrder drops an order that has not been received, so it no
+// longer counts as on order
+func CancelPurchaseOrder(db *sql.DB, id int) error {
+	return setPurchaseOrderStatus(db, id, PurchaseOrderCancelled, PurchaseOrderDraft, PurchaseOrderOrdered)
+}
+
+func setPurchaseOrderStatus(db *sql.DB, id int, status string, from ...string) error {
+	args := []interface{}{status, id}
+	for _, s := range from {
+		args = append(args, s)
+	}
+	result, err := db.Exec(`UPDATE purchase_orders SET status = ? WHERE id = ? AND status IN (`+placeholders(len(from))+`)`, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPurchaseOrderState
+	}
+	return nil
+}
+
+// ReceivePurchaseOrder books an ordered purchase order into its store: each
+// line becomes a stock entry at its unit cost, adding the quantity to the
+// store's stock, and the order is marked received.
+func ReceivePurchaseOrder(db *sql.DB, id, userID int, billNumber string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var poNumber, status, supplierName, supplierPhone string
+	var storeID int
+	err = tx.QueryRow(`
+		SELECT po.po_number, po.status, po.store_id, sup.name, COALESCE(sup.phone, '')
+		FROM purchase_orders po
+		JOIN suppliers sup ON sup.id = po.supplier_id
+		WHERE po.id = ? FOR UPDATE`, id).
+		Scan(&poNumber, &status, &storeID, &supplierName, &supplierPhone)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if status != PurchaseOrderOrdered {
+		tx.Rollback()
+		return ErrPurchaseOrderState
+	}
+	if billNumber == "" {
+		billNumber = poNumber
+	}
+
+	rows, err := tx.Query(`
+		SELECT v.product_id, poi.product_variant_id, poi.quantity, poi.unit_cost,
+		       COALESCE(v.mrp, 0), COALESCE(v.selling_price, 0)
+		FROM purchase_order_items poi
+		JOIN product_variants v ON v.id = poi.product_variant_id
+		WHERE poi.purchase_order_id = ?
+		ORDER BY poi.id`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var entries []StockEntry
+	for rows.Next() {
+		var entry StockEntry
+		var variantID int
+		if err := rows.Scan(&entry.ProductID, &variantID, &entry.PurchaseQuantity, &entry.PurchasePrice,
+			&entry.MRP, &entry.SellingPrice); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		entry.ProductVariantID = &variantID
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		entry.StoreID = storeID
+		entry.BillNumber = billNumber
+		entry.SupplierName = supplierName
+		entry.SupplierContact = supplierPhone
+		entry.AddedBy = userID
+		entry.Notes = "Received on " + poNumber
+		if err := CreateStockEntryTx(tx, entry); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE purchase_orders SET status = ? WHERE id = ?`, PurchaseOrderReceived, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
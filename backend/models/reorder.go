@@ -0,0 +1,260 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+var (
+	ErrSupplierNotFound     = errors.New("supplier not found")
+	ErrInvalidReorderConfig = errors.New("invalid reorder settings")
+)
+
+// ReorderSettings are the per-variant overrides for reordering. A nil
+// point or quantity is derived from sales velocity instead.
+type ReorderSettings struct {
+	ReorderPoint    *int `json:"reorder_point"`
+	ReorderQuantity *int `json:"reorder_quantity"`
+	SupplierID      *int `json:"supplier_id"`
+}
+
+// ReorderOptions control how suggestions are computed
+type ReorderOptions struct {
+	// StoreID limits stock, sales and open orders to one store; 0 means all
+	StoreID             int
+	VelocityDays        int
+	CoverDays           int
+	DefaultLeadTimeDays int
+	SupplierID          int
+	CategoryID          int
+	// VariantIDs, when set, limits suggestions to these variants
+	VariantIDs []int
+}
+
+type ReorderSuggestion struct {
+	ProductVariantID int     `json:"product_variant_id"`
+	ProductID        int     `json:"product_id"`
+	ItemID           string  `json:"item_id"`
+	ItemName         string  `json:"item_name"`
+	SKU              string  `json:"sku"`
+	Size             string  `json:"size"`
+	Color            string  `json:"color"`
+	SupplierID       *int    `json:"supplier_id"`
+	SupplierName     string  `json:"supplier_name"`
+	OnHand           int     `json:"on_hand"`
+	OnOrder          int     `json:"on_order"`
+	UnitsSold        int     `json:"units_sold"`
+	DailyVelocity    float64 `json:"daily_velocity"`
+	LeadTimeDays     int     `json:"lead_time_days"`
+	ReorderPoint     int     `json:"reorder_point"`
+	// ReorderPointSet is true when the point comes from the variant rather
+	// than from velocity
+	ReorderPointSet   bool     `json:"reorder_point_set"`
+	SuggestedQuantity int      `json:"suggested_quantity"`
+	UnitCost          float64  `json:"unit_cost"`
+	EstimatedCost     float64  `json:"estimated_cost"`
+	DaysOfCover       *float64 `json:"days_of_cover"`
+}
+
+// UpdateVariantReorderSettings stores the reorder overrides of a variant
+func UpdateVariantReorderSettings(db *sql.DB, variantID int, settings ReorderSettings) error {
+	if settings.ReorderPoint != nil && *settings.ReorderPoint < 0 {
+		return fmt.Errorf("%w: reorder_point cannot be negative", ErrInvalidReorderConfig)
+	}
+	if settings.ReorderQuantity != nil && *settings.ReorderQuantity <= 0 {
+		return fmt.Errorf("%w: reorder_quantity must be positive", ErrInvalidReorderConfig)
+	}
+	if settings.SupplierID != nil {
+		var exists bool
+		err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM suppliers WHERE id = ? AND is_active = true)`, *settings.SupplierID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: %d", ErrSupplierNotFound, *settings.SupplierID)
+		}
+	}
+
+	result, err := db.Exec(`
+		UPDATE product_variants SET reorder_point = ?, reorder_quantity = ?, supplier_id = ?
+		WHERE id = ?`,
+		settings.ReorderPoint, settings.ReorderQuantity, settings.SupplierID, variantID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM product_variants WHERE id = ?)`, variantID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: %d", ErrVariantNotFound, variantID)
+		}
+	}
+	return nil
+}
+
+// GetVariantReorderSettings returns the stored overrides of a variant
+func GetVariantReorderSettings(db *sql.DB, variantID int) (*ReorderSettings, error) {
+	var point, quantity, supplierID sql.NullInt64
+	err := db.QueryRow(`
+		SELECT reorder_point, reorder_quantity, supplier_id FROM product_variants WHERE id = ?`,
+		variantID).Scan(&point, &quantity, &supplierID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %d", ErrVariantNotFound, variantID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ReorderSettings{
+		ReorderPoint:    nullIntPtr(point),
+		ReorderQuantity: nullIntPtr(quantity),
+		SupplierID:      nullIntPtr(supplierID),
+	}, nil
+}
+
+// GetReorderSuggestions lists active variants whose stock on hand plus
+// stock on open purchase orders has fallen to their reorder point.
+//
+// Daily velocity is the units sold (refunds excluded) over the last
+// VelocityDays. Without an explicit point, the reorder point is the demand
+// expected over the supplier's lead time, but never below the product's
+// low_stock_threshold. Without an explicit quantity, the suggestion refills
+// to the reorder point plus CoverDays of demand. The supplier is the
+// variant's own, else the supplier named on its latest stock entry.
+func GetReorderSuggestions(db *sql.DB, opts ReorderOptions) ([]ReorderSuggestion, error) {
+	if opts.VelocityDays <= 0 {
+		opts.VelocityDays = 30
+	}
+	since := time.Now().AddDate(0, 0, -opts.VelocityDays)
+
+	query := `
+		SELECT v.id, p.id, p.item_id, p.item_name, COALESCE(v.sku, ''), v.size, COALESCE(v.color, ''),
+		       COALESCE(v.cost_price, 0), COALESCE(p.low_stock_threshold, 0), v.reorder_point, v.reorder_quantity,
+		       sup.id, COALESCE(sup.name, ''), sup.lead_time_days,
+		       CASE WHEN ? = 0 THEN v.current_stock ELSE COALESCE(ss.quantity, 0) END,
+		       COALESCE(sold.units, 0), COALESCE(ordered.units, 0)
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		LEFT JOIN store_stock ss ON ss.product_variant_id = v.id AND ss.store_id = ?
+		LEFT JOIN suppliers sup ON sup.id = COALESCE(v.supplier_id, (
+			SELECT ls.id FROM stock_entries se
+			JOIN suppliers ls ON ls.name = se.supplier_name AND ls.is_active = true
+			WHERE se.product_variant_id = v.id
+			ORDER BY se.entry_date DESC, se.id DESC LIMIT 1))
+		LEFT JOIN (
+			SELECT si.product_variant_id, SUM(si.quantity) AS units
+			FROM sale_items si
+			JOIN sales s ON s.id = si.sale_id
+			WHERE s.sale_date >= ? AND s.payment_status <> 'refunded' AND (? = 0 OR s.store_id = ?)
+			GROUP BY si.product_variant_id
+		) sold ON sold.product_variant_id = v.id
+		LEFT JOIN (
+			SELECT poi.product_variant_id, SUM(poi.quantity) AS units
+			FROM purchase_order_items poi
+			JOIN purchase_orders po ON po.id = poi.purchase_order_id
+			WHERE po.status IN ('draft', 'ordered') AND (? = 0 OR po.store_id = ?)
+			GROUP BY poi.product_variant_id
+		) ordered ON ordered.product_variant_id = v.id
+		WHERE v.is_active = true AND p.is_active = true AND (? = 0 OR p.category_id = ?)`
+	args := []interface{}{
+		opts.StoreID, opts.StoreID,
+		since, opts.StoreID, opts.StoreID,
+		opts.StoreID, opts.StoreID,
+		opts.CategoryID, opts.CategoryID,
+	}
+	if len(opts.VariantIDs) > 0 {
+		query += " AND v.id IN (" + placeholders(len(opts.VariantIDs)) + ")"
+		for _, id := range opts.VariantIDs {
+			args = append(args, id)
+		}
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suggestions []ReorderSuggestion
+	for rows.Next() {
+		var s ReorderSuggestion
+		var threshold int
+		var point, quantity, supplierID, leadTime sql.NullInt64
+		if err := rows.Scan(&s.ProductVariantID, &s.ProductID, &s.ItemID, &s.ItemName, &s.SKU, &s.Size, &s.Color,
+			&s.UnitCost, &threshold, &point, &quantity,
+			&supplierID, &s.SupplierName, &leadTime,
+			&s.OnHand, &s.UnitsSold, &s.OnOrder); err != nil {
+			return nil, err
+		}
+
+		s.SupplierID = nullIntPtr(supplierID)
+		if opts.SupplierID != 0 && (s.SupplierID == nil || *s.SupplierID != opts.SupplierID) {
+			continue
+		}
+		s.LeadTimeDays = opts.DefaultLeadTimeDays
+		if leadTime.Valid {
+			s.LeadTimeDays = int(leadTime.Int64)
+		}
+		s.DailyVelocity = float64(s.UnitsSold) / float64(opts.VelocityDays)
+
+		if point.Valid {
+			s.ReorderPoint, s.ReorderPointSet = int(point.Int64), true
+		} else {
+			s.ReorderPoint = int(math.Ceil(s.DailyVelocity * float64(s.LeadTimeDays)))
+			if threshold > s.ReorderPoint {
+				s.ReorderPoint = threshold
+			}
+			if s.ReorderPoint == 0 {
+				// Nothing sells and no threshold asks for stock
+				continue
+			}
+		}
+
+		available := s.OnHand + s.OnOrder
+		if available > s.ReorderPoint {
+			continue
+		}
+
+		if quantity.Valid && quantity.Int64 > 0 {
+			s.SuggestedQuantity = int(quantity.Int64)
+		} else {
+			target := s.ReorderPoint + int(math.Ceil(s.DailyVelocity*float64(opts.CoverDays)))
+			s.SuggestedQuantity = target - available
+			// Always lift the position back above the reorder point
+			if minimum := s.ReorderPoint - available + 1; s.SuggestedQuantity < minimum {
+				s.SuggestedQuantity = minimum
+			}
+		}
+		s.EstimatedCost = math.Round(s.UnitCost*float64(s.SuggestedQuantity)*100) / 100
+
+		if s.DailyVelocity > 0 {
+			cover := math.Round(float64(s.OnHand)/s.DailyVelocity*10) / 10
+			s.DaysOfCover = &cover
+		}
+		suggestions = append(suggestions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Most urgent first: least cover, then furthest below the reorder point
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if (a.DaysOfCover == nil) != (b.DaysOfCover == nil) {
+			return a.DaysOfCover != nil
+		}
+		if a.DaysOfCover != nil && *a.DaysOfCover != *b.DaysOfCover {
+			return *a.DaysOfCover < *b.DaysOfCover
+		}
+		if shortA, shortB := a.ReorderPoint-a.OnHand-a.OnOrder, b.ReorderPoint-b.OnHand-b.OnOrder; shortA != shortB {
+			return shortA > shortB
+		}
+		return a.ItemName < b.ItemName
+	})
+	return suggestions, nil
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// SearchVariant is the part of a variant the catalogue search indexes
+type SearchVariant struct {
+	ID    int
+	Size  string
+	Color string
+	SKU   string
+}
+
+// SearchDocument is the text of one active product as the catalogue search
+// indexes it
+type SearchDocument struct {
+	ProductID   int
+	ItemName    string
+	Model       string
+	BrandName   string
+	Description string
+	Variants    []SearchVariant
+}
+
+// GetSearchDocuments loads the documents for the given active products, or
+// for every active product when no IDs are given. Products that are missing
+// or inactive are left out.
+func GetSearchDocuments(db *sql.DB, productIDs ...int) ([]SearchDocument, error) {
+	query := `
+		SELECT p.id, p.item_name, COALESCE(p.model, ''), COALESCE(b.name, ''), COALESCE(p.description, '')
+		FROM products p
+		LEFT JOIN brands b ON b.id = p.brand_id
+		WHERE p.is_active = true`
+	var args []interface{}
+	if len(productIDs) > 0 {
+		query += " AND p.id IN (" + placeholders(len(productIDs)) + ")"
+		for _, id := range productIDs {
+			args = append(args, id)
+		}
+	}
+
+	rows, err := db.Query(query+" ORDER BY p.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []SearchDocument
+	index := map[int]int{}
+	for rows.Next() {
+		var doc SearchDocument
+		if err := rows.Scan(&doc.ProductID, &doc.ItemName, &doc.Model, &doc.BrandName, &doc.Description); err != nil {
+			return nil, err
+		}
+		index[doc.ProductID] = len(docs)
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(docs) == 0 {
+		return docs, nil
+	}
+
+	variantQuery := `
+		SELECT v.id, v.product_id, COALESCE(v.size, ''), COALESCE(v.color, ''), COALESCE(v.sku, '')
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		WHERE v.is_active = true AND p.is_active = true`
+	if len(productIDs) > 0 {
+		variantQuery += " AND v.product_id IN (" + placeholders(len(productIDs)) + ")"
+	}
+
+	variantRows, err := db.Query(variantQuery+" ORDER BY v.product_id, v.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer variantRows.Close()
+
+	for variantRows.Next() {
+		var variant SearchVariant
+		var productID int
+		if err := variantRows.Scan(&variant.ID, &productID, &variant.Size, &variant.Color, &variant.SKU); err != nil {
+			return nil, err
+		}
+		if i, ok := index[productID]; ok {
+			docs[i].Variants = append(docs[i].Variants, variant)
+		}
+	}
+	return docs, variantRows.Err()
+}
+
+// GetProductsByIDs returns the active products with the given IDs, in that
+// order, with their active variants; stock is scoped to storeID as in
+// GetAllProducts. IDs of missing or inactive products are skipped.
+func GetProductsByIDs(db *sql.DB, ids []int, storeID int) ([]ProductWithVariants, error) {
+	products := []ProductWithVariants{}
+	if len(ids) == 0 {
+		return products, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := db.Query(`
+		SELECT id, item_id, item_name, category_id, subcategory_id, brand_id, model,
+		       description, is_active, low_stock_threshold, created_at, updated_at
+		FROM products WHERE is_active = true AND id IN (`+placeholders(len(ids))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := map[int]ProductWithVariants{}
+	for rows.Next() {
+		var p ProductWithVariants
+		var categoryID, subcategoryID, brandID sql.NullInt64
+		if err := rows.Scan(
+			&p.ID, &p.ItemID, &p.ItemName, &categoryID, &subcategoryID, &brandID,
+			&p.Model, &p.Description, &p.IsActive, &p.LowStockThreshold,
+			&p.CreatedAt, &p.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		p.CategoryID = nullIntPtr(categoryID)
+		p.SubcategoryID = nullIntPtr(subcategoryID)
+		p.BrandID = nullIntPtr(brandID)
+		p.Variants = []ProductVariant{}
+		byID[p.ID] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			products = append(products, p)
+		}
+	}
+	if err := loadProductVariants(db, products, ProductFilter{StoreID: storeID}); err != nil {
+		return nil, err
+	}
+	if err := loadProductImages(db, products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// placeholders returns n comma-separated "?" for an IN list
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
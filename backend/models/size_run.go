@@ -0,0 +1,108 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// SizeRun is a named list of sizes (e.g. UK footwear 6-11) offered when
+// generating variants. Runs without a category apply to every category.
+type SizeRun struct {
+	ID         int      `json:"id"`
+	CategoryID *int     `json:"category_id,omitempty"`
+	Code       string   `json:"code"`
+	Name       string   `json:"name"`
+	Sizes      []string `json:"sizes"`
+}
+
+// GetSizeRuns lists the runs for categoryID plus the ones shared by all
+// categories; categoryID 0 lists every run
+func GetSizeRuns(db *sql.DB, categoryID int) ([]SizeRun, error) {
+	rows, err := db.Query(sizeRunSelect+`
+		WHERE ? = 0 OR category_id IS NULL OR category_id = ?
+		ORDER BY name`, categoryID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []SizeRun
+	for rows.Next() {
+		run, err := scanSizeRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+func GetSizeRunByCode(db *sql.DB, code string) (*SizeRun, error) {
+	return scanSizeRun(db.QueryRow(sizeRunSelect+" WHERE code = ?", code))
+}
+
+func CreateSizeRun(db *sql.DB, run *SizeRun) error {
+	result, err := db.Exec(`INSERT INTO size_runs (category_id, code, name, sizes) VALUES (?, ?, ?, ?)`,
+		run.CategoryID, run.Code, run.Name, strings.Join(run.Sizes, ","))
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	run.ID = int(id)
+	return nil
+}
+
+// VariantKey identifies a variant within its product by gender, size and
+// color, compared case-insensitively
+func VariantKey(gender, size, color string) string {
+	return strings.ToLower(strings.TrimSpace(gender)) + "|" +
+		strings.ToLower(strings.TrimSpace(size)) + "|" +
+		strings.ToLower(strings.TrimSpace(color))
+}
+
+// GetVariantKeysTx returns the keys of every variant of productID, active or
+// not, so generated variants never duplicate an existing combination
+func GetVariantKeysTx(tx *sql.Tx, productID int) (map[string]bool, error) {
+	rows, err := tx.Query(`
+		SELECT gender, size, COALESCE(color, '') FROM product_variants WHERE product_id = ?`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := map[string]bool{}
+	for rows.Next() {
+		var gender, size, color string
+		if err := rows.Scan(&gender, &size, &color); err != nil {
+			return nil, err
+		}
+		keys[VariantKey(gender, size, color)] = true
+	}
+	return keys, rows.Err()
+}
+
+const sizeRunSelect = `SELECT id, category_id, code, name, sizes FROM size_runs`
+
+func scanSizeRun(row rowScanner) (*SizeRun, error) {
+	var run SizeRun
+	var categoryID sql.NullInt64
+	var sizes string
+
+	if err := row.Scan(&run.ID, &categoryID, &run.Code, &run.Name, &sizes); err != nil {
+		return nil, err
+	}
+
+	run.CategoryID = nullIntPtr(categoryID)
+	run.Sizes = []string{}
+	for _, size := range strings.Split(sizes, ",") {
+		if size = strings.TrimSpace(size); size != "" {
+			run.Sizes = append(run.Sizes, size)
+		}
+	}
+	return &run, nil
+}
@@ -0,0 +1,242 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	ErrDuplicateSKU = errors.New("SKU is already used by another variant")
+	ErrInvalidSKU   = errors.New("invalid SKU")
+)
+
+const (
+	// SKU tokens are cut to this many characters so long names stay readable
+	skuTokenLength = 10
+	// maxSKULength matches product_variants.sku
+	maxSKULength = 100
+)
+
+var skuGenderCodes = map[string]string{
+	"male":   "M",
+	"female": "F",
+	"kids":   "K",
+	"unisex": "U",
+}
+
+// SKUParts holds the values a SKU template can reference
+type SKUParts struct {
+	Brand    string
+	Model    string
+	ItemID   string
+	Category string
+	Gender   string
+	Size     string
+	Color    string
+}
+
+// BuildSKU renders template with parts. Tokens are {BRAND}, {MODEL}, {ITEM},
+// {CATEGORY}, {GENDER}, {SIZE} and {COLOR}; values are upper-cased and
+// stripped to letters and digits, and separators left around empty tokens
+// are collapsed. The same inputs always give the same SKU.
+func BuildSKU(template string, parts SKUParts) string {
+	gender := skuGenderCodes[strings.ToLower(parts.Gender)]
+	if gender == "" {
+		gender = normalizeSKUToken(parts.Gender)
+	}
+
+	replacer := strings.NewReplacer(
+		"{BRAND}", normalizeSKUToken(parts.Brand),
+		"{MODEL}", normalizeSKUToken(parts.Model),
+		"{ITEM}", normalizeSKUToken(parts.ItemID),
+		"{CATEGORY}", normalizeSKUToken(parts.Category),
+		"{GENDER}", gender,
+		"{SIZE}", normalizeSKUToken(parts.Size),
+		"{COLOR}", normalizeSKUToken(parts.Color),
+	)
+	rendered := strings.ToUpper(replacer.Replace(template))
+
+	// Keep letters, digits and dashes; anything else in the template becomes a dash
+	var b strings.Builder
+	lastDash := true
+	for _, r := range rendered {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			lastDash = false
+		} else if !lastDash {
+			b.WriteByte('-')
+			lastDash = true
+		}
+	}
+	return strings.TrimRight(b.String(), "-")
+}
+
+func normalizeSKUToken(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(value) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+		if b.Len() == skuTokenLength {
+			break
+		}
+	}
+	return b.String()
+}
+
+// GenerateVariantSKUTx sets variant.SKU from template and the variant's
+// product, suffixing -2, -3, ... when the SKU is already taken
+func GenerateVariantSKUTx(tx *sql.Tx, template string, variant *ProductVariant) error {
+	return PlanVariantSKUTx(tx, template, variant, nil)
+}
+
+// PlanVariantSKUTx is GenerateVariantSKUTx for variants that are not being
+// inserted, such as a dry run: SKUs in reserved count as taken, so a batch
+// can be planned without writing any rows.
+func PlanVariantSKUTx(tx *sql.Tx, template string, variant *ProductVariant, reserved map[string]bool) error {
+	parts := SKUParts{Gender: variant.Gender, Size: variant.Size, Color: variant.Color}
+	err := tx.QueryRow(`
+		SELECT p.item_id, COALESCE(p.model, ''), COALESCE(b.name, ''), COALESCE(c.name, '')
+		FROM products p
+		LEFT JOIN brands b ON b.id = p.brand_id
+		LEFT JOIN categories c ON c.id = p.category_id
+		WHERE p.id = ?`, variant.ProductID).
+		Scan(&parts.ItemID, &parts.Model, &parts.Brand, &parts.Category)
+	if err != nil {
+		return err
+	}
+
+	base := BuildSKU(template, parts)
+	if base == "" {
+		base = fmt.Sprintf("P%d", variant.ProductID)
+	}
+
+	sku, err := uniqueSKUTx(tx, base, variant.ID, reserved)
+	if err != nil {
+		return err
+	}
+	variant.SKU = sku
+	return nil
+}
+
+// NormalizeSKU trims and upper-cases a hand-entered SKU so it matches the
+// generated ones. Letters, digits, '-', '_', '.' and '/' are allowed; any
+// other character is rejected rather than silently dropped.
+func NormalizeSKU(sku string) (string, error) {
+	sku = strings.ToUpper(strings.TrimSpace(sku))
+	if len(sku) > maxSKULength {
+		return "", fmt.Errorf("%w: longer than %d characters", ErrInvalidSKU, maxSKULength)
+	}
+	for _, r := range sku {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_./", r)) {
+			continue
+		}
+		return "", fmt.Errorf("%w: %q contains %q", ErrInvalidSKU, sku, r)
+	}
+	return sku, nil
+}
+
+// CheckSKUTx rejects a hand-entered SKU that another variant already uses
+func CheckSKUTx(tx *sql.Tx, sku string, variantID int) error {
+	var taken bool
+	if err := tx.QueryRow(`SELECT COUNT(*) > 0 FROM product_variants WHERE sku = ? AND id <> ?`,
+		sku, variantID).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("%w: %s", ErrDuplicateSKU, sku)
+	}
+	return nil
+}
+
+// uniqueSKUTx returns base, or base-N for the lowest N >= 2 that is neither
+// stored nor in reserved
+func uniqueSKUTx(tx *sql.Tx, base string, variantID int, reserved map[string]bool) (string, error) {
+	rows, err := tx.Query(`
+		SELECT sku FROM product_variants
+		WHERE (sku = ? OR sku LIKE ?) AND id <> ?`,
+		base, base+"-%", variantID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	taken := map[string]bool{}
+	for rows.Next() {
+		var sku string
+		if err := rows.Scan(&sku); err != nil {
+			return "", err
+		}
+		taken[sku] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	if !taken[base] && !reserved[base] {
+		return base, nil
+	}
+	for n := 2; ; n++ {
+		if candidate := fmt.Sprintf("%s-%d", base, n); !taken[candidate] && !reserved[candidate] {
+			return candidate, nil
+		}
+	}
+}
+
+// GetLegacySKUVariants lists variants whose SKU is missing or was generated
+// by the old SKU-<timestamp>-... scheme
+func GetLegacySKUVariants(db *sql.DB) ([]ProductVariant, error) {
+	rows, err := db.Query(`
+		SELECT id, product_id, gender, size, COALESCE(color, ''), COALESCE(sku, '')
+		FROM product_variants
+		WHERE sku IS NULL OR sku = '' OR sku REGEXP '^SKU-[0-9]{9,}-'
+		ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []ProductVariant
+	for rows.Next() {
+		var v ProductVariant
+		if err := rows.Scan(&v.ID, &v.ProductID, &v.Gender, &v.Size, &v.Color, &v.SKU); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+// GetVariantSKUTx returns the SKU stored for a variant, or "" if it has none
+func GetVariantSKUTx(tx *sql.Tx, variantID int) (string, error) {
+	var sku string
+	err := tx.QueryRow(`SELECT COALESCE(sku, '') FROM product_variants WHERE id = ?`, variantID).Scan(&sku)
+	return sku, err
+}
+
+func SetVariantSKUTx(tx *sql.Tx, variantID int, sku string) error {
+	_, err := tx.Exec(`UPDATE product_variants SET sku = ? WHERE id = ?`, sku, variantID)
+	return variantCodeError(err, sku, "")
+}
+
+// variantCodeError maps a unique-key violation on product_variants to
+// ErrDuplicateSKU or ErrDuplicateBarcode. The checks made before a write
+// cannot see a variant that a concurrent request is saving.
+func variantCodeError(err error, sku, barcode string) error {
+	var mysqlErr *mysql.MySQLError
+	if !isDuplicateKey(err) || !errors.As(err, &mysqlErr) {
+		return err
+	}
+	switch {
+	case strings.Contains(mysqlErr.Message, "uq_variant_barcode"):
+		return fmt.Errorf("%w: %s", ErrDuplicateBarcode, barcode)
+	case strings.Contains(mysqlErr.Message, "sku"):
+		return fmt.Errorf("%w: %s", ErrDuplicateSKU, sku)
+	}
+	return err
+}
@@ -8,6 +8,8 @@ import (
 type StockEntry struct {
 	ID              int       `json:"id"`
 	ProductID       int       `json:"product_id"`
+	ProductVariantID *int     `json:"product_variant_id,omitempty"`
+	StoreID         int       `json:"store_id"`
 	BillNumber      string    `json:"bill_number"`
 	PurchaseQuantity int      `json:"purchase_quantity"`
 	CurrentQuantity int      `json:"current_quantity"`
@@ -24,21 +26,50 @@ type StockEntry struct {
 }
 
 type StockAdjustment struct {
-	ID               int       `json:"id"`
-	ProductID        int       `json:"product_id"`
-	PreviousQuantity int       `json:"previous_quantity"`
-	NewQuantity      int       `json:"new_quantity"`
-	AdjustmentType   string    `json:"adjustment_type"`
-	Reason           string    `json:"reason"`
-	AdjustedBy       int       `json:"adjusted_by"`
-	AdjustedAt       time.Time `json:"adjusted_at"`
+	ID               int        `json:"id"`
+	ProductID        int        `json:"product_id"`
+	ProductVariantID int        `json:"product_variant_id"`
+	StoreID          int        `json:"store_id"`
+	PreviousQuantity int        `json:"previous_quantity"`
+	NewQuantity      int        `json:"new_quantity"`
+	// Quantity is the signed change requested (negative for removals)
+	Quantity         int        `json:"quantity"`
+	AdjustmentType   string     `json:"adjustment_type"`
+	ReasonCode       string     `json:"reason_code"`
+	Reason           string     `json:"reason"`
+	Status           string     `json:"status"`
+	AdjustedBy       int        `json:"adjusted_by"`
+	AdjustedAt       time.Time  `json:"adjusted_at"`
+	ApprovedBy       *int       `json:"approved_by,omitempty"`
+	ApprovedAt       *time.Time `json:"approved_at,omitempty"`
+	SKU              string     `json:"sku,omitempty"`
+	ItemName         string     `json:"item_name,omitempty"`
+	Size             string     `json:"size,omitempty"`
+	Color            string     `json:"color,omitempty"`
 }
 
+// CreateStockEntry records a purchase into entry.StoreID. When the entry is
+// for a specific variant, the received quantity is added to that store's stock
+// in the same transaction.
 func CreateStockEntry(db *sql.DB, entry *StockEntry) error {
-	result, err := db.Exec(`
-		INSERT INTO stock_entries (product_id, bill_number, purchase_quantity, current_quantity, purchase_price, mrp, selling_price, supplier_name, supplier_contact, added_by, notes)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		entry.ProductID, entry.BillNumber, entry.PurchaseQuantity, entry.PurchaseQuantity,
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := CreateStockEntryTx(tx, entry); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func CreateStockEntryTx(tx *sql.Tx, entry *StockEntry) error {
+	result, err := tx.Exec(`
+		INSERT INTO stock_entries (product_id, product_variant_id, store_id, bill_number, purchase_quantity, current_quantity, purchase_price, mrp, selling_price, supplier_name, supplier_contact, added_by, notes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.ProductID, entry.ProductVariantID, entry.StoreID, entry.BillNumber, entry.PurchaseQuantity, entry.PurchaseQuantity,
 		entry.PurchasePrice, entry.MRP, entry.SellingPrice, entry.SupplierName,
 		entry.SupplierContact, entry.AddedBy, entry.Notes)
 	if err != nil {
@@ -50,20 +81,30 @@ func CreateStockEntry(db *sql.DB, entry *StockEntry) error {
 		return err
 	}
 
+	if entry.ProductVariantID != nil {
+		if err := AdjustStoreStockTx(tx, entry.StoreID, *entry.ProductVariantID, entry.PurchaseQuantity); err != nil {
+			return err
+		}
+	}
+
 	entry.ID = int(id)
+	entry.CurrentQuantity = entry.PurchaseQuantity
 	entry.Status = "active"
 	return nil
 }
 
-func GetAllStockEntries(db *sql.DB) ([]StockEntry, error) {
+// GetAllStockEntries lists stock entries for storeID, or for every store when
+// storeID is 0
+func GetAllStockEntries(db *sql.DB, storeID int) ([]StockEntry, error) {
 	rows, err := db.Query(`
-		SELECT se.id, se.product_id, se.bill_number, se.purchase_quantity, se.current_quantity,
+		SELECT se.id, se.product_id, se.product_variant_id, COALESCE(se.store_id, 0), se.bill_number, se.purchase_quantity, se.current_quantity,
 		       se.purchase_price, se.mrp, se.selling_price, se.supplier_name, se.supplier_contact,
 		       se.entry_date, se.added_by, se.notes, se.status,
 		       p.item_id, p.item_name, p.model, p.color, p.size
 		FROM stock_entries se
 		JOIN products p ON se.product_id = p.id
-		ORDER BY se.entry_date DESC`)
+		WHERE ? = 0 OR se.store_id = ?
+		ORDER BY se.entry_date DESC`, storeID, storeID)
 	if err != nil {
 		return nil, err
 	}
@@ -72,14 +113,19 @@ func GetAllStockEntries(db *sql.DB) ([]StockEntry, error) {
 	var entries []StockEntry
 	for rows.Next() {
 		var se StockEntry
+		var variantID sql.NullInt64
 		if err := rows.Scan(
-			&se.ID, &se.ProductID, &se.BillNumber, &se.PurchaseQuantity, &se.CurrentQuantity,
+			&se.ID, &se.ProductID, &variantID, &se.StoreID, &se.BillNumber, &se.PurchaseQuantity, &se.CurrentQuantity,
 			&se.PurchasePrice, &se.MRP, &se.SellingPrice, &se.SupplierName, &se.SupplierContact,
 			&se.EntryDate, &se.AddedBy, &se.Notes, &se.Status,
 			&se.Product.ItemID, &se.Product.ItemName, &se.Product.Model, &se.Product.Color, &se.Product.Size,
 		); err != nil {
 			return nil, err
 		}
+		if variantID.Valid {
+			id := int(variantID.Int64)
+			se.ProductVariantID = &id
+		}
 		entries = append(entries, se)
 	}
 	return entries, nil
@@ -0,0 +1,302 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	AlertLowStock   = "low_stock"
+	AlertOutOfStock = "out_of_stock"
+)
+
+var ErrAlertNotFound = errors.New("stock alert not found")
+
+type StockAlert struct {
+	ID               int    `json:"id"`
+	StoreID          int    `json:"store_id"`
+	StoreName        string `json:"store_name"`
+	ProductVariantID int    `json:"product_variant_id"`
+	ProductID        int    `json:"product_id"`
+	ItemID           string `json:"item_id"`
+	ItemName         string `json:"item_name"`
+	SKU              string `json:"sku"`
+	Size             string `json:"size"`
+	Color            string `json:"color"`
+	AlertType        string `json:"alert_type"`
+	// Quantity is the stock at the store when the alert was raised
+	Quantity       int        `json:"quantity"`
+	Threshold      int        `json:"threshold"`
+	CreatedAt      time.Time  `json:"created_at"`
+	AcknowledgedBy *int       `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+}
+
+// StockAlertFilter narrows GetStockAlerts. Status is "open" (the default),
+// "resolved" or "all".
+type StockAlertFilter struct {
+	StoreID   int
+	Status    string
+	AlertType string
+	Limit     int
+}
+
+// StockLevel classifies a quantity against a low-stock threshold, returning
+// AlertOutOfStock, AlertLowStock or "" when stock is fine
+func StockLevel(quantity, threshold int) string {
+	switch {
+	case quantity <= 0:
+		return AlertOutOfStock
+	case quantity < threshold:
+		return AlertLowStock
+	}
+	return ""
+}
+
+// EvaluateStockAlertsTx compares a variant's stock at a store with its
+// product's low_stock_threshold. It opens an alert when the level has no
+// open alert yet and resolves open alerts for levels that no longer apply,
+// so each stockout is raised once however many sales follow it. Inactive
+// variants and products never alert.
+func EvaluateStockAlertsTx(tx *sql.Tx, storeID, variantID int) error {
+	var quantity, threshold int
+	var active bool
+	err := tx.QueryRow(`
+		SELECT COALESCE(ss.quantity, 0), COALESCE(p.low_stock_threshold, 0), v.is_active AND p.is_active
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		LEFT JOIN store_stock ss ON ss.product_variant_id = v.id AND ss.store_id = ?
+		WHERE v.id = ?`, storeID, variantID).Scan(&quantity, &threshold, &active)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	level := ""
+	if active {
+		level = StockLevel(quantity, threshold)
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, alert_type FROM stock_alerts
+		WHERE store_id = ? AND product_variant_id = ? AND resolved_at IS NULL FOR UPDATE`, storeID, variantID)
+	if err != nil {
+		return err
+	}
+	var stale []int
+	alreadyOpen := false
+	for rows.Next() {
+		var id int
+		var alertType string
+		if err := rows.Scan(&id, &alertType); err != nil {
+			rows.Close()
+			return err
+		}
+		if alertType == level {
+			alreadyOpen = true
+		} else {
+			stale = append(stale, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(stale) > 0 {
+		args := make([]interface{}, len(stale))
+		for i, id := range stale {
+			args[i] = id
+		}
+		if _, err := tx.Exec(`UPDATE stock_alerts SET resolved_at = NOW() WHERE id IN (`+placeholders(len(stale))+`)`, args...); err != nil {
+			return err
+		}
+	}
+
+	if level == "" || alreadyOpen {
+		return nil
+	}
+	_, err = tx.Exec(`
+		INSERT INTO stock_alerts (store_id, product_variant_id, alert_type, quantity, threshold)
+		VALUES (?, ?, ?, ?, ?)`, storeID, variantID, level, quantity, threshold)
+	return err
+}
+
+// EvaluateProductStockAlertsTx re-evaluates a product's variants after its
+// low_stock_threshold or is_active changes. Only stock on hand and open
+// alerts are affected by those, so variants at zero without an alert are
+// left alone.
+func EvaluateProductStockAlertsTx(tx *sql.Tx, productID int) error {
+	rows, err := tx.Query(`
+		SELECT ss.store_id, ss.product_variant_id
+		FROM store_stock ss
+		JOIN product_variants v ON v.id = ss.product_variant_id
+		WHERE v.product_id = ? AND ss.quantity > 0
+		UNION
+		SELECT a.store_id, a.product_variant_id
+		FROM stock_alerts a
+		JOIN product_variants v ON v.id = a.product_variant_id
+		WHERE v.product_id = ? AND a.resolved_at IS NULL`, productID, productID)
+	if err != nil {
+		return err
+	}
+	type stockKey struct{ storeID, variantID int }
+	var keys []stockKey
+	for rows.Next() {
+		var key stockKey
+		if err := rows.Scan(&key.storeID, &key.variantID); err != nil {
+			rows.Close()
+			return err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := EvaluateStockAlertsTx(tx, key.storeID, key.variantID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveVariantStockAlertsTx closes every open alert of a variant, e.g.
+// when it is deactivated
+func ResolveVariantStockAlertsTx(tx *sql.Tx, variantID int) error {
+	_, err := tx.Exec(`
+		UPDATE stock_alerts SET resolved_at = NOW()
+		WHERE product_variant_id = ? AND resolved_at IS NULL`, variantID)
+	return err
+}
+
+const stockAlertSelect = `
+	SELECT a.id, a.store_id, s.name, a.product_variant_id, p.id, p.item_id, p.item_name, COALESCE(v.sku, ''), v.size, COALESCE(v.color, ''),
+	       a.alert_type, a.quantity, a.threshold, a.created_at, a.acknowledged_by, a.acknowledged_at, a.resolved_at
+	FROM stock_alerts a
+	JOIN stores s ON s.id = a.store_id
+	JOIN product_variants v ON v.id = a.product_variant_id
+	JOIN products p ON p.id = v.product_id`
+
+func scanStockAlert(row rowScanner) (*StockAlert, error) {
+	var a StockAlert
+	var acknowledgedBy sql.NullInt64
+	var acknowledgedAt, resolvedAt sql.NullTime
+	if err := row.Scan(&a.ID, &a.StoreID, &a.StoreName, &a.ProductVariantID, &a.ProductID, &a.ItemID, &a.ItemName,
+		&a.SKU, &a.Size, &a.Color, &a.AlertType, &a.Quantity, &a.Threshold, &a.CreatedAt,
+		&acknowledgedBy, &acknowledgedAt, &resolvedAt); err != nil {
+		return nil, err
+	}
+	a.AcknowledgedBy = nullIntPtr(acknowledgedBy)
+	if acknowledgedAt.Valid {
+		a.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if resolvedAt.Valid {
+		a.ResolvedAt = &resolvedAt.Time
+	}
+	return &a, nil
+}
+
+func queryStockAlerts(db *sql.DB, query string, args ...interface{}) ([]StockAlert, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []StockAlert
+	for rows.Next() {
+		alert, err := scanStockAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, *alert)
+	}
+	return alerts, rows.Err()
+}
+
+func GetStockAlerts(db *sql.DB, filter StockAlertFilter) ([]StockAlert, error) {
+	query := stockAlertSelect + ` WHERE (? = 0 OR a.store_id = ?)`
+	args := []interface{}{filter.StoreID, filter.StoreID}
+	switch filter.Status {
+	case "", "open":
+		query += " AND a.resolved_at IS NULL"
+	case "resolved":
+		query += " AND a.resolved_at IS NOT NULL"
+	case "all":
+	default:
+		return nil, fmt.Errorf("unknown alert status %q", filter.Status)
+	}
+	if filter.AlertType != "" {
+		query += " AND a.alert_type = ?"
+		args = append(args, filter.AlertType)
+	}
+	query += " ORDER BY a.created_at DESC, a.id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+	return queryStockAlerts(db, query, args...)
+}
+
+func GetStockAlertByID(db *sql.DB, id int) (*StockAlert, error) {
+	alert, err := scanStockAlert(db.QueryRow(stockAlertSelect+" WHERE a.id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %d", ErrAlertNotFound, id)
+	}
+	return alert, err
+}
+
+// AcknowledgeStockAlert records that someone has seen an alert. It stays
+// open until stock recovers.
+func AcknowledgeStockAlert(db *sql.DB, id, userID int) error {
+	result, err := db.Exec(`
+		UPDATE stock_alerts SET acknowledged_by = ?, acknowledged_at = NOW()
+		WHERE id = ? AND acknowledged_at IS NULL`, userID, id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		if _, err := GetStockAlertByID(db, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUndeliveredStockAlerts returns open alerts that notifier has not yet
+// delivered and has tried fewer than maxAttempts times, oldest first
+func GetUndeliveredStockAlerts(db *sql.DB, notifier string, maxAttempts, limit int) ([]StockAlert, error) {
+	return queryStockAlerts(db, stockAlertSelect+`
+		LEFT JOIN stock_alert_deliveries d ON d.stock_alert_id = a.id AND d.notifier = ?
+		WHERE a.resolved_at IS NULL AND d.delivered_at IS NULL AND COALESCE(d.attempts, 0) < ?
+		ORDER BY a.id
+		LIMIT ?`, notifier, maxAttempts, limit)
+}
+
+// RecordStockAlertDeliveries notes one delivery attempt of each alert
+// through notifier; a nil deliveryErr marks them delivered
+func RecordStockAlertDeliveries(db *sql.DB, alertIDs []int, notifier string, deliveryErr error) error {
+	var lastError sql.NullString
+	if deliveryErr != nil {
+		lastError = sql.NullString{String: deliveryErr.Error(), Valid: true}
+	}
+	for _, id := range alertIDs {
+		_, err := db.Exec(`
+			INSERT INTO stock_alert_deliveries (stock_alert_id, notifier, attempts, last_error, delivered_at)
+			VALUES (?, ?, 1, ?, IF(? IS NULL, NOW(), NULL))
+			ON DUPLICATE KEY UPDATE attempts = attempts + 1, last_error = VALUES(last_error), delivered_at = VALUES(delivered_at)`,
+			id, notifier, lastError, lastError)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
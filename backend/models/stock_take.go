@@ -0,0 +1,418 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	StockTakeOpen      = "open"
+	StockTakeApproved  = "approved"
+	StockTakeCancelled = "cancelled"
+)
+
+var (
+	ErrStockTakeClosed       = errors.New("stock take is not open")
+	ErrInvalidStockTakeCount = errors.New("invalid stock take count")
+)
+
+type StockTake struct {
+	ID           int        `json:"id"`
+	Reference    string     `json:"reference"`
+	StoreID      int        `json:"store_id"`
+	CategoryID   *int       `json:"category_id,omitempty"`
+	BrandID      *int       `json:"brand_id,omitempty"`
+	Status       string     `json:"status"`
+	Notes        string     `json:"notes"`
+	CreatedBy    int        `json:"created_by"`
+	ApprovedBy   *int       `json:"approved_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ApprovedAt   *time.Time `json:"approved_at,omitempty"`
+	TotalLines   int        `json:"total_lines"`
+	CountedLines int        `json:"counted_lines"`
+}
+
+type StockTakeLine struct {
+	ID               int     `json:"id"`
+	ProductVariantID int     `json:"product_variant_id"`
+	SKU              string  `json:"sku"`
+	Barcode          string  `json:"barcode"`
+	ItemName         string  `json:"item_name"`
+	Size             string  `json:"size"`
+	Color            string  `json:"color"`
+	ExpectedQuantity int     `json:"expected_quantity"`
+	CountedQuantity  *int    `json:"counted_quantity"`
+	Variance         int     `json:"variance"`
+	VarianceValue    float64 `json:"variance_value"`
+}
+
+// StockTakeScan is one scanned code from a counting device. Code may be a
+// barcode or SKU; ProductVariantID can be sent instead.
+type StockTakeScan struct {
+	ProductVariantID int    `json:"product_variant_id"`
+	Code             string `json:"code"`
+	Quantity         int    `json:"quantity"`
+}
+
+// CreateStockTake opens a session and snapshots the expected quantity of every
+// active variant at the store that matches the category/brand scope
+func CreateStockTake(db *sql.DB, take *StockTake) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO stock_takes (reference, store_id, category_id, brand_id, status, notes, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		fmt.Sprintf("ST-%d", time.Now().UnixNano()), take.StoreID, take.CategoryID, take.BrandID,
+		StockTakeOpen, take.Notes, take.CreatedBy)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	take.ID = int(id)
+	take.Reference = fmt.Sprintf("ST-%06d", id)
+	if _, err := tx.Exec(`UPDATE stock_takes SET reference = ? WHERE id = ?`, take.Reference, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO stock_take_lines (stock_take_id, product_variant_id, expected_quantity)
+		SELECT ?, v.id, COALESCE(ss.quantity, 0)
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		LEFT JOIN store_stock ss ON ss.product_variant_id = v.id AND ss.store_id = ?
+		WHERE v.is_active = true AND p.is_active = true
+		  AND (? IS NULL OR p.category_id = ?)
+		  AND (? IS NULL OR p.brand_id = ?)`,
+		take.ID, take.StoreID, take.CategoryID, take.CategoryID, take.BrandID, take.BrandID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	take.Status = StockTakeOpen
+	return nil
+}
+
+func GetStockTakes(db *sql.DB, storeID int, status string) ([]StockTake, error) {
+	query := stockTakeSelect + ` WHERE (? = 0 OR t.store_id = ?)`
+	args := []interface{}{storeID, storeID}
+	if status != "" {
+		query += " AND t.status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY t.created_at DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var takes []StockTake
+	for rows.Next() {
+		take, err := scanStockTake(rows)
+		if err != nil {
+			return nil, err
+		}
+		takes = append(takes, *take)
+	}
+	return takes, rows.Err()
+}
+
+func GetStockTakeByID(db *sql.DB, id int) (*StockTake, error) {
+	return scanStockTake(db.QueryRow(stockTakeSelect+" WHERE t.id = ?", id))
+}
+
+// RecordStockTakeScans adds (or, with replace, sets) counted quantities for a
+// batch of scans. Each device posts its own batches; the per-line update is
+// atomic so concurrent devices never lose each other's counts. Codes that
+// are not part of the session are returned rather than failing the batch.
+func RecordStockTakeScans(db *sql.DB, id, userID int, deviceID string, scans []StockTakeScan, replace bool) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// A shared lock lets devices scan in parallel while blocking approval
+	var status string
+	if err := tx.QueryRow(`SELECT status FROM stock_takes WHERE id = ? LOCK IN SHARE MODE`, id).Scan(&status); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if status != StockTakeOpen {
+		tx.Rollback()
+		return nil, ErrStockTakeClosed
+	}
+
+	var unmatched []string
+	for _, scan := range scans {
+		if scan.Quantity < 0 {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: quantity %d is negative", ErrInvalidStockTakeCount, scan.Quantity)
+		}
+		quantity := scan.Quantity
+		if quantity == 0 && !replace {
+			quantity = 1
+		}
+
+		variantID := scan.ProductVariantID
+		if variantID == 0 {
+			err := tx.QueryRow(`
+				SELECT l.product_variant_id FROM stock_take_lines l
+				JOIN product_variants v ON v.id = l.product_variant_id
+				WHERE l.stock_take_id = ? AND (v.barcode = ? OR v.sku = ?)
+				LIMIT 1`, id, scan.Code, scan.Code).Scan(&variantID)
+			if err == sql.ErrNoRows {
+				unmatched = append(unmatched, scan.Code)
+				continue
+			}
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+
+		update := `UPDATE stock_take_lines SET counted_quantity = COALESCE(counted_quantity, 0) + ? WHERE stock_take_id = ? AND product_variant_id = ?`
+		if replace {
+			update = `UPDATE stock_take_lines SET counted_quantity = ? WHERE stock_take_id = ? AND product_variant_id = ?`
+		}
+		result, err := tx.Exec(update, quantity, id, variantID)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			// MySQL reports 0 when a "set" leaves the value unchanged, so
+			// only treat it as unmatched if the line really is missing
+			var exists bool
+			if err := tx.QueryRow(`SELECT COUNT(*) > 0 FROM stock_take_lines WHERE stock_take_id = ? AND product_variant_id = ?`,
+				id, variantID).Scan(&exists); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			if !exists {
+				unmatched = append(unmatched, fmt.Sprintf("variant:%d", variantID))
+				continue
+			}
+		}
+
+		if _, err := tx.Exec(`
+			INSERT INTO stock_take_counts (stock_take_id, product_variant_id, quantity, device_id, counted_by)
+			VALUES (?, ?, ?, ?, ?)`,
+			id, variantID, quantity, deviceID, userID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return unmatched, nil
+}
+
+// GetStockTakeLines returns every line with its variance against the
+// snapshot. Uncounted lines have a nil CountedQuantity and no variance.
+func GetStockTakeLines(db *sql.DB, id int, onlyDifferences bool) ([]StockTakeLine, error) {
+	rows, err := db.Query(`
+		SELECT l.id, l.product_variant_id, COALESCE(v.sku, ''), COALESCE(v.barcode, ''), p.item_name, v.size, COALESCE(v.color, ''),
+		       l.expected_quantity, l.counted_quantity, COALESCE(v.cost_price, 0)
+		FROM stock_take_lines l
+		JOIN product_variants v ON v.id = l.product_variant_id
+		JOIN products p ON p.id = v.product_id
+		WHERE l.stock_take_id = ?
+		ORDER BY p.item_name, v.size, v.color`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []StockTakeLine
+	for rows.Next() {
+		var line StockTakeLine
+		var counted sql.NullInt64
+		var costPrice float64
+		if err := rows.Scan(&line.ID, &line.ProductVariantID, &line.SKU, &line.Barcode, &line.ItemName, &line.Size, &line.Color,
+			&line.ExpectedQuantity, &counted, &costPrice); err != nil {
+			return nil, err
+		}
+
+		if counted.Valid {
+			quantity := int(counted.Int64)
+			line.CountedQuantity = &quantity
+			line.Variance = quantity - line.ExpectedQuantity
+			line.VarianceValue = float64(line.Variance) * costPrice
+		}
+
+		if onlyDifferences && (line.CountedQuantity == nil || line.Variance == 0) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+// ApproveStockTake posts every variance as a correction in one transaction.
+// The variance is applied on top of current stock so sales made while
+// counting are not undone. Uncounted lines are skipped unless zeroUncounted
+// is set, in which case they are treated as counted at zero.
+func ApproveStockTake(db *sql.DB, id, approverID int, zeroUncounted bool) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var take StockTake
+	if err := tx.QueryRow(`SELECT id, reference, store_id, status FROM stock_takes WHERE id = ? FOR UPDATE`, id).
+		Scan(&take.ID, &take.Reference, &take.StoreID, &take.Status); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if take.Status != StockTakeOpen {
+		tx.Rollback()
+		return 0, ErrStockTakeClosed
+	}
+
+	rows, err := tx.Query(`
+		SELECT product_variant_id, expected_quantity, counted_quantity
+		FROM stock_take_lines WHERE stock_take_id = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	type variance struct {
+		variantID int
+		delta     int
+	}
+	var variances []variance
+	for rows.Next() {
+		var variantID, expected int
+		var counted sql.NullInt64
+		if err := rows.Scan(&variantID, &expected, &counted); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, err
+		}
+		if !counted.Valid && !zeroUncounted {
+			continue
+		}
+		if delta := int(counted.Int64) - expected; delta != 0 {
+			variances = append(variances, variance{variantID, delta})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	now := time.Now()
+	for _, v := range variances {
+		current, err := GetStoreStockTx(tx, take.StoreID, v.variantID)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		target := current + v.delta
+		if target < 0 {
+			target = 0
+		}
+		if err := SetStoreStockTx(tx, take.StoreID, v.variantID, target); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		adj := StockAdjustment{
+			ProductVariantID: v.variantID,
+			StoreID:          take.StoreID,
+			PreviousQuantity: current,
+			NewQuantity:      target,
+			Quantity:         target - current,
+			AdjustmentType:   "correction",
+			ReasonCode:       "count_error",
+			Reason:           "Stock take " + take.Reference,
+			Status:           AdjustmentApproved,
+			AdjustedBy:       approverID,
+			ApprovedBy:       &approverID,
+			ApprovedAt:       &now,
+		}
+		if err := CreateStockAdjustmentTx(tx, &adj); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE stock_takes SET status = ?, approved_by = ?, approved_at = NOW() WHERE id = ?`,
+		StockTakeApproved, approverID, id); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(variances), nil
+}
+
+func CancelStockTake(db *sql.DB, id int) error {
+	result, err := db.Exec(`UPDATE stock_takes SET status = ? WHERE id = ? AND status = ?`,
+		StockTakeCancelled, id, StockTakeOpen)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrStockTakeClosed
+	}
+	return nil
+}
+
+const stockTakeSelect = `
+	SELECT t.id, t.reference, t.store_id, t.category_id, t.brand_id, t.status, COALESCE(t.notes, ''),
+	       COALESCE(t.created_by, 0), t.approved_by, t.created_at, t.approved_at,
+	       (SELECT COUNT(*) FROM stock_take_lines l WHERE l.stock_take_id = t.id),
+	       (SELECT COUNT(*) FROM stock_take_lines l WHERE l.stock_take_id = t.id AND l.counted_quantity IS NOT NULL)
+	FROM stock_takes t`
+
+func scanStockTake(row rowScanner) (*StockTake, error) {
+	var take StockTake
+	var categoryID, brandID, approvedBy sql.NullInt64
+	var approvedAt sql.NullTime
+
+	if err := row.Scan(&take.ID, &take.Reference, &take.StoreID, &categoryID, &brandID, &take.Status, &take.Notes,
+		&take.CreatedBy, &approvedBy, &take.CreatedAt, &approvedAt,
+		&take.TotalLines, &take.CountedLines); err != nil {
+		return nil, err
+	}
+
+	take.CategoryID = nullIntPtr(categoryID)
+	take.BrandID = nullIntPtr(brandID)
+	take.ApprovedBy = nullIntPtr(approvedBy)
+	if approvedAt.Valid {
+		take.ApprovedAt = &approvedAt.Time
+	}
+	return &take, nil
+}
@@ -0,0 +1,252 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Store struct {
+	ID        int       `json:"id"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address"`
+	Phone     string    `json:"phone"`
+	IsActive  bool      `json:"is_active"`
+	IsDefault bool      `json:"is_default,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// VariantStoreStock is the quantity of one variant held at one store
+type VariantStoreStock struct {
+	StoreID   int    `json:"store_id"`
+	StoreName string `json:"store_name"`
+	Quantity  int    `json:"quantity"`
+}
+
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// GetAllStores lists active stores, and deactivated ones too when
+// includeInactive is set
+func GetAllStores(db *sql.DB, includeInactive bool) ([]Store, error) {
+	rows, err := db.Query(`
+		SELECT id, code, name, COALESCE(address, ''), COALESCE(phone, ''), is_active, created_at
+		FROM stores WHERE is_active = true OR ? ORDER BY name`, includeInactive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stores []Store
+	for rows.Next() {
+		var store Store
+		if err := rows.Scan(&store.ID, &store.Code, &store.Name, &store.Address, &store.Phone, &store.IsActive, &store.CreatedAt); err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	return stores, rows.Err()
+}
+
+func GetStoresForUser(db *sql.DB, userID int) ([]Store, error) {
+	rows, err := db.Query(`
+		SELECT s.id, s.code, s.name, COALESCE(s.address, ''), COALESCE(s.phone, ''), s.is_active, s.created_at, us.is_default
+		FROM stores s
+		JOIN user_stores us ON us.store_id = s.id
+		WHERE us.user_id = ? AND s.is_active = true
+		ORDER BY us.is_default DESC, s.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stores []Store
+	for rows.Next() {
+		var store Store
+		if err := rows.Scan(&store.ID, &store.Code, &store.Name, &store.Address, &store.Phone, &store.IsActive, &store.CreatedAt, &store.IsDefault); err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	return stores, rows.Err()
+}
+
+// GetStoreByID returns an active store
+func GetStoreByID(db *sql.DB, id int) (*Store, error) {
+	return getStore(db, id, false)
+}
+
+// GetStoreByIDAnyStatus also returns deactivated stores, for admins managing them
+func GetStoreByIDAnyStatus(db *sql.DB, id int) (*Store, error) {
+	return getStore(db, id, true)
+}
+
+func getStore(db *sql.DB, id int, includeInactive bool) (*Store, error) {
+	var store Store
+	err := db.QueryRow(`
+		SELECT id, code, name, COALESCE(address, ''), COALESCE(phone, ''), is_active, created_at
+		FROM stores WHERE id = ? AND (is_active = true OR ?)`, id, includeInactive).
+		Scan(&store.ID, &store.Code, &store.Name, &store.Address, &store.Phone, &store.IsActive, &store.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+func CreateStore(db *sql.DB, store *Store) error {
+	result, err := db.Exec(`INSERT INTO stores (code, name, address, phone) VALUES (?, ?, ?, ?)`,
+		store.Code, store.Name, store.Address, store.Phone)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	store.ID = int(id)
+	store.IsActive = true
+	return nil
+}
+
+func UpdateStore(db *sql.DB, store *Store) error {
+	_, err := db.Exec(`UPDATE stores SET code = ?, name = ?, address = ?, phone = ?, is_active = ? WHERE id = ?`,
+		store.Code, store.Name, store.Address, store.Phone, store.IsActive, store.ID)
+	return err
+}
+
+// UserHasStore reports whether the user is assigned to an active store
+func UserHasStore(db *sql.DB, userID, storeID int) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`
+		SELECT COUNT(*) > 0 FROM user_stores us
+		JOIN stores s ON s.id = us.store_id
+		WHERE us.user_id = ? AND us.store_id = ? AND s.is_active = true`, userID, storeID).Scan(&exists)
+	return exists, err
+}
+
+// GetDefaultStoreID returns the user's default store, falling back to the
+// first store they are assigned to. It returns 0 when they have none.
+func GetDefaultStoreID(db *sql.DB, userID int) (int, error) {
+	var storeID int
+	err := db.QueryRow(`
+		SELECT us.store_id FROM user_stores us
+		JOIN stores s ON s.id = us.store_id
+		WHERE us.user_id = ? AND s.is_active = true
+		ORDER BY us.is_default DESC, us.store_id
+		LIMIT 1`, userID).Scan(&storeID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return storeID, err
+}
+
+// SetUserStores replaces the user's store assignments
+func SetUserStores(db *sql.DB, userID int, storeIDs []int, defaultStoreID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_stores WHERE user_id = ?`, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i, storeID := range storeIDs {
+		isDefault := storeID == defaultStoreID || (defaultStoreID == 0 && i == 0)
+		if _, err := tx.Exec(`INSERT INTO user_stores (user_id, store_id, is_default) VALUES (?, ?, ?)`,
+			userID, storeID, isDefault); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetStoreStockTx reads and locks a variant's quantity at a store
+func GetStoreStockTx(tx *sql.Tx, storeID, variantID int) (int, error) {
+	var quantity int
+	err := tx.QueryRow(`
+		SELECT quantity FROM store_stock
+		WHERE store_id = ? AND product_variant_id = ? FOR UPDATE`, storeID, variantID).Scan(&quantity)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return quantity, err
+}
+
+// SetStoreStockTx sets a variant's quantity at a store, refreshes the
+// variant's total current_stock and re-evaluates its stock alerts
+func SetStoreStockTx(tx *sql.Tx, storeID, variantID, quantity int) error {
+	var previous int
+	err := tx.QueryRow(`SELECT quantity FROM store_stock WHERE store_id = ? AND product_variant_id = ? FOR UPDATE`,
+		storeID, variantID).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO store_stock (store_id, product_variant_id, quantity) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE quantity = VALUES(quantity)`,
+		storeID, variantID, quantity)
+	if err != nil {
+		return err
+	}
+	if err := syncVariantStockTx(tx, variantID); err != nil {
+		return err
+	}
+
+	// Alerts follow changes in stock, so a new variant's zero opening stock
+	// does not raise an out-of-stock alert for something never stocked
+	if quantity == previous {
+		return nil
+	}
+	return EvaluateStockAlertsTx(tx, storeID, variantID)
+}
+
+// AdjustStoreStockTx adds delta (which may be negative) to a variant's
+// quantity at a store. It refuses to take the quantity below zero.
+func AdjustStoreStockTx(tx *sql.Tx, storeID, variantID, delta int) error {
+	current, err := GetStoreStockTx(tx, storeID, variantID)
+	if err != nil {
+		return err
+	}
+	if current+delta < 0 {
+		return ErrInsufficientStock
+	}
+	return SetStoreStockTx(tx, storeID, variantID, current+delta)
+}
+
+func syncVariantStockTx(tx *sql.Tx, variantID int) error {
+	_, err := tx.Exec(`
+		UPDATE product_variants
+		SET current_stock = (SELECT COALESCE(SUM(quantity), 0) FROM store_stock WHERE product_variant_id = ?)
+		WHERE id = ?`, variantID, variantID)
+	return err
+}
+
+func GetVariantStoreStock(db *sql.DB, variantID int) ([]VariantStoreStock, error) {
+	rows, err := db.Query(`
+		SELECT s.id, s.name, COALESCE(ss.quantity, 0)
+		FROM stores s
+		LEFT JOIN store_stock ss ON ss.store_id = s.id AND ss.product_variant_id = ?
+		WHERE s.is_active = true
+		ORDER BY s.name`, variantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stock []VariantStoreStock
+	for rows.Next() {
+		var item VariantStoreStock
+		if err := rows.Scan(&item.StoreID, &item.StoreName, &item.Quantity); err != nil {
+			return nil, err
+		}
+		stock = append(stock, item)
+	}
+	return stock, rows.Err()
+}
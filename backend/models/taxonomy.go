@@ -0,0 +1,339 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TaxonomyKind names one of the tables products are classified by
+type TaxonomyKind string
+
+const (
+	KindCategory    TaxonomyKind = "categories"
+	KindSubcategory TaxonomyKind = "subcategories"
+	KindBrand       TaxonomyKind = "brands"
+)
+
+var (
+	ErrDuplicateName    = errors.New("name is already used")
+	ErrTaxonomyInUse    = errors.New("still used by active products")
+	ErrInvalidReassign  = errors.New("invalid reassignment target")
+	ErrTaxonomyNotFound = errors.New("not found")
+	ErrParentInactive   = errors.New("its category is inactive")
+)
+
+// productColumn is the products column that references the kind
+func (k TaxonomyKind) productColumn() string {
+	switch k {
+	case KindCategory:
+		return "category_id"
+	case KindSubcategory:
+		return "subcategory_id"
+	default:
+		return "brand_id"
+	}
+}
+
+func (k TaxonomyKind) label() string {
+	switch k {
+	case KindCategory:
+		return "category"
+	case KindSubcategory:
+		return "subcategory"
+	default:
+		return "brand"
+	}
+}
+
+// isDuplicateKey reports whether err is MySQL's duplicate-entry error, which
+// the unique name keys raise when two requests claim a name at once
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// TaxonomyNameTaken reports whether another row of kind already has name
+// (case-insensitive). Subcategory names only need to be unique within their
+// category, given as parentID. It gives a friendly error up front; the
+// unique keys on name are what stop concurrent requests.
+func TaxonomyNameTaken(db *sql.DB, kind TaxonomyKind, name string, parentID, excludeID int) (bool, error) {
+	query := `SELECT COUNT(*) > 0 FROM ` + string(kind) + ` WHERE LOWER(name) = LOWER(?) AND id <> ?`
+	args := []interface{}{strings.TrimSpace(name), excludeID}
+	if kind == KindSubcategory {
+		query += " AND category_id = ?"
+		args = append(args, parentID)
+	}
+
+	var taken bool
+	err := db.QueryRow(query, args...).Scan(&taken)
+	return taken, err
+}
+
+// UpdateCategoryTx, UpdateBrandTx and UpdateSubcategoryTx rename a row
+// inside tx so a rename and an is_active change in the same request commit
+// together. A name taken by a concurrent request fails with ErrDuplicateName.
+func UpdateCategoryTx(tx *sql.Tx, category *Category) error {
+	return updateTaxonomyRowTx(tx, KindCategory, category.ID,
+		`UPDATE categories SET name = ?, description = ? WHERE id = ?`,
+		category.Name, category.Description, category.ID)
+}
+
+func UpdateBrandTx(tx *sql.Tx, brand *Brand) error {
+	return updateTaxonomyRowTx(tx, KindBrand, brand.ID,
+		`UPDATE brands SET name = ?, description = ? WHERE id = ?`,
+		brand.Name, brand.Description, brand.ID)
+}
+
+// UpdateSubcategoryTx may move the subcategory to another category only
+// when no active product uses it, since those products would no longer match
+func UpdateSubcategoryTx(tx *sql.Tx, subcategory *Subcategory) error {
+	var currentCategory sql.NullInt64
+	err := tx.QueryRow(`SELECT category_id FROM subcategories WHERE id = ? FOR UPDATE`, subcategory.ID).Scan(&currentCategory)
+	if err == sql.ErrNoRows {
+		return ErrTaxonomyNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if !currentCategory.Valid || int(currentCategory.Int64) != subcategory.CategoryID {
+		var inUse int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM products WHERE is_active = true AND subcategory_id = ?`, subcategory.ID).
+			Scan(&inUse); err != nil {
+			return err
+		}
+		if inUse > 0 {
+			return fmt.Errorf("%w: %d products, so it cannot move to another category", ErrTaxonomyInUse, inUse)
+		}
+	}
+
+	return updateTaxonomyRowTx(tx, KindSubcategory, subcategory.ID,
+		`UPDATE subcategories SET name = ?, category_id = ?, description = ? WHERE id = ?`,
+		subcategory.Name, subcategory.CategoryID, subcategory.Description, subcategory.ID)
+}
+
+func updateTaxonomyRowTx(tx *sql.Tx, kind TaxonomyKind, id int, query string, args ...interface{}) error {
+	if _, err := tx.Exec(query, args...); err != nil {
+		if isDuplicateKey(err) {
+			return fmt.Errorf("%w: %s", ErrDuplicateName, args[0])
+		}
+		return err
+	}
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT COUNT(*) > 0 FROM `+string(kind)+` WHERE id = ?`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrTaxonomyNotFound
+	}
+	return nil
+}
+
+// DeactivateTaxonomy runs DeactivateTaxonomyTx in its own transaction
+func DeactivateTaxonomy(db *sql.DB, kind TaxonomyKind, id int, reassignTo *int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	moved, err := DeactivateTaxonomyTx(tx, kind, id, reassignTo)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// DeactivateTaxonomyTx deactivates a category, subcategory or brand. Active
+// products using it block the change unless reassignTo names another active
+// row to move them to; the number of products moved is returned. Moving
+// products to another category clears their subcategory, and deactivating a
+// category also deactivates its subcategories.
+func DeactivateTaxonomyTx(tx *sql.Tx, kind TaxonomyKind, id int, reassignTo *int) (int, error) {
+	var parentID sql.NullInt64
+	query := `SELECT NULL FROM ` + string(kind) + ` WHERE id = ? FOR UPDATE`
+	if kind == KindSubcategory {
+		query = `SELECT category_id FROM subcategories WHERE id = ? FOR UPDATE`
+	}
+	if err := tx.QueryRow(query, id).Scan(&parentID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrTaxonomyNotFound
+		}
+		return 0, err
+	}
+
+	var inUse int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM products WHERE is_active = true AND `+kind.productColumn()+` = ?`, id).
+		Scan(&inUse); err != nil {
+		return 0, err
+	}
+
+	if inUse > 0 {
+		if reassignTo == nil {
+			return 0, fmt.Errorf("%w: %d products use this %s; reassign them first", ErrTaxonomyInUse, inUse, kind.label())
+		}
+		if err := checkReassignTargetTx(tx, kind, id, *reassignTo, parentID); err != nil {
+			return 0, err
+		}
+
+		update := `UPDATE products SET ` + kind.productColumn() + ` = ?, updated_at = NOW(6) WHERE is_active = true AND ` + kind.productColumn() + ` = ?`
+		if kind == KindCategory {
+			update = `UPDATE products SET category_id = ?, subcategory_id = NULL, updated_at = NOW(6) WHERE is_active = true AND category_id = ?`
+		}
+		if _, err := tx.Exec(update, *reassignTo, id); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE `+string(kind)+` SET is_active = false WHERE id = ?`, id); err != nil {
+		return 0, err
+	}
+	if kind == KindCategory {
+		if _, err := tx.Exec(`UPDATE subcategories SET is_active = false WHERE category_id = ?`, id); err != nil {
+			return 0, err
+		}
+	}
+	return inUse, nil
+}
+
+func checkReassignTargetTx(tx *sql.Tx, kind TaxonomyKind, id, target int, parentID sql.NullInt64) error {
+	if target == id {
+		return fmt.Errorf("%w: cannot reassign a %s to itself", ErrInvalidReassign, kind.label())
+	}
+
+	var active bool
+	var targetParent sql.NullInt64
+	query := `SELECT is_active, NULL FROM ` + string(kind) + ` WHERE id = ?`
+	if kind == KindSubcategory {
+		query = `SELECT is_active, category_id FROM subcategories WHERE id = ?`
+	}
+	err := tx.QueryRow(query, target).Scan(&active, &targetParent)
+	if err == sql.ErrNoRows || (err == nil && !active) {
+		return fmt.Errorf("%w: %s %d does not exist or is inactive", ErrInvalidReassign, kind.label(), target)
+	}
+	if err != nil {
+		return err
+	}
+
+	if kind == KindSubcategory && targetParent != parentID {
+		return fmt.Errorf("%w: subcategory %d belongs to a different category", ErrInvalidReassign, target)
+	}
+	return nil
+}
+
+// ActivateTaxonomyTx re-enables a deactivated row. A subcategory cannot be
+// re-enabled while its category is inactive.
+func ActivateTaxonomyTx(tx *sql.Tx, kind TaxonomyKind, id int) error {
+	if kind == KindSubcategory {
+		var categoryActive sql.NullBool
+		err := tx.QueryRow(`
+			SELECT c.is_active FROM subcategories s LEFT JOIN categories c ON c.id = s.category_id
+			WHERE s.id = ?`, id).Scan(&categoryActive)
+		if err == sql.ErrNoRows {
+			return ErrTaxonomyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if categoryActive.Valid && !categoryActive.Bool {
+			return ErrParentInactive
+		}
+	}
+
+	return updateTaxonomyRowTx(tx, kind, id, `UPDATE `+string(kind)+` SET is_active = true WHERE id = ?`, id)
+}
+
+// ReorderTaxonomy stores the display order given by ids; rows not listed
+// keep their current position after the listed ones
+func ReorderTaxonomy(db *sql.DB, kind TaxonomyKind, ids []int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE `+string(kind)+` SET sort_order = sort_order + ?`, len(ids)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for position, id := range ids {
+		if _, err := tx.Exec(`UPDATE `+string(kind)+` SET sort_order = ? WHERE id = ?`, position, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+type SubcategoryNode struct {
+	Subcategory
+	ProductCount int `json:"product_count"`
+}
+
+type CategoryNode struct {
+	Category
+	ProductCount  int               `json:"product_count"`
+	Subcategories []SubcategoryNode `json:"subcategories"`
+}
+
+// GetCategoryTree returns active categories in display order, each with its
+// active subcategories and the number of active products in each
+func GetCategoryTree(db *sql.DB) ([]CategoryNode, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.name, COALESCE(c.description, ''), c.is_active, c.sort_order, c.created_at,
+		       (SELECT COUNT(*) FROM products p WHERE p.category_id = c.id AND p.is_active = true)
+		FROM categories c
+		WHERE c.is_active = true
+		ORDER BY c.sort_order, c.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tree []CategoryNode
+	index := map[int]int{}
+	for rows.Next() {
+		var node CategoryNode
+		if err := rows.Scan(&node.ID, &node.Name, &node.Description, &node.IsActive, &node.SortOrder, &node.CreatedAt,
+			&node.ProductCount); err != nil {
+			return nil, err
+		}
+		node.Subcategories = []SubcategoryNode{}
+		index[node.ID] = len(tree)
+		tree = append(tree, node)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	subRows, err := db.Query(`
+		SELECT s.id, s.name, s.category_id, COALESCE(s.description, ''), s.is_active, s.sort_order, s.created_at,
+		       (SELECT COUNT(*) FROM products p WHERE p.subcategory_id = s.id AND p.is_active = true)
+		FROM subcategories s
+		WHERE s.is_active = true AND s.category_id IS NOT NULL
+		ORDER BY s.sort_order, s.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer subRows.Close()
+
+	for subRows.Next() {
+		var node SubcategoryNode
+		if err := subRows.Scan(&node.ID, &node.Name, &node.CategoryID, &node.Description, &node.IsActive, &node.SortOrder,
+			&node.CreatedAt, &node.ProductCount); err != nil {
+			return nil, err
+		}
+		if i, ok := index[node.CategoryID]; ok {
+			tree[i].Subcategories = append(tree[i].Subcategories, node)
+		}
+	}
+	return tree, subRows.Err()
+}
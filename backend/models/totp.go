@@ -0,0 +1,240 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MaxMFAAttempts is how many codes one mfa_token may be used to try
+const MaxMFAAttempts = 5
+
+// MaxMFAFailures is how many codes a user may try, across every mfa_token,
+// before two-factor login is locked for MFALockout. Logging in again hands
+// out a fresh mfa_token, so the per-token limit alone does not stop guessing.
+const MaxMFAFailures = 10
+
+const MFALockout = 15 * time.Minute
+
+// UserTOTP holds the second-factor state for a user. The secret is stored
+// as soon as enrollment starts but only enforced once Enabled is true.
+type UserTOTP struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+func GetUserTOTP(db *sql.DB, userID int) (*UserTOTP, error) {
+	var totp UserTOTP
+	var secret sql.NullString
+	var lastStep sql.NullInt64
+
+	err := db.QueryRow(`SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = ? AND is_active = true`, userID).
+		Scan(&secret, &totp.Enabled, &lastStep)
+	if err != nil {
+		return nil, err
+	}
+
+	totp.Secret = secret.String
+	totp.LastStep = lastStep.Int64
+	return &totp, nil
+}
+
+// SetPendingTOTPSecret stores a new secret for enrollment without enabling it
+func SetPendingTOTPSecret(db *sql.DB, userID int, secret string) error {
+	_, err := db.Exec(`UPDATE users SET totp_secret = ?, totp_enabled = false, totp_last_step = NULL WHERE id = ?`, secret, userID)
+	return err
+}
+
+// EnableTOTP turns on 2FA and replaces the user's recovery codes in one transaction
+func EnableTOTP(db *sql.DB, userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET totp_enabled = true, totp_last_step = ? WHERE id = ?`, step, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := replaceRecoveryCodesTx(tx, userID, recoveryCodeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func DisableTOTP(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_step = NULL WHERE id = ?`, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MarkTOTPStepUsed records the time step of an accepted code. It returns
+// false when that step (or a later one) was already used, which blocks replay.
+func MarkTOTPStepUsed(db *sql.DB, userID int, step int64) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE users SET totp_last_step = ?
+		WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)`,
+		step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func ReplaceRecoveryCodes(db *sql.DB, userID int, codeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodesTx(tx, userID, codeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodesTx(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode consumes an unused recovery code, reporting whether it matched
+func UseRecoveryCode(db *sql.DB, userID int, codeHash string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE user_recovery_codes SET used_at = NOW()
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func CountUnusedRecoveryCodes(db *sql.DB, userID int) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+// ReserveMFAAttempt counts one code attempt against an mfa_token before the
+// code is checked, so parallel guesses cannot exceed MaxMFAAttempts. It
+// returns false once the token is spent or out of attempts.
+func ReserveMFAAttempt(db *sql.DB, tokenHash string, userID int, expiresAt time.Time) (bool, error) {
+	if _, err := db.Exec(`DELETE FROM mfa_challenges WHERE expires_at < NOW()`); err != nil {
+		return false, err
+	}
+	if _, err := db.Exec(`
+		INSERT IGNORE INTO mfa_challenges (token_hash, user_id, expires_at) VALUES (?, ?, ?)`,
+		tokenHash, userID, expiresAt); err != nil {
+		return false, err
+	}
+
+	result, err := db.Exec(`
+		UPDATE mfa_challenges SET attempts = attempts + 1
+		WHERE token_hash = ? AND used_at IS NULL AND attempts < ?`,
+		tokenHash, MaxMFAAttempts)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// CompleteMFAChallenge spends an mfa_token after a correct code. It returns
+// false when a concurrent request already spent it.
+func CompleteMFAChallenge(db *sql.DB, tokenHash string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE mfa_challenges SET used_at = NOW()
+		WHERE token_hash = ? AND used_at IS NULL`, tokenHash)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// MFALockedUntil returns when a user's two-factor lockout ends, or the zero
+// time when they are not locked out
+func MFALockedUntil(db *sql.DB, userID int) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := db.QueryRow(`
+		SELECT mfa_locked_until FROM users
+		WHERE id = ? AND mfa_locked_until > NOW()`, userID).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lockedUntil.Time, nil
+}
+
+// ReserveMFAUserAttempt counts one code attempt against the user before the
+// code is checked. The attempt that reaches MaxMFAFailures starts a lockout;
+// it returns false while one is in force. ResetMFAFailures clears the count
+// after a correct code.
+func ReserveMFAUserAttempt(db *sql.DB, userID int) (bool, error) {
+	// MySQL applies the assignments left to right, so the lock is set from
+	// the count before it is reset
+	result, err := db.Exec(`
+		UPDATE users SET
+			mfa_locked_until = IF(mfa_failed_attempts + 1 >= ?, NOW() + INTERVAL ? SECOND, NULL),
+			mfa_failed_attempts = IF(mfa_failed_attempts + 1 >= ?, 0, mfa_failed_attempts + 1)
+		WHERE id = ? AND (mfa_locked_until IS NULL OR mfa_locked_until <= NOW())`,
+		MaxMFAFailures, int(MFALockout/time.Second), MaxMFAFailures, userID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func ResetMFAFailures(db *sql.DB, userID int) error {
+	_, err := db.Exec(`UPDATE users SET mfa_failed_attempts = 0, mfa_locked_until = NULL WHERE id = ?`, userID)
+	return err
+}
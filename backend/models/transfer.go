@@ -0,0 +1,504 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	TransferRequested         = "requested"
+	TransferDispatched        = "dispatched"
+	TransferPartiallyReceived = "partially_received"
+	TransferReceived          = "received"
+	TransferCancelled         = "cancelled"
+)
+
+var (
+	ErrTransferState       = errors.New("transfer is not in a state that allows this action")
+	ErrInvalidTransferItem = errors.New("invalid transfer item")
+)
+
+type StockTransfer struct {
+	ID                 int                 `json:"id"`
+	TransferNumber     string              `json:"transfer_number"`
+	SourceStoreID      int                 `json:"source_store_id"`
+	SourceStoreName    string              `json:"source_store_name"`
+	DestinationStoreID int                 `json:"destination_store_id"`
+	DestinationName    string              `json:"destination_store_name"`
+	Status             string              `json:"status"`
+	Notes              string              `json:"notes"`
+	RequestedBy        *int                `json:"requested_by,omitempty"`
+	DispatchedBy       *int                `json:"dispatched_by,omitempty"`
+	ReceivedBy         *int                `json:"received_by,omitempty"`
+	RequestedAt        time.Time           `json:"requested_at"`
+	DispatchedAt       *time.Time          `json:"dispatched_at,omitempty"`
+	ReceivedAt         *time.Time          `json:"received_at,omitempty"`
+	Items              []StockTransferItem `json:"items,omitempty"`
+}
+
+type StockTransferItem struct {
+	ID                 int    `json:"id"`
+	TransferID         int    `json:"transfer_id"`
+	ProductVariantID   int    `json:"product_variant_id"`
+	SKU                string `json:"sku"`
+	ItemName           string `json:"item_name"`
+	Size               string `json:"size"`
+	Color              string `json:"color"`
+	QuantityRequested  int    `json:"quantity_requested"`
+	QuantityDispatched int    `json:"quantity_dispatched"`
+	QuantityReceived   int    `json:"quantity_received"`
+	// InTransit is what has left the source but not yet been received
+	InTransit int `json:"in_transit"`
+}
+
+// InTransitStock is the quantity of a variant on its way to a store
+type InTransitStock struct {
+	ProductVariantID   int    `json:"product_variant_id"`
+	SKU                string `json:"sku"`
+	ItemName           string `json:"item_name"`
+	DestinationStoreID int    `json:"destination_store_id"`
+	Quantity           int    `json:"quantity"`
+}
+
+// TransferQuantity sets the quantity for one transfer item when dispatching
+// or receiving
+type TransferQuantity struct {
+	ItemID   int `json:"item_id"`
+	Quantity int `json:"quantity"`
+}
+
+func CreateStockTransfer(db *sql.DB, transfer *StockTransfer) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO stock_transfers (transfer_number, source_store_id, destination_store_id, status, notes, requested_by)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		fmt.Sprintf("TR-%d", time.Now().UnixNano()), transfer.SourceStoreID, transfer.DestinationStoreID,
+		TransferRequested, transfer.Notes, transfer.RequestedBy)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Readable number derived from the id, replacing the placeholder above
+	transfer.ID = int(id)
+	transfer.TransferNumber = fmt.Sprintf("TR-%06d", id)
+	if _, err := tx.Exec(`UPDATE stock_transfers SET transfer_number = ? WHERE id = ?`, transfer.TransferNumber, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i := range transfer.Items {
+		item := &transfer.Items[i]
+		result, err := tx.Exec(`
+			INSERT INTO stock_transfer_items (transfer_id, product_variant_id, quantity_requested)
+			VALUES (?, ?, ?)`,
+			transfer.ID, item.ProductVariantID, item.QuantityRequested)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		itemID, err := result.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		item.ID = int(itemID)
+		item.TransferID = transfer.ID
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	transfer.Status = TransferRequested
+	return nil
+}
+
+// GetStockTransfers lists transfers touching storeID (either end), or every
+// transfer when storeID is 0
+func GetStockTransfers(db *sql.DB, storeID int, status string) ([]StockTransfer, error) {
+	query := transferSelect + ` WHERE (? = 0 OR t.source_store_id = ? OR t.destination_store_id = ?)`
+	args := []interface{}{storeID, storeID, storeID}
+	if status != "" {
+		query += " AND t.status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY t.requested_at DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []StockTransfer
+	for rows.Next() {
+		transfer, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, *transfer)
+	}
+	return transfers, rows.Err()
+}
+
+func GetStockTransferByID(db *sql.DB, id int) (*StockTransfer, error) {
+	transfer, err := scanTransfer(db.QueryRow(transferSelect+" WHERE t.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT ti.id, ti.transfer_id, ti.product_variant_id, COALESCE(v.sku, ''), p.item_name, v.size, COALESCE(v.color, ''),
+		       ti.quantity_requested, ti.quantity_dispatched, ti.quantity_received
+		FROM stock_transfer_items ti
+		JOIN product_variants v ON v.id = ti.product_variant_id
+		JOIN products p ON p.id = v.product_id
+		WHERE ti.transfer_id = ?
+		ORDER BY ti.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item StockTransferItem
+		if err := rows.Scan(&item.ID, &item.TransferID, &item.ProductVariantID, &item.SKU, &item.ItemName, &item.Size, &item.Color,
+			&item.QuantityRequested, &item.QuantityDispatched, &item.QuantityReceived); err != nil {
+			return nil, err
+		}
+		if transfer.Status == TransferDispatched || transfer.Status == TransferPartiallyReceived {
+			item.InTransit = item.QuantityDispatched - item.QuantityReceived
+			if item.InTransit < 0 {
+				item.InTransit = 0
+			}
+		}
+		transfer.Items = append(transfer.Items, item)
+	}
+	return transfer, rows.Err()
+}
+
+// DispatchStockTransfer takes stock out of the source store. Quantities
+// default to what was requested; overrides may ship less (or nothing) of an item.
+func DispatchStockTransfer(db *sql.DB, id, userID int, overrides []TransferQuantity) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	transfer, err := lockTransferTx(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if transfer.Status != TransferRequested {
+		tx.Rollback()
+		return ErrTransferState
+	}
+
+	items, err := transferItemsTx(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	quantities := make(map[int]int)
+	for _, item := range items {
+		quantities[item.ID] = item.QuantityRequested
+	}
+	for _, override := range overrides {
+		if _, ok := quantities[override.ItemID]; !ok {
+			tx.Rollback()
+			return fmt.Errorf("%w: item %d is not part of this transfer", ErrInvalidTransferItem, override.ItemID)
+		}
+		if override.Quantity < 0 {
+			tx.Rollback()
+			return fmt.Errorf("%w: quantity for item %d cannot be negative", ErrInvalidTransferItem, override.ItemID)
+		}
+		quantities[override.ItemID] = override.Quantity
+	}
+
+	for _, item := range items {
+		quantity := quantities[item.ID]
+		if quantity > 0 {
+			if err := AdjustStoreStockTx(tx, transfer.SourceStoreID, item.ProductVariantID, -quantity); err != nil {
+				tx.Rollback()
+				if err == ErrInsufficientStock {
+					return fmt.Errorf("%w at source store for variant %d", ErrInsufficientStock, item.ProductVariantID)
+				}
+				return err
+			}
+		}
+		if _, err := tx.Exec(`UPDATE stock_transfer_items SET quantity_dispatched = ? WHERE id = ?`, quantity, item.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE stock_transfers SET status = ?, dispatched_by = ?, dispatched_at = NOW() WHERE id = ?`,
+		TransferDispatched, userID, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReceiveStockTransfer lands received quantities at the destination store.
+// Receipts may be partial and repeated. When complete is set, or everything
+// dispatched has arrived, the transfer is closed and any difference between
+// dispatched and received is recorded as a stock adjustment at the destination.
+func ReceiveStockTransfer(db *sql.DB, id, userID int, received []TransferQuantity, complete bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	transfer, err := lockTransferTx(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if transfer.Status != TransferDispatched && transfer.Status != TransferPartiallyReceived {
+		tx.Rollback()
+		return ErrTransferState
+	}
+
+	items, err := transferItemsTx(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	byID := make(map[int]*StockTransferItem)
+	for i := range items {
+		byID[items[i].ID] = &items[i]
+	}
+
+	for _, receipt := range received {
+		item, ok := byID[receipt.ItemID]
+		if !ok {
+			tx.Rollback()
+			return fmt.Errorf("%w: item %d is not part of this transfer", ErrInvalidTransferItem, receipt.ItemID)
+		}
+		if receipt.Quantity < 0 {
+			tx.Rollback()
+			return fmt.Errorf("%w: quantity for item %d cannot be negative", ErrInvalidTransferItem, receipt.ItemID)
+		}
+		if receipt.Quantity == 0 {
+			continue
+		}
+		// Only what is still in transit can arrive; more would create stock
+		if outstanding := item.QuantityDispatched - item.QuantityReceived; receipt.Quantity > outstanding {
+			tx.Rollback()
+			return fmt.Errorf("%w: item %d has only %d outstanding, cannot receive %d",
+				ErrInvalidTransferItem, receipt.ItemID, outstanding, receipt.Quantity)
+		}
+
+		if err := AdjustStoreStockTx(tx, transfer.DestinationStoreID, item.ProductVariantID, receipt.Quantity); err != nil {
+			tx.Rollback()
+			return err
+		}
+		item.QuantityReceived += receipt.Quantity
+		if _, err := tx.Exec(`UPDATE stock_transfer_items SET quantity_received = ? WHERE id = ?`, item.QuantityReceived, item.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	allReceived := true
+	for _, item := range items {
+		if item.QuantityReceived < item.QuantityDispatched {
+			allReceived = false
+			break
+		}
+	}
+
+	status := TransferPartiallyReceived
+	if complete || allReceived {
+		status = TransferReceived
+		for _, item := range items {
+			if err := recordTransferDiscrepancyTx(tx, transfer, item, userID); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE stock_transfers SET status = ?, received_by = ?, received_at = NOW() WHERE id = ?`,
+		status, userID, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// recordTransferDiscrepancyTx writes an adjustment for what was dispatched
+// but never arrived. Those units left the source at dispatch and were never
+// added at the destination, so the destination's quantity is unchanged: the
+// adjustment records the loss against its actual, locked quantity.
+func recordTransferDiscrepancyTx(tx *sql.Tx, transfer *StockTransfer, item StockTransferItem, userID int) error {
+	shortfall := item.QuantityDispatched - item.QuantityReceived
+	if shortfall <= 0 {
+		return nil
+	}
+
+	current, err := GetStoreStockTx(tx, transfer.DestinationStoreID, item.ProductVariantID)
+	if err != nil {
+		return err
+	}
+
+	adj := StockAdjustment{
+		ProductVariantID: item.ProductVariantID,
+		StoreID:          transfer.DestinationStoreID,
+		PreviousQuantity: current,
+		NewQuantity:      current,
+		Quantity:         -shortfall,
+		AdjustmentType:   "remove",
+		ReasonCode:       "transfer",
+		Status:           AdjustmentApproved,
+		Reason: fmt.Sprintf("Transfer %s discrepancy: dispatched %d, received %d; %d lost in transit",
+			transfer.TransferNumber, item.QuantityDispatched, item.QuantityReceived, shortfall),
+		AdjustedBy: userID,
+	}
+	return CreateStockAdjustmentTx(tx, &adj)
+}
+
+func CancelStockTransfer(db *sql.DB, id int) error {
+	result, err := db.Exec(`UPDATE stock_transfers SET status = ? WHERE id = ? AND status = ?`,
+		TransferCancelled, id, TransferRequested)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTransferState
+	}
+	return nil
+}
+
+// GetInTransitStock sums what has been dispatched but not yet received,
+// per variant and destination. storeID 0 covers every destination.
+func GetInTransitStock(db *sql.DB, storeID int) ([]InTransitStock, error) {
+	rows, err := db.Query(`
+		SELECT ti.product_variant_id, COALESCE(v.sku, ''), p.item_name, t.destination_store_id,
+		       SUM(GREATEST(ti.quantity_dispatched - ti.quantity_received, 0)) AS in_transit
+		FROM stock_transfer_items ti
+		JOIN stock_transfers t ON t.id = ti.transfer_id
+		JOIN product_variants v ON v.id = ti.product_variant_id
+		JOIN products p ON p.id = v.product_id
+		WHERE t.status IN (?, ?) AND (? = 0 OR t.destination_store_id = ?)
+		GROUP BY ti.product_variant_id, v.sku, p.item_name, t.destination_store_id
+		HAVING in_transit > 0
+		ORDER BY p.item_name`,
+		TransferDispatched, TransferPartiallyReceived, storeID, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stock []InTransitStock
+	for rows.Next() {
+		var item InTransitStock
+		if err := rows.Scan(&item.ProductVariantID, &item.SKU, &item.ItemName, &item.DestinationStoreID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		stock = append(stock, item)
+	}
+	return stock, rows.Err()
+}
+
+const transferSelect = `
+	SELECT t.id, t.transfer_number, t.source_store_id, src.name, t.destination_store_id, dst.name,
+	       t.status, COALESCE(t.notes, ''), t.requested_by, t.dispatched_by, t.received_by,
+	       t.requested_at, t.dispatched_at, t.received_at
+	FROM stock_transfers t
+	JOIN stores src ON src.id = t.source_store_id
+	JOIN stores dst ON dst.id = t.destination_store_id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTransfer(row rowScanner) (*StockTransfer, error) {
+	var t StockTransfer
+	var requestedBy, dispatchedBy, receivedBy sql.NullInt64
+	var dispatchedAt, receivedAt sql.NullTime
+
+	if err := row.Scan(&t.ID, &t.TransferNumber, &t.SourceStoreID, &t.SourceStoreName, &t.DestinationStoreID, &t.DestinationName,
+		&t.Status, &t.Notes, &requestedBy, &dispatchedBy, &receivedBy,
+		&t.RequestedAt, &dispatchedAt, &receivedAt); err != nil {
+		return nil, err
+	}
+
+	t.RequestedBy = nullIntPtr(requestedBy)
+	t.DispatchedBy = nullIntPtr(dispatchedBy)
+	t.ReceivedBy = nullIntPtr(receivedBy)
+	if dispatchedAt.Valid {
+		t.DispatchedAt = &dispatchedAt.Time
+	}
+	if receivedAt.Valid {
+		t.ReceivedAt = &receivedAt.Time
+	}
+	return &t, nil
+}
+
+func lockTransferTx(tx *sql.Tx, id int) (*StockTransfer, error) {
+	var t StockTransfer
+	err := tx.QueryRow(`
+		SELECT id, transfer_number, source_store_id, destination_store_id, status
+		FROM stock_transfers WHERE id = ? FOR UPDATE`, id).
+		Scan(&t.ID, &t.TransferNumber, &t.SourceStoreID, &t.DestinationStoreID, &t.Status)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func transferItemsTx(tx *sql.Tx, transferID int) ([]StockTransferItem, error) {
+	rows, err := tx.Query(`
+		SELECT id, transfer_id, product_variant_id, quantity_requested, quantity_dispatched, quantity_received
+		FROM stock_transfer_items WHERE transfer_id = ? ORDER BY id`, transferID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []StockTransferItem
+	for rows.Next() {
+		var item StockTransferItem
+		if err := rows.Scan(&item.ID, &item.TransferID, &item.ProductVariantID,
+			&item.QuantityRequested, &item.QuantityDispatched, &item.QuantityReceived); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func nullIntPtr(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	id := int(value.Int64)
+	return &id
+}
@@ -12,6 +12,7 @@ type User struct {
 	Password  string     `json:"-"`
 	Role      string     `json:"role"`
 	IsActive  bool       `json:"is_active"`
+	TOTPEnabled bool     `json:"totp_enabled"`
 	LastLogin *time.Time `json:"last_login,omitempty"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
@@ -26,7 +27,7 @@ func GetUserByUsername(db *sql.DB, username string) (*User, error) {
 	var user User
 	var lastLogin sql.NullTime
 	
-	query := `SELECT id, username, email, password, role, is_active, last_login, created_at, updated_at 
+	query := `SELECT id, username, email, password, role, is_active, totp_enabled, last_login, created_at, updated_at 
 	          FROM users WHERE username = ? AND is_active = true`
 	
 	err := db.QueryRow(query, username).Scan(
@@ -36,6 +37,7 @@ func GetUserByUsername(db *sql.DB, username string) (*User, error) {
 		&user.Password,
 		&user.Role,
 		&user.IsActive,
+		&user.TOTPEnabled,
 		&lastLogin,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -57,7 +59,7 @@ func GetUserByID(db *sql.DB, id int) (*User, error) {
 	var user User
 	var lastLogin sql.NullTime
 	
-	query := `SELECT id, username, email, password, role, is_active, last_login, created_at, updated_at 
+	query := `SELECT id, username, email, password, role, is_active, totp_enabled, last_login, created_at, updated_at 
 	          FROM users WHERE id = ? AND is_active = true`
 	
 	err := db.QueryRow(query, id).Scan(
@@ -67,6 +69,7 @@ func GetUserByID(db *sql.DB, id int) (*User, error) {
 		&user.Password,
 		&user.Role,
 		&user.IsActive,
+		&user.TOTPEnabled,
 		&lastLogin,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -94,7 +97,7 @@ func GetUserByEmail(db *sql.DB, email string) (*User, error) {
 	var user User
 	var lastLogin sql.NullTime
 	
-	query := `SELECT id, username, email, password, role, is_active, last_login, created_at, updated_at 
+	query := `SELECT id, username, email, password, role, is_active, totp_enabled, last_login, created_at, updated_at 
 	          FROM users WHERE email = ? AND is_active = true`
 	
 	err := db.QueryRow(query, email).Scan(
@@ -104,6 +107,7 @@ func GetUserByEmail(db *sql.DB, email string) (*User, error) {
 		&user.Password,
 		&user.Role,
 		&user.IsActive,
+		&user.TOTPEnabled,
 		&lastLogin,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	VariantDeleted     = "deleted"
+	VariantDeactivated = "deactivated"
+)
+
+var (
+	ErrVariantNotFound = errors.New("variant not found for this product")
+	ErrVariantHasStock = errors.New("variant still has stock on hand")
+)
+
+// RemoveProductVariantTx removes a variant from productID. Variants that
+// appear in sales, stock movements, transfers or counts are deactivated so
+// that history keeps pointing at them; others are deleted outright. A
+// variant with stock on hand is refused unless force is set, in which case
+// the stock is written off with a "remove" adjustment in each store first.
+// It returns VariantDeleted or VariantDeactivated.
+func RemoveProductVariantTx(tx *sql.Tx, productID, variantID, userID int, force bool) (string, error) {
+	var sku string
+	err := tx.QueryRow(`
+		SELECT COALESCE(sku, '') FROM product_variants
+		WHERE id = ? AND product_id = ? FOR UPDATE`, variantID, productID).Scan(&sku)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: %d", ErrVariantNotFound, variantID)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	stock, err := variantStoreStockTx(tx, variantID)
+	if err != nil {
+		return "", err
+	}
+
+	onHand := 0
+	for _, quantity := range stock {
+		onHand += quantity
+	}
+	if onHand > 0 && !force {
+		return "", fmt.Errorf("%w: %s has %d units", ErrVariantHasStock, sku, onHand)
+	}
+
+	now := time.Now()
+	for storeID, quantity := range stock {
+		if quantity <= 0 {
+			continue
+		}
+		if err := SetStoreStockTx(tx, storeID, variantID, 0); err != nil {
+			return "", err
+		}
+		adj := StockAdjustment{
+			ProductVariantID: variantID,
+			StoreID:          storeID,
+			PreviousQuantity: quantity,
+			NewQuantity:      0,
+			Quantity:         -quantity,
+			AdjustmentType:   "remove",
+			ReasonCode:       "other",
+			Reason:           "Variant removed",
+			AdjustedBy:       userID,
+			Status:           AdjustmentApproved,
+			ApprovedBy:       &userID,
+			ApprovedAt:       &now,
+		}
+		if err := CreateStockAdjustmentTx(tx, &adj); err != nil {
+			return "", err
+		}
+	}
+
+	hasHistory, err := variantHasHistoryTx(tx, variantID)
+	if err != nil {
+		return "", err
+	}
+
+	if hasHistory {
+		if _, err := tx.Exec(`UPDATE product_variants SET is_active = false WHERE id = ?`, variantID); err != nil {
+			return "", err
+		}
+		if err := ResolveVariantStockAlertsTx(tx, variantID); err != nil {
+			return "", err
+		}
+		return VariantDeactivated, nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM product_variants WHERE id = ?`, variantID); err != nil {
+		return "", err
+	}
+	return VariantDeleted, nil
+}
+
+// variantStoreStockTx locks and returns the variant's quantity per store
+func variantStoreStockTx(tx *sql.Tx, variantID int) (map[int]int, error) {
+	rows, err := tx.Query(`
+		SELECT store_id, quantity FROM store_stock WHERE product_variant_id = ? FOR UPDATE`, variantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stock := map[int]int{}
+	for rows.Next() {
+		var storeID, quantity int
+		if err := rows.Scan(&storeID, &quantity); err != nil {
+			return nil, err
+		}
+		stock[storeID] = quantity
+	}
+	return stock, rows.Err()
+}
+
+func variantHasHistoryTx(tx *sql.Tx, variantID int) (bool, error) {
+	var hasHistory bool
+	err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM sale_items WHERE product_variant_id = ?)
+		    OR EXISTS (SELECT 1 FROM stock_entries WHERE product_variant_id = ?)
+		    OR EXISTS (SELECT 1 FROM stock_adjustments WHERE product_variant_id = ?)
+		    OR EXISTS (SELECT 1 FROM stock_transfer_items WHERE product_variant_id = ?)
+		    OR EXISTS (SELECT 1 FROM stock_take_lines WHERE product_variant_id = ? AND counted_quantity IS NOT NULL)
+		    OR EXISTS (SELECT 1 FROM purchase_order_items WHERE product_variant_id = ?)`,
+		variantID, variantID, variantID, variantID, variantID, variantID).Scan(&hasHistory)
+	return hasHistory, err
+}
@@ -0,0 +1,63 @@
+package search
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"stock-management/models"
+)
+
+var (
+	catalogue = NewIndex()
+	db        *sql.DB
+)
+
+// Init builds the catalogue index from the database at startup
+func Init(database *sql.DB) error {
+	db = database
+	return Rebuild()
+}
+
+// Catalogue returns the product catalogue index
+func Catalogue() *Index {
+	return catalogue
+}
+
+// Rebuild reloads every active product into the catalogue index
+func Rebuild() error {
+	started := time.Now()
+	docs, err := models.GetSearchDocuments(db)
+	if err != nil {
+		return err
+	}
+	catalogue.Replace(docs)
+	log.Printf("✅ Search index built with %d products in %v", len(docs), time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// RefreshProducts re-indexes the given products after a write. Failures are
+// logged rather than returned: the write has already been committed, and the
+// next refresh or restart corrects the index.
+func RefreshProducts(productIDs ...int) {
+	if db == nil || len(productIDs) == 0 {
+		return
+	}
+	docs, err := models.GetSearchDocuments(db, productIDs...)
+	if err != nil {
+		log.Printf("❌ Search index refresh failed for products %v: %v", productIDs, err)
+		return
+	}
+	catalogue.Update(productIDs, docs)
+}
+
+// RefreshAll rebuilds the index after a change that touches many products,
+// such as renaming a brand, logging any failure
+func RefreshAll() {
+	if db == nil {
+		return
+	}
+	if err := Rebuild(); err != nil {
+		log.Printf("❌ Search index rebuild failed: %v", err)
+	}
+}
@@ -0,0 +1,392 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"stock-management/models"
+)
+
+// How much a match in each field counts towards a product's score
+const (
+	weightName        = 3.0
+	weightModel       = 3.0
+	weightBrand       = 2.0
+	weightVariant     = 1.5
+	weightDescription = 1.0
+)
+
+// How much each kind of match is worth relative to an exact one
+const (
+	factorExact  = 1.0
+	factorPrefix = 0.75
+	factorFuzzy1 = 0.6
+	factorFuzzy2 = 0.4
+)
+
+// posting records where a term occurs in one product: in the product's own
+// fields (with the best field weight) and/or in some of its variants
+type posting struct {
+	weight   float64
+	variants map[int]bool
+}
+
+type document struct {
+	name  string
+	terms []string
+}
+
+// Index is an in-memory inverted index over the active product catalogue.
+// It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string]map[int]*posting
+	docs     map[int]document
+	terms    []string // every indexed term, sorted, for prefix and fuzzy lookups
+}
+
+// Hit is one search result. VariantIDs lists the variants the query matched
+// on; it is nil when the query matched the product itself, so every variant
+// applies.
+type Hit struct {
+	ProductID  int
+	Score      float64
+	VariantIDs []int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: map[string]map[int]*posting{},
+		docs:     map[int]document{},
+	}
+}
+
+// Replace discards the whole index and loads docs
+func (ix *Index) Replace(docs []models.SearchDocument) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.postings = map[string]map[int]*posting{}
+	ix.docs = map[int]document{}
+	for _, doc := range docs {
+		ix.add(doc)
+	}
+	ix.sortTerms()
+}
+
+// Update re-indexes the given products: each ID is dropped and, if it has a
+// document in docs, added back
+func (ix *Index) Update(productIDs []int, docs []models.SearchDocument) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for _, id := range productIDs {
+		ix.remove(id)
+	}
+	for _, doc := range docs {
+		ix.remove(doc.ProductID)
+		ix.add(doc)
+	}
+	ix.sortTerms()
+}
+
+// Len returns the number of products indexed
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+func (ix *Index) add(doc models.SearchDocument) {
+	seen := map[string]bool{}
+	addTerm := func(term string, weight float64, variantID int) {
+		productPostings, ok := ix.postings[term]
+		if !ok {
+			productPostings = map[int]*posting{}
+			ix.postings[term] = productPostings
+		}
+		p, ok := productPostings[doc.ProductID]
+		if !ok {
+			p = &posting{}
+			productPostings[doc.ProductID] = p
+		}
+		if variantID == 0 {
+			if weight > p.weight {
+				p.weight = weight
+			}
+		} else {
+			if p.variants == nil {
+				p.variants = map[int]bool{}
+			}
+			p.variants[variantID] = true
+		}
+		seen[term] = true
+	}
+	addField := func(text string, weight float64, variantID int) {
+		for _, term := range Tokenize(text) {
+			addTerm(term, weight, variantID)
+		}
+	}
+
+	addField(doc.ItemName, weightName, 0)
+	addField(doc.Model, weightModel, 0)
+	// Model numbers are typed with and without their separators
+	if compact := strings.Join(Tokenize(doc.Model), ""); compact != "" {
+		addTerm(compact, weightModel, 0)
+	}
+	addField(doc.BrandName, weightBrand, 0)
+	addField(doc.Description, weightDescription, 0)
+	for _, variant := range doc.Variants {
+		addField(variant.Size, weightVariant, variant.ID)
+		addField(variant.Color, weightVariant, variant.ID)
+		addField(variant.SKU, weightVariant, variant.ID)
+		if sku := strings.ToLower(strings.TrimSpace(variant.SKU)); sku != "" {
+			addTerm(sku, weightVariant, variant.ID)
+		}
+	}
+
+	terms := make([]string, 0, len(seen))
+	for term := range seen {
+		terms = append(terms, term)
+	}
+	ix.docs[doc.ProductID] = document{name: strings.ToLower(doc.ItemName), terms: terms}
+}
+
+func (ix *Index) remove(productID int) {
+	doc, ok := ix.docs[productID]
+	if !ok {
+		return
+	}
+	for _, term := range doc.terms {
+		delete(ix.postings[term], productID)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	delete(ix.docs, productID)
+}
+
+func (ix *Index) sortTerms() {
+	ix.terms = ix.terms[:0]
+	for term := range ix.postings {
+		ix.terms = append(ix.terms, term)
+	}
+	sort.Strings(ix.terms)
+}
+
+// tokenMatch is what one query token matched in one product
+type tokenMatch struct {
+	score       float64
+	productWide bool
+	variants    map[int]bool
+}
+
+// Search returns up to limit products matching every token of query, best
+// first. Each token matches indexed terms exactly, as a prefix, or within a
+// small edit distance, in that order of preference.
+func (ix *Index) Search(query string, limit int) []Hit {
+	tokens := Tokenize(query)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var candidates map[int][]tokenMatch
+	for i, token := range tokens {
+		matches := ix.matchToken(token)
+		if i == 0 {
+			candidates = map[int][]tokenMatch{}
+			for productID, match := range matches {
+				candidates[productID] = []tokenMatch{match}
+			}
+			continue
+		}
+		for productID := range candidates {
+			match, ok := matches[productID]
+			if !ok {
+				delete(candidates, productID)
+				continue
+			}
+			candidates[productID] = append(candidates[productID], match)
+		}
+	}
+
+	hits := make([]Hit, 0, len(candidates))
+	for productID, matches := range candidates {
+		hit := Hit{ProductID: productID}
+		var variants map[int]bool
+		for _, match := range matches {
+			hit.Score += match.score
+			if match.productWide {
+				continue
+			}
+			// Tokens that only matched variants narrow the variants shown
+			if variants == nil {
+				variants = match.variants
+				continue
+			}
+			narrowed := map[int]bool{}
+			for id := range variants {
+				if match.variants[id] {
+					narrowed[id] = true
+				}
+			}
+			variants = narrowed
+		}
+		if variants != nil {
+			if len(variants) == 0 {
+				continue
+			}
+			for id := range variants {
+				hit.VariantIDs = append(hit.VariantIDs, id)
+			}
+			sort.Ints(hit.VariantIDs)
+		}
+		hits = append(hits, hit)
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		ni, nj := ix.docs[hits[i].ProductID].name, ix.docs[hits[j].ProductID].name
+		if ni != nj {
+			return ni < nj
+		}
+		return hits[i].ProductID < hits[j].ProductID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// matchToken finds every product a single query token matches, keeping the
+// best-scoring match per product
+func (ix *Index) matchToken(token string) map[int]tokenMatch {
+	matches := map[int]tokenMatch{}
+	apply := func(term string, factor float64) {
+		for productID, p := range ix.postings[term] {
+			match := matches[productID]
+			if p.weight > 0 {
+				if score := factor * p.weight; score > match.score {
+					match.score = score
+				}
+				match.productWide = true
+			}
+			if len(p.variants) > 0 {
+				if score := factor * weightVariant; score > match.score {
+					match.score = score
+				}
+				if match.variants == nil {
+					match.variants = map[int]bool{}
+				}
+				for id := range p.variants {
+					match.variants[id] = true
+				}
+			}
+			matches[productID] = match
+		}
+	}
+
+	apply(token, factorExact)
+
+	if len([]rune(token)) >= 2 {
+		start := sort.SearchStrings(ix.terms, token)
+		for i := start; i < len(ix.terms) && strings.HasPrefix(ix.terms[i], token); i++ {
+			if ix.terms[i] != token {
+				apply(ix.terms[i], factorPrefix)
+			}
+		}
+	}
+
+	if maxDistance := fuzzyDistance(token); maxDistance > 0 {
+		query := []rune(token)
+		for _, term := range ix.terms {
+			candidate := []rune(term)
+			if diff := len(candidate) - len(query); diff > maxDistance || -diff > maxDistance {
+				continue
+			}
+			switch distance := editDistance(query, candidate, maxDistance); {
+			case distance == 1:
+				apply(term, factorFuzzy1)
+			case distance == 2 && maxDistance >= 2:
+				apply(term, factorFuzzy2)
+			}
+		}
+	}
+	return matches
+}
+
+// fuzzyDistance is the number of typos tolerated in a token: none in short
+// tokens, where a single edit changes the word entirely
+func fuzzyDistance(token string) int {
+	switch n := len([]rune(token)); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// editDistance returns the optimal string alignment distance between a and
+// b (Levenshtein plus adjacent transpositions), or max+1 once it is known
+// to exceed max
+func editDistance(a, b []rune, max int) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				curr[j] = minInt(curr[j], prev2[j-2]+1)
+			}
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+
+	if prev[len(b)] > max {
+		return max + 1
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// Tokenize lower-cases text and splits it into runs of letters and digits
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Local keeps files in a directory on this server's disk. Unsigned URLs
+// are served from baseURL (router.Static); signed ones by GET /files/*key.
+type Local struct {
+	dir     string
+	baseURL string
+	signer  urlSigner
+}
+
+func NewLocal(dir, baseURL string, secret []byte) *Local {
+	return &Local{dir: dir, baseURL: baseURL, signer: urlSigner{secret: secret}}
+}
+
+func (l *Local) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file first so readers never see a partial file
+func (l *Local) Put(key string, data []byte, contentType string) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func (l *Local) Open(key string) (io.ReadCloser, error) {
+	target, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(target)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Delete(key string) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.baseURL + key
+}
+
+func (l *Local) Key(fileURL string) (string, bool) {
+	if !strings.HasPrefix(fileURL, l.baseURL) {
+		return "", false
+	}
+	key, err := cleanKey(strings.TrimPrefix(fileURL, l.baseURL))
+	return key, err == nil
+}
+
+func (l *Local) SignedURL(key string, expiry time.Duration) (string, error) {
+	return l.signer.signedURL(key, expiry)
+}
+
+func (l *Local) VerifySignedURL(key string, expires int64, signature string) bool {
+	return l.signer.verify(key, expires, signature)
+}
+
+func (l *Local) List() ([]Object, error) {
+	var objects []Object
+	err := filepath.WalkDir(l.dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && name == l.dir {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.dir, name)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: filepath.ToSlash(rel), Size: info.Size(), ModifiedAt: info.ModTime()})
+		return nil
+	})
+	return objects, err
+}
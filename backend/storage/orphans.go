@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"stock-management/models"
+	"stock-management/utils"
+	"time"
+)
+
+// OrphanedFile is a stored file that no variant or product image refers to
+type OrphanedFile struct {
+	Object
+	URL string `json:"url"`
+	// Expired files are past the grace period and may be deleted
+	Expired bool   `json:"expired"`
+	Deleted bool   `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// OrphanReport is the outcome of one scan for orphaned files
+type OrphanReport struct {
+	ScannedAt    time.Time      `json:"scanned_at"`
+	GraceCutoff  time.Time      `json:"grace_cutoff"`
+	Scanned      int            `json:"scanned"`
+	Orphans      []OrphanedFile `json:"orphans"`
+	OrphanBytes  int64          `json:"orphan_bytes"`
+	Deleted      int            `json:"deleted"`
+	DeletedBytes int64          `json:"deleted_bytes"`
+}
+
+// FindOrphans reports the files in s that nothing in the database refers
+// to. The sizes of one upload count as referenced when any of them is.
+// Files modified after now-grace are reported but not marked expired. With
+// remove set, expired orphans are deleted.
+func FindOrphans(db *sql.DB, s Storage, grace time.Duration, remove bool) (*OrphanReport, error) {
+	now := time.Now()
+	report := &OrphanReport{ScannedAt: now, GraceCutoff: now.Add(-grace), Orphans: []OrphanedFile{}}
+
+	// Files are listed before references are loaded, so a file uploaded
+	// and attached during the scan is either missed or seen as referenced
+	objects, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	referencedURLs, err := models.GetReferencedFileURLs(db)
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := map[string]bool{}
+	for fileURL := range referencedURLs {
+		if key, ok := s.Key(fileURL); ok {
+			for _, k := range utils.ImageRenditionKeys(key) {
+				referenced[k] = true
+			}
+		}
+	}
+
+	report.Scanned = len(objects)
+	for _, object := range objects {
+		if referenced[object.Key] {
+			continue
+		}
+
+		orphan := OrphanedFile{
+			Object:  object,
+			URL:     s.URL(object.Key),
+			Expired: object.ModifiedAt.Before(report.GraceCutoff),
+		}
+		if remove && orphan.Expired {
+			if err := s.Delete(object.Key); err != nil {
+				orphan.Error = err.Error()
+			} else {
+				orphan.Deleted = true
+				report.Deleted++
+				report.DeletedBytes += object.Size
+			}
+		}
+		report.Orphans = append(report.Orphans, orphan)
+		report.OrphanBytes += object.Size
+	}
+	return report, nil
+}
+
+// StartOrphanSweep deletes expired orphans from the configured store every
+// interval until the process exits
+func StartOrphanSweep(db *sql.DB, interval, grace time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			report, err := FindOrphans(db, Files(), grace, true)
+			if err != nil {
+				log.Printf("❌ Orphaned upload sweep failed: %v", err)
+				continue
+			}
+			if report.Deleted > 0 {
+				log.Printf("✅ Deleted %d orphaned uploads (%d bytes)", report.Deleted, report.DeletedBytes)
+			}
+		}
+	}()
+}
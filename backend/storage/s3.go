@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"stock-management/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3 keeps files in a bucket of any S3-compatible service (AWS, MinIO,
+// R2, ...), signing requests with AWS Signature Version 4
+type S3 struct {
+	settings config.S3Settings
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	// Longest validity S3 accepts for a presigned URL
+	s3MaxPresign = 7 * 24 * time.Hour
+)
+
+func NewS3(settings config.S3Settings) (*S3, error) {
+	if settings.Bucket == "" || settings.AccessKey == "" || settings.SecretKey == "" {
+		return nil, errors.New("S3 storage needs S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(settings.Endpoint, "/"))
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", settings.Endpoint)
+	}
+	return &S3{
+		settings: settings,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		now:      time.Now,
+	}, nil
+}
+
+// objectURL returns the host and escaped path of a key
+func (s *S3) objectURL(key string) (host, escapedPath string) {
+	if s.settings.PathStyle {
+		return s.endpoint.Host, s.endpoint.EscapedPath() + "/" + s3Escape(s.settings.Bucket, false) + "/" + s3Escape(key, false)
+	}
+	return s.settings.Bucket + "." + s.endpoint.Host, s.endpoint.EscapedPath() + "/" + s3Escape(key, false)
+}
+
+func (s *S3) Put(key string, data []byte, contentType string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPut, key, nil, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return s3Error(resp, "put", key)
+}
+
+func (s *S3) Open(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if err := s3Error(resp, "get", key); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return s3Error(resp, "delete", key)
+}
+
+func (s *S3) URL(key string) string {
+	if s.settings.PublicURL != "" {
+		return strings.TrimSuffix(s.settings.PublicURL, "/") + "/" + key
+	}
+	host, escapedPath := s.objectURL(key)
+	return s.endpoint.Scheme + "://" + host + escapedPath
+}
+
+func (s *S3) Key(fileURL string) (string, bool) {
+	base := s.URL("")
+	if !strings.HasPrefix(fileURL, base) {
+		return "", false
+	}
+	key, err := url.PathUnescape(strings.TrimPrefix(fileURL, base))
+	if err != nil {
+		return "", false
+	}
+	key, err = cleanKey(key)
+	return key, err == nil
+}
+
+// SignedURL returns a presigned GET URL for the object
+func (s *S3) SignedURL(key string, expiry time.Duration) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	if expiry > s3MaxPresign {
+		expiry = s3MaxPresign
+	}
+
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.scope(now)
+	host, escapedPath := s.objectURL(key)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.settings.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	canonicalQuery := s3CanonicalQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet, escapedPath, canonicalQuery, "host:" + host + "\n", "host", s3UnsignedPayload,
+	}, "\n")
+	signature := s.signature(now, amzDate, scope, canonicalRequest)
+
+	return s.endpoint.Scheme + "://" + host + escapedPath + "?" + canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+func (s *S3) do(method, key string, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	host, escapedPath := s.objectURL(key)
+	canonicalQuery := s3CanonicalQuery(query)
+	target := s.endpoint.Scheme + "://" + host + escapedPath
+	if canonicalQuery != "" {
+		target += "?" + canonicalQuery
+	}
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, host, escapedPath, canonicalQuery, body)
+	return s.client.Do(req)
+}
+
+// sign adds the Authorization header to a request
+func (s *S3) sign(req *http.Request, host, escapedPath, canonicalQuery string, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		headers["content-type"] = contentType
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, escapedPath, canonicalQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := s.scope(now)
+	req.Header.Set("Authorization", s3Algorithm+" Credential="+s.settings.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+s.signature(now, amzDate, scope, canonicalRequest))
+}
+
+func (s *S3) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.settings.Region + "/s3/aws4_request"
+}
+
+func (s *S3) signature(now time.Time, amzDate, scope, canonicalRequest string) string {
+	stringToSign := s3Algorithm + "\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+s.settings.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.settings.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// List pages through the bucket with ListObjectsV2
+func (s *S3) List() ([]Object, error) {
+	var objects []Object
+	query := url.Values{"list-type": {"2"}}
+	for {
+		resp, err := s.do(http.MethodGet, "", query, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		var page s3ListResult
+		err = s3Error(resp, "list", s.settings.Bucket)
+		if err == nil {
+			err = xml.NewDecoder(resp.Body).Decode(&page)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range page.Contents {
+			objects = append(objects, Object{Key: object.Key, Size: object.Size, ModifiedAt: object.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+func s3Error(resp *http.Response, op, key string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("S3 %s %s: %s: %s", op, key, resp.Status, strings.TrimSpace(string(detail)))
+}
+
+// s3Escape is the URI encoding SigV4 expects: everything but unreserved
+// characters is percent-encoded, and '/' too unless encoding a path
+func s3Escape(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, s3Escape(key, true)+"="+s3Escape(query.Get(key), true))
+	}
+	return strings.Join(parts, "&")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"stock-management/config"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a path-style S3 stand-in. It checks presigned GETs the way S3
+// does, recomputing the signature with the client's own signer and
+// rejecting URLs past X-Amz-Date + X-Amz-Expires; other requests only need
+// an Authorization header.
+type fakeS3 struct {
+	signer  *S3
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/"+f.signer.settings.Bucket+"/")
+	query := r.URL.Query()
+
+	if query.Get("X-Amz-Signature") != "" {
+		if status := f.checkPresigned(r); status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	} else if !strings.HasPrefix(r.Header.Get("Authorization"), s3Algorithm+" Credential=") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		if _, ok := f.objects[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) checkPresigned(r *http.Request) int {
+	query := r.URL.Query()
+	signature := query.Get("X-Amz-Signature")
+	query.Del("X-Amz-Signature")
+
+	signedAt, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		return http.StatusBadRequest
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return http.StatusBadRequest
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method, r.URL.EscapedPath(), s3CanonicalQuery(query), "host:" + r.Host + "\n", "host", s3UnsignedPayload,
+	}, "\n")
+	want := f.signer.signature(signedAt, query.Get("X-Amz-Date"), f.signer.scope(signedAt), canonicalRequest)
+	if signature != want {
+		return http.StatusForbidden
+	}
+	if f.signer.now().After(signedAt.Add(time.Duration(expires) * time.Second)) {
+		return http.StatusForbidden
+	}
+	return http.StatusOK
+}
+
+func newTestS3(t *testing.T) (*S3, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s, err := NewS3(config.S3Settings{
+		Endpoint:  server.URL,
+		Region:    "us-east-1",
+		Bucket:    "uploads",
+		AccessKey: "test-access",
+		SecretKey: "test-secret",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.signer = s
+	return s, fake
+}
+
+func TestS3PutOpenDelete(t *testing.T) {
+	s, _ := newTestS3(t)
+
+	if err := s.Put("products/1/shoe.jpg", []byte("jpeg"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.Open("products/1/shoe.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "jpeg" {
+		t.Fatalf("read back %q", data)
+	}
+
+	if err := s.Delete("products/1/shoe.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open("products/1/shoe.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Open after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete("products/1/shoe.jpg"); err != nil {
+		t.Fatalf("Delete of a missing key: %v", err)
+	}
+
+	if err := s.Put("../escape.jpg", []byte("x"), "image/jpeg"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Put outside the bucket prefix error = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestS3SignedURL(t *testing.T) {
+	s, _ := newTestS3(t)
+	if err := s.Put("products/1/shoe.jpg", []byte("jpeg"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := s.SignedURL("products/1/shoe.jpg", 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(target string) int {
+		t.Helper()
+		resp, err := http.Get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := get(signed); status != http.StatusOK {
+		t.Fatalf("fresh signed URL got %d", status)
+	}
+
+	u, _ := url.Parse(signed)
+	tamper := func(edit func(*url.URL)) string {
+		copied := *u
+		edit(&copied)
+		return copied.String()
+	}
+	tampered := map[string]string{
+		"other key": tamper(func(u *url.URL) {
+			u.Path = strings.Replace(u.Path, "shoe.jpg", "other.jpg", 1)
+			u.RawPath = ""
+		}),
+		"longer expiry": tamper(func(u *url.URL) {
+			u.RawQuery = strings.Replace(u.RawQuery, "X-Amz-Expires=900", "X-Amz-Expires=86400", 1)
+		}),
+		"edited signature": tamper(func(u *url.URL) {
+			q := u.Query()
+			q.Set("X-Amz-Signature", strings.Repeat("0", 64))
+			u.RawQuery = q.Encode()
+		}),
+	}
+	for name, target := range tampered {
+		if target == signed {
+			t.Fatalf("%s: tampering left the URL unchanged", name)
+		}
+		if status := get(target); status != http.StatusForbidden {
+			t.Errorf("%s: got %d, want 403", name, status)
+		}
+	}
+
+	// The stand-in shares the client's clock, so moving it forward ages
+	// the URL without waiting
+	start := time.Now()
+	s.now = func() time.Time { return start.Add(16 * time.Minute) }
+	if status := get(signed); status != http.StatusForbidden {
+		t.Fatalf("expired signed URL got %d, want 403", status)
+	}
+}
+
+func TestS3SignedURLExpiryIsCapped(t *testing.T) {
+	s, _ := newTestS3(t)
+	signed, err := s.SignedURL("a.jpg", 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(signed)
+	if got, want := u.Query().Get("X-Amz-Expires"), strconv.Itoa(int(s3MaxPresign/time.Second)); got != want {
+		t.Fatalf("X-Amz-Expires = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"stock-management/config"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("file not found")
+	ErrInvalidKey = errors.New("invalid file key")
+)
+
+// Storage keeps uploaded files. Keys are slash-separated relative paths;
+// URL turns a key into the address stored in the database and Key reverses
+// it for files this backend holds.
+type Storage interface {
+	Put(key string, data []byte, contentType string) error
+	// Open returns ErrNotFound when the key does not exist
+	Open(key string) (io.ReadCloser, error)
+	// Delete succeeds when the key is already gone
+	Delete(key string) error
+	URL(key string) string
+	Key(fileURL string) (string, bool)
+	// SignedURL grants time-limited access to a file without other
+	// credentials
+	SignedURL(key string, expiry time.Duration) (string, error)
+	// List returns every stored file
+	List() ([]Object, error)
+}
+
+// Object describes one stored file
+type Object struct {
+	Key        string    `json:"key"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// SignedURLVerifier is implemented by backends whose signed URLs point back
+// at this API (GET /files/*key) instead of at the storage service
+type SignedURLVerifier interface {
+	VerifySignedURL(key string, expires int64, signature string) bool
+}
+
+var (
+	mu    sync.RWMutex
+	files Storage
+)
+
+// Init sets up the backend chosen by STORAGE_DRIVER
+func Init() error {
+	var s Storage
+	switch driver := config.GetStorageDriver(); driver {
+	case "local":
+		s = NewLocal(config.GetUploadDir(), "/uploads/", config.GetStorageSigningKey())
+	case "s3":
+		var err error
+		if s, err = NewS3(config.GetS3Settings()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+	Use(s)
+	return nil
+}
+
+// Use replaces the backend, e.g. with a Memory store in tests
+func Use(s Storage) {
+	mu.Lock()
+	files = s
+	mu.Unlock()
+}
+
+// Files returns the backend in use
+func Files() Storage {
+	mu.RLock()
+	defer mu.RUnlock()
+	return files
+}
+
+// cleanKey rejects keys that are empty, absolute or climb out of the store
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return cleaned, nil
+}
+
+// escapeKey escapes each segment of a key for use in a URL path
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// urlSigner signs URLs served by the API at /files/<key>
+type urlSigner struct {
+	secret []byte
+}
+
+const signedFilePath = "/files/"
+
+func (s urlSigner) signature(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s urlSigner) signedURL(key string, expiry time.Duration) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	expires := time.Now().Add(expiry).Unix()
+	return signedFilePath + escapeKey(key) + "?expires=" + strconv.FormatInt(expires, 10) +
+		"&signature=" + s.signature(key, expires), nil
+}
+
+func (s urlSigner) verify(key string, expires int64, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.signature(key, expires)))
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseSignedURL splits a /files/<key>?expires=...&signature=... URL
+func parseSignedURL(t *testing.T, signed string) (string, int64, string) {
+	t.Helper()
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parse %q: %v", signed, err)
+	}
+	if !strings.HasPrefix(u.Path, signedFilePath) {
+		t.Fatalf("signed URL %q is not under %s", signed, signedFilePath)
+	}
+	expires, err := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	if err != nil {
+		t.Fatalf("signed URL %q has no expires: %v", signed, err)
+	}
+	return strings.TrimPrefix(u.Path, signedFilePath), expires, u.Query().Get("signature")
+}
+
+func TestMemorySignedURL(t *testing.T) {
+	m := NewMemory()
+	if err := m.Put("products/1/shoe.jpg", []byte("jpeg"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := m.SignedURL("products/1/shoe.jpg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, expires, signature := parseSignedURL(t, signed)
+	if key != "products/1/shoe.jpg" {
+		t.Fatalf("key = %q", key)
+	}
+	if !m.VerifySignedURL(key, expires, signature) {
+		t.Fatal("fresh signed URL was rejected")
+	}
+
+	tampered := []struct {
+		name      string
+		key       string
+		expires   int64
+		signature string
+	}{
+		{"other key", "products/1/other.jpg", expires, signature},
+		{"later expiry", key, expires + 3600, signature},
+		{"edited signature", key, expires, strings.Repeat("0", len(signature))},
+		{"empty signature", key, expires, ""},
+	}
+	for _, tc := range tampered {
+		if m.VerifySignedURL(tc.key, tc.expires, tc.signature) {
+			t.Errorf("%s: tampered URL was accepted", tc.name)
+		}
+	}
+
+	if NewMemory().VerifySignedURL(key, expires, signature) {
+		t.Error("URL signed by one store was accepted by another with a different key")
+	}
+}
+
+func TestSignedURLExpiry(t *testing.T) {
+	m := NewMemory()
+	signed, err := m.SignedURL("a.jpg", -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, expires, signature := parseSignedURL(t, signed)
+	if m.VerifySignedURL(key, expires, signature) {
+		t.Fatal("expired signed URL was accepted")
+	}
+}
+
+func TestSignedURLRejectsBadKeys(t *testing.T) {
+	m := NewMemory()
+	for _, key := range []string{"", "/etc/passwd", "../secret", "a/../../b", `a\b`, "a//b", "./a"} {
+		if _, err := m.SignedURL(key, time.Minute); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("SignedURL(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestLocalPathTraversal(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "uploads")
+	l := NewLocal(dir, "/uploads/", []byte("test-key"))
+
+	if err := l.Put("products/1/shoe.jpg", []byte("jpeg"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := l.Open("products/1/shoe.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "jpeg" {
+		t.Fatalf("read back %q", data)
+	}
+
+	outside := filepath.Join(root, "escaped.txt")
+	for _, key := range []string{"../escaped.txt", "products/../../escaped.txt", "/" + outside, `..\escaped.txt`} {
+		if err := l.Put(key, []byte("x"), "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := l.Open(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Open(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if err := l.Delete(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Fatalf("a file was written outside the upload directory: %v", err)
+	}
+
+	if _, ok := l.Key("/uploads/../escaped.txt"); ok {
+		t.Error("Key accepted a URL climbing out of the upload directory")
+	}
+	if key, ok := l.Key("/uploads/products/1/shoe.jpg"); !ok || key != "products/1/shoe.jpg" {
+		t.Errorf("Key = %q, %v", key, ok)
+	}
+
+	if _, err := l.Open("products/1/missing.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open of a missing file error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	l := NewLocal(t.TempDir(), "/uploads/", []byte("test-key"))
+	signed, err := l.SignedURL("products/1/shoe.jpg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, expires, signature := parseSignedURL(t, signed)
+	if !l.VerifySignedURL(key, expires, signature) {
+		t.Fatal("fresh signed URL was rejected")
+	}
+	if NewLocal(t.TempDir(), "/uploads/", []byte("other-key")).VerifySignedURL(key, expires, signature) {
+		t.Fatal("URL was accepted under a different signing key")
+	}
+}
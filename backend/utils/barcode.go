@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidEAN13 = errors.New("invalid EAN-13 barcode")
+
+// EAN-13 digit encodings. R codes are the complement of L codes and G codes
+// are R codes reversed.
+var ean13LCodes = [10]string{
+	"0001101", "0011001", "0010011", "0111101", "0100011",
+	"0110001", "0101111", "0111011", "0110111", "0001011",
+}
+
+// The first digit is not drawn; it selects which left-hand digits use G codes
+var ean13Parity = [10]string{
+	"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG",
+	"LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL",
+}
+
+// EAN13CheckDigit computes the check digit for the first 12 digits of an
+// EAN-13 code
+func EAN13CheckDigit(digits string) (int, error) {
+	if len(digits) != 12 || !isDigits(digits) {
+		return 0, ErrInvalidEAN13
+	}
+
+	sum := 0
+	for i, d := range digits {
+		n := int(d - '0')
+		if i%2 == 1 {
+			n *= 3
+		}
+		sum += n
+	}
+	return (10 - sum%10) % 10, nil
+}
+
+// IsValidEAN13 reports whether code is 13 digits with a correct check digit
+func IsValidEAN13(code string) bool {
+	if len(code) != 13 || !isDigits(code) {
+		return false
+	}
+	check, err := EAN13CheckDigit(code[:12])
+	return err == nil && check == int(code[12]-'0')
+}
+
+// LooksLikeEAN13 reports whether code is meant to be an EAN-13, i.e. it is
+// 13 digits long. Such codes must also pass IsValidEAN13.
+func LooksLikeEAN13(code string) bool {
+	return len(code) == 13 && isDigits(code)
+}
+
+// GenerateEAN13 builds an EAN-13 from a numeric prefix (e.g. the 200-299
+// in-store range) and a sequence number, zero-padded to 12 digits before the
+// check digit is appended
+func GenerateEAN13(prefix string, sequence int) (string, error) {
+	body := fmt.Sprintf("%s%0*d", prefix, 12-len(prefix), sequence)
+	if len(body) != 12 || !isDigits(body) {
+		return "", fmt.Errorf("%w: prefix %q cannot hold sequence %d", ErrInvalidEAN13, prefix, sequence)
+	}
+
+	check, err := EAN13CheckDigit(body)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d", body, check), nil
+}
+
+// EAN13Modules returns the 95 bar modules of code as a string of '1' (bar)
+// and '0' (space), guard bars included
+func EAN13Modules(code string) (string, error) {
+	if !IsValidEAN13(code) {
+		return "", ErrInvalidEAN13
+	}
+
+	var b strings.Builder
+	b.WriteString("101")
+
+	parity := ean13Parity[code[0]-'0']
+	for i := 1; i <= 6; i++ {
+		l := ean13LCodes[code[i]-'0']
+		if parity[i-1] == 'G' {
+			l = reverse(complement(l))
+		}
+		b.WriteString(l)
+	}
+
+	b.WriteString("01010")
+
+	for i := 7; i <= 12; i++ {
+		b.WriteString(complement(ean13LCodes[code[i]-'0']))
+	}
+
+	b.WriteString("101")
+	return b.String(), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func complement(bits string) string {
+	out := []byte(bits)
+	for i, b := range out {
+		if b == '0' {
+			out[i] = '1'
+		} else {
+			out[i] = '0'
+		}
+	}
+	return string(out)
+}
+
+func reverse(s string) string {
+	out := []byte(s)
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
@@ -0,0 +1,294 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedImage = errors.New("image must be a JPEG, PNG or WebP file")
+	ErrImageTooLarge    = errors.New("image dimensions are too large")
+)
+
+// Upload formats recognised by their magic bytes
+const (
+	ImageJPEG = "jpeg"
+	ImagePNG  = "png"
+	ImageWebP = "webp"
+)
+
+const (
+	// Decoding is refused above this many pixels so a small compressed file
+	// cannot expand into gigabytes of memory
+	maxImagePixels = 50 * 1000 * 1000
+	jpegQuality    = 82
+)
+
+// ImageSize is one rendition produced for every upload; images are scaled
+// down to fit MaxDimension on their longer side and never scaled up
+type ImageSize struct {
+	Name         string
+	MaxDimension int
+}
+
+var ImageSizes = []ImageSize{
+	{"thumbnail", 200},
+	{"medium", 800},
+	{"full", 2000},
+}
+
+// ImageRenditionKeys expands the storage key of one size of an upload to
+// the keys of every size, which are stored and removed together. Other keys
+// are returned on their own.
+func ImageRenditionKeys(key string) []string {
+	ext := path.Ext(key)
+	stem := strings.TrimSuffix(key, ext)
+	for _, size := range ImageSizes {
+		if !strings.HasSuffix(stem, "_"+size.Name) {
+			continue
+		}
+		base := strings.TrimSuffix(stem, size.Name)
+		keys := make([]string, len(ImageSizes))
+		for i, other := range ImageSizes {
+			keys[i] = base + other.Name + ext
+		}
+		return keys
+	}
+	return []string{key}
+}
+
+type imageCodec struct {
+	decode func(io.Reader) (image.Image, error)
+	config func(io.Reader) (image.Config, error)
+}
+
+var imageCodecs = map[string]imageCodec{
+	ImageJPEG: {jpeg.Decode, jpeg.DecodeConfig},
+	ImagePNG:  {png.Decode, png.DecodeConfig},
+	ImageWebP: {webp.Decode, webp.DecodeConfig},
+}
+
+// ProcessedImage is one re-encoded rendition of an upload
+type ProcessedImage struct {
+	Size        string
+	Width       int
+	Height      int
+	Extension   string
+	ContentType string
+	Data        []byte
+}
+
+// DetectImageFormat identifies JPEG, PNG and WebP data by its leading bytes,
+// returning "" for anything else
+func DetectImageFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return ImageJPEG
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return ImagePNG
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return ImageWebP
+	}
+	return ""
+}
+
+// ProcessImage validates an upload by content, then decodes it and
+// re-encodes it at each of ImageSizes. Only pixels survive re-encoding, so
+// EXIF and other metadata are dropped; the EXIF orientation of JPEGs is
+// applied first so photos stay upright. Images with transparency are
+// written as PNG, everything else as JPEG.
+func ProcessImage(data []byte) ([]ProcessedImage, error) {
+	format := DetectImageFormat(data)
+	codec, ok := imageCodecs[format]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+
+	cfg, err := codec.config(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	src, err := codec.decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	orientation := 1
+	if format == ImageJPEG {
+		orientation = jpegOrientation(data)
+	}
+	opaque := isOpaque(src)
+
+	var out []ProcessedImage
+	for _, size := range ImageSizes {
+		scaled := scaleToFit(src, size.MaxDimension)
+		scaled = orient(scaled, orientation)
+
+		processed := ProcessedImage{
+			Size:   size.Name,
+			Width:  scaled.Bounds().Dx(),
+			Height: scaled.Bounds().Dy(),
+		}
+		var buf bytes.Buffer
+		if opaque {
+			processed.Extension, processed.ContentType = ".jpg", "image/jpeg"
+			err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: jpegQuality})
+		} else {
+			processed.Extension, processed.ContentType = ".png", "image/png"
+			err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, scaled)
+		}
+		if err != nil {
+			return nil, err
+		}
+		processed.Data = buf.Bytes()
+		out = append(out, processed)
+	}
+	return out, nil
+}
+
+// scaleToFit copies src into a new image no larger than maxDimension on
+// either side, keeping its aspect ratio
+func scaleToFit(src image.Image, maxDimension int) *image.NRGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w > maxDimension || h > maxDimension {
+		if w >= h {
+			w, h = maxDimension, h*maxDimension/w
+		} else {
+			w, h = w*maxDimension/h, maxDimension
+		}
+		if w < 1 {
+			w = 1
+		}
+		if h < 1 {
+			h = 1
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	if w == src.Bounds().Dx() && h == src.Bounds().Dy() {
+		draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+	} else {
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+	}
+	return dst
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// orient applies an EXIF orientation (1-8) to img
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° anticlockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], img.Pix[img.PixOffset(x, y):img.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the orientation tag from a JPEG's EXIF block,
+// returning 1 (upright) when there is none or it cannot be parsed
+func jpegOrientation(data []byte) int {
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			// Start of scan or end of image; metadata comes before these
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value < 1 || value > 8 {
+				return 1
+			}
+			return value
+		}
+	}
+	return 1
+}
@@ -10,9 +10,17 @@ import (
 type Claims struct {
 	UserID int    `json:"user_id"`
 	Role   string `json:"role"`
+	// Purpose is empty for normal session tokens. Restricted tokens issued
+	// during two-factor login carry TokenPurposeMFA or TokenPurposeMFASetup.
+	Purpose string `json:"purpose,omitempty"`
 	jwt.StandardClaims
 }
 
+const (
+	TokenPurposeMFA      = "mfa"
+	TokenPurposeMFASetup = "mfa_setup"
+)
+
 func GenerateJWT(userID int, role string) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour)
 	
@@ -29,6 +37,23 @@ func GenerateJWT(userID int, role string) (string, error) {
 	return token.SignedString(config.GetJWTSecret())
 }
 
+// GenerateScopedJWT issues a short-lived token that only unlocks a single
+// step of the two-factor login flow
+func GenerateScopedJWT(userID int, role, purpose string, ttl time.Duration) (string, error) {
+	claims := &Claims{
+		UserID:  userID,
+		Role:    role,
+		Purpose: purpose,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(config.GetJWTSecret())
+}
+
 func ValidateJWT(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	
@@ -95,7 +95,7 @@ func EnhancedLoginCheck(identifier, password string) (*models.User, error) {
 // findUserByAnyIdentifier performs a broader search for the user
 func findUserByAnyIdentifier(db *sql.DB, identifier string) (*models.User, error) {
 	// Try case-insensitive username search
-	query := `SELECT id, username, email, password, role, is_active, last_login, created_at, updated_at 
+	query := `SELECT id, username, email, password, role, is_active, totp_enabled, last_login, created_at, updated_at 
 	          FROM users WHERE (LOWER(username) = LOWER(?) OR LOWER(email) = LOWER(?)) AND is_active = true`
 	
 	var user models.User
@@ -108,6 +108,7 @@ func findUserByAnyIdentifier(db *sql.DB, identifier string) (*models.User, error
 		&user.Password,
 		&user.Role,
 		&user.IsActive,
+		&user.TOTPEnabled,
 		&lastLogin,
 		&user.CreatedAt,
 		&user.UpdatedAt,
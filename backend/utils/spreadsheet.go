@@ -0,0 +1,289 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnsupportedSpreadsheet = errors.New("unsupported spreadsheet: upload a .csv or .xlsx file")
+	ErrSpreadsheetTooLarge    = errors.New("spreadsheet too large")
+)
+
+const (
+	// maxSpreadsheetColumns is Excel's own limit, column XFD
+	maxSpreadsheetColumns = 16384
+	// maxXLSXPartBytes caps how much of one zip entry is decompressed, so a
+	// small upload cannot expand into gigabytes of XML
+	maxXLSXPartBytes = 32 << 20
+)
+
+// ReadSpreadsheet returns the rows of a CSV file or of the first worksheet
+// of an XLSX workbook. XLSX is recognised by its zip signature, so the file
+// name is only used to reject other formats. Sheets with more than maxRows
+// rows fail with ErrSpreadsheetTooLarge while they are read.
+func ReadSpreadsheet(filename string, data []byte, maxRows int) ([][]string, error) {
+	ext := strings.ToLower(path.Ext(filename))
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return ReadXLSX(data, maxRows)
+	case ext == ".csv" || ext == ".txt" || ext == "":
+		return ReadCSV(bytes.NewReader(data), maxRows)
+	default:
+		return nil, ErrUnsupportedSpreadsheet
+	}
+}
+
+// ReadCSV reads comma-separated rows, tolerating a UTF-8 byte order mark and
+// rows of differing length. Blank lines are kept as empty rows so rows[i]
+// starts on line i+1.
+func ReadCSV(r io.Reader, maxRows int) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rows [][]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if line > maxRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrSpreadsheetTooLarge, maxRows)
+		}
+		for len(rows) < line-1 {
+			rows = append(rows, nil)
+		}
+		rows = append(rows, record)
+	}
+
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+	}
+	return rows, nil
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var text strings.Builder
+	for _, run := range t.Runs {
+		text.WriteString(run.Text)
+	}
+	return text.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadXLSX returns the cell values of the first worksheet as text. Rows and
+// cells keep their position in the sheet, so rows[i] is sheet row i+1.
+// Row numbers past maxRows and columns past XFD are rejected before any
+// padding is allocated for them.
+func ReadXLSX(data []byte, maxRows int) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedSpreadsheet, err)
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared xlsxSharedStrings
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeZipXML(file, &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	file, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("%w: worksheet %s missing", ErrUnsupportedSpreadsheet, sheetPath)
+	}
+	var sheet xlsxWorksheet
+	if err := decodeZipXML(file, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		if row.Number > maxRows || len(rows) >= maxRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrSpreadsheetTooLarge, maxRows)
+		}
+		for row.Number > len(rows)+1 {
+			rows = append(rows, nil)
+		}
+
+		var values []string
+		for i, cell := range row.Cells {
+			column := i
+			if cell.Ref != "" {
+				column = columnIndex(cell.Ref)
+			}
+			if column >= maxSpreadsheetColumns {
+				return nil, fmt.Errorf("%w: cell %q is past column XFD", ErrSpreadsheetTooLarge, cell.Ref)
+			}
+			if column < 0 {
+				return nil, fmt.Errorf("%w: bad cell reference %q", ErrUnsupportedSpreadsheet, cell.Ref)
+			}
+			for len(values) <= column {
+				values = append(values, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(shared.Items) {
+					return nil, fmt.Errorf("cell %s: bad shared string %q", cell.Ref, cell.Value)
+				}
+				values[column] = shared.Items[index].String()
+			case "inlineStr":
+				values[column] = cell.Inline.String()
+			case "b":
+				values[column] = map[string]string{"1": "TRUE", "0": "FALSE"}[cell.Value]
+			case "str", "e":
+				values[column] = cell.Value
+			default:
+				values[column] = formatXLSXNumber(cell.Value)
+			}
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+// firstSheetPath resolves the first sheet listed in the workbook to its part
+// name in the archive
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	var workbook xlsxWorkbook
+	var rels xlsxRelationships
+	workbookFile, ok := files["xl/workbook.xml"]
+	relsFile, relsOK := files["xl/_rels/workbook.xml.rels"]
+	if !ok || !relsOK {
+		return "", fmt.Errorf("%w: not an XLSX workbook", ErrUnsupportedSpreadsheet)
+	}
+	if err := decodeZipXML(workbookFile, &workbook); err != nil {
+		return "", err
+	}
+	if err := decodeZipXML(relsFile, &rels); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", fmt.Errorf("%w: workbook has no sheets", ErrUnsupportedSpreadsheet)
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].RelID {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return "", fmt.Errorf("%w: first sheet not found", ErrUnsupportedSpreadsheet)
+}
+
+// decodeZipXML decodes one archive entry, reading at most maxXLSXPartBytes
+// of it whatever size its header claims
+func decodeZipXML(file *zip.File, v interface{}) error {
+	tooLarge := fmt.Errorf("%w: %s is over %d MB uncompressed", ErrSpreadsheetTooLarge, file.Name, maxXLSXPartBytes>>20)
+	if file.UncompressedSize64 > maxXLSXPartBytes {
+		return tooLarge
+	}
+
+	r, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	limited := &io.LimitedReader{R: r, N: maxXLSXPartBytes + 1}
+	err = xml.NewDecoder(limited).Decode(v)
+	if limited.N <= 0 {
+		return tooLarge
+	}
+	return err
+}
+
+// columnIndex converts the letters of a cell reference such as "AB12" to a
+// zero-based column number. References past column XFD return
+// maxSpreadsheetColumns rather than letting a long run of letters overflow,
+// and references without letters return -1.
+func columnIndex(ref string) int {
+	column := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A') + 1
+		if column > maxSpreadsheetColumns {
+			return maxSpreadsheetColumns
+		}
+	}
+	return column - 1
+}
+
+// formatXLSXNumber writes numbers Excel stored in exponent form, such as
+// barcodes, out in full
+func formatXLSXNumber(value string) string {
+	if !strings.ContainsAny(value, "eE") {
+		return value
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnknownExportFormat = errors.New("format must be csv, xlsx or jsonl")
+
+// Export formats
+const (
+	FormatCSV        = "csv"
+	FormatXLSX       = "xlsx"
+	FormatJSONLines  = "jsonl"
+	exportTimeLayout = "2006-01-02 15:04:05"
+)
+
+// TableWriter streams rows of a fixed set of columns in one export format.
+// Row values may be nil, string, int, int64, float64, bool or time.Time.
+type TableWriter interface {
+	WriteRow(values []interface{}) error
+	// Flush pushes buffered rows to the underlying writer
+	Flush() error
+	// Close writes anything the format needs after the last row. It does not
+	// close the underlying writer.
+	Close() error
+	// Abort ends an export that failed part-way through so the output
+	// cannot be mistaken for a complete file: CSV and JSON Lines get a final
+	// error line, and an XLSX workbook is left without its zip directory.
+	Abort(cause error) error
+}
+
+// ExportContentType returns the MIME type for an export format, or "" if the
+// format is unknown
+func ExportContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatJSONLines:
+		return "application/x-ndjson"
+	}
+	return ""
+}
+
+// NewTableWriter starts an export in format on w, writing the header where
+// the format has one
+func NewTableWriter(format string, w io.Writer, columns []string) (TableWriter, error) {
+	switch format {
+	case FormatCSV:
+		writer := &csvTableWriter{w: csv.NewWriter(w)}
+		return writer, writer.w.Write(columns)
+	case FormatJSONLines:
+		return &jsonLinesTableWriter{w: bufio.NewWriter(w), columns: columns}, nil
+	case FormatXLSX:
+		return newXLSXTableWriter(w, columns)
+	}
+	return nil, ErrUnknownExportFormat
+}
+
+// exportCell formats a value for a spreadsheet cell. Strings that a
+// spreadsheet would run as a formula get a leading apostrophe; numbers are
+// left alone so negative values stay numeric.
+func exportCell(value interface{}) string {
+	text := exportText(value)
+	if _, ok := value.(string); ok && text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// exportText formats a value for text formats
+func exportText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(exportTimeLayout)
+	}
+	return ""
+}
+
+type csvTableWriter struct {
+	w *csv.Writer
+}
+
+func (t *csvTableWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = exportCell(value)
+	}
+	return t.w.Write(record)
+}
+
+func (t *csvTableWriter) Flush() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+func (t *csvTableWriter) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+func (t *csvTableWriter) Abort(cause error) error {
+	t.w.Write([]string{"#ERROR: export incomplete: " + cause.Error()})
+	return t.Close()
+}
+
+type jsonLinesTableWriter struct {
+	w       *bufio.Writer
+	columns []string
+}
+
+// WriteRow writes one JSON object per line with keys in column order
+func (t *jsonLinesTableWriter) WriteRow(values []interface{}) error {
+	var line bytes.Buffer
+	line.WriteByte('{')
+	for i, column := range t.columns {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		line.Write(key)
+		line.WriteByte(':')
+
+		var value interface{}
+		if i < len(values) {
+			value = values[i]
+		}
+		if ts, ok := value.(time.Time); ok {
+			value = ts.Format(time.RFC3339)
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		line.Write(encoded)
+	}
+	line.WriteString("}\n")
+	_, err := t.w.Write(line.Bytes())
+	return err
+}
+
+func (t *jsonLinesTableWriter) Flush() error {
+	return t.w.Flush()
+}
+
+func (t *jsonLinesTableWriter) Close() error {
+	return t.w.Flush()
+}
+
+// Abort writes {"error": ...} as the last line, which has none of the
+// export's columns
+func (t *jsonLinesTableWriter) Abort(cause error) error {
+	line, _ := json.Marshal(map[string]string{"error": "export incomplete: " + cause.Error()})
+	t.w.Write(append(line, '\n'))
+	return t.w.Flush()
+}
+
+// xlsxTableWriter streams a single-sheet workbook. The fixed workbook parts
+// are written first so the sheet can be the last, open-ended zip entry.
+type xlsxTableWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	row   int
+}
+
+var xlsxStaticParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Export" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`},
+}
+
+func newXLSXTableWriter(w io.Writer, columns []string) (*xlsxTableWriter, error) {
+	t := &xlsxTableWriter{zip: zip.NewWriter(w)}
+	for _, part := range xlsxStaticParts {
+		f, err := t.zip.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := t.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	t.sheet = bufio.NewWriter(f)
+	t.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column
+	}
+	return t, t.WriteRow(header)
+}
+
+func (t *xlsxTableWriter) WriteRow(values []interface{}) error {
+	t.row++
+	rowNumber := strconv.Itoa(t.row)
+	t.sheet.WriteString(`<row r="` + rowNumber + `">`)
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		ref := columnName(i) + rowNumber
+		switch v := value.(type) {
+		case int, int64, float64:
+			t.sheet.WriteString(`<c r="` + ref + `"><v>` + exportText(v) + `</v></c>`)
+		case bool:
+			flag := "0"
+			if v {
+				flag = "1"
+			}
+			t.sheet.WriteString(`<c r="` + ref + `" t="b"><v>` + flag + `</v></c>`)
+		default:
+			t.sheet.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+			if err := xml.EscapeText(t.sheet, []byte(exportCell(v))); err != nil {
+				return err
+			}
+			t.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := t.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (t *xlsxTableWriter) Flush() error {
+	if err := t.sheet.Flush(); err != nil {
+		return err
+	}
+	return t.zip.Flush()
+}
+
+func (t *xlsxTableWriter) Close() error {
+	t.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := t.sheet.Flush(); err != nil {
+		return err
+	}
+	return t.zip.Close()
+}
+
+// Abort sends what was buffered but never closes the archive, so the
+// workbook has no central directory and spreadsheet programs refuse it
+func (t *xlsxTableWriter) Abort(cause error) error {
+	return t.Flush()
+}
+
+// columnName converts a zero-based column number to its letters (A, B, ...
+// Z, AA, ...)
+func columnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
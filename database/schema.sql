@@ -304,4 +304,361 @@ INSERT INTO users (username, email, password, role) VALUES
 ('employee', 'employee@store.com', 'employee123', 'employee');
 
 ALTER TABLE product_variants ADD COLUMN image_url VARCHAR(500);
-ALTER TABLE products ADD COLUMN image_url VARCHAR(500);
\ No newline at end of file
+ALTER TABLE products ADD COLUMN image_url VARCHAR(500);
+
+-- Indexes for filtering the audit trail
+CREATE INDEX idx_audit_logs_table_record ON audit_logs (table_name, record_id);
+CREATE INDEX idx_audit_logs_user ON audit_logs (user_id, created_at);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs (created_at);
+
+-- Two-factor authentication (TOTP, RFC 6238)
+ALTER TABLE users
+ADD COLUMN totp_secret VARCHAR(64) NULL,
+ADD COLUMN totp_enabled BOOLEAN DEFAULT FALSE,
+ADD COLUMN totp_last_step BIGINT NULL;
+
+-- Single-use recovery codes, stored as SHA-256 hashes
+CREATE TABLE user_recovery_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_recovery_user_hash (user_id, code_hash)
+);
+
+-- Multi-store support
+CREATE TABLE stores (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(20) UNIQUE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    address TEXT,
+    phone VARCHAR(20),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+-- Stores a user may work in; is_default picks the store when none is selected
+CREATE TABLE user_stores (
+    user_id INT NOT NULL,
+    store_id INT NOT NULL,
+    is_default BOOLEAN DEFAULT FALSE,
+    PRIMARY KEY (user_id, store_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE CASCADE
+);
+
+-- Per-store variant quantities. product_variants.current_stock holds the
+-- total across all stores and is kept in sync with this table.
+CREATE TABLE store_stock (
+    store_id INT NOT NULL,
+    product_variant_id INT NOT NULL,
+    quantity INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (store_id, product_variant_id),
+    FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_variant_id) REFERENCES product_variants(id) ON DELETE CASCADE,
+    INDEX idx_store_stock_variant (product_variant_id)
+);
+
+ALTER TABLE stock_entries
+ADD COLUMN store_id INT,
+ADD FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE SET NULL;
+
+ALTER TABLE sales
+ADD COLUMN store_id INT,
+ADD FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE SET NULL;
+
+-- Existing data belongs to the original shop
+INSERT INTO stores (code, name) VALUES ('MAIN', 'Main Store');
+UPDATE stock_entries SET store_id = 1 WHERE store_id IS NULL;
+UPDATE sales SET store_id = 1 WHERE store_id IS NULL;
+INSERT INTO user_stores (user_id, store_id, is_default) SELECT id, 1, TRUE FROM users;
+INSERT INTO store_stock (store_id, product_variant_id, quantity) SELECT 1, id, current_stock FROM product_variants;
+
+-- Stock adjustments are recorded per variant and store
+ALTER TABLE stock_adjustments
+ADD COLUMN product_variant_id INT,
+ADD COLUMN store_id INT,
+ADD FOREIGN KEY (product_variant_id) REFERENCES product_variants(id) ON DELETE CASCADE,
+ADD FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE SET NULL;
+
+-- Inter-store stock transfers
+CREATE TABLE stock_transfers (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    transfer_number VARCHAR(50) UNIQUE NOT NULL,
+    source_store_id INT NOT NULL,
+    destination_store_id INT NOT NULL,
+    status ENUM('requested', 'dispatched', 'partially_received', 'received', 'cancelled') DEFAULT 'requested',
+    notes TEXT,
+    requested_by INT,
+    dispatched_by INT,
+    received_by INT,
+    requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    dispatched_at TIMESTAMP NULL,
+    received_at TIMESTAMP NULL,
+    FOREIGN KEY (source_store_id) REFERENCES stores(id),
+    FOREIGN KEY (destination_store_id) REFERENCES stores(id),
+    FOREIGN KEY (requested_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (dispatched_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (received_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_transfers_status (status)
+);
+
+CREATE TABLE stock_transfer_items (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    transfer_id INT NOT NULL,
+    product_variant_id INT NOT NULL,
+    quantity_requested INT NOT NULL,
+    quantity_dispatched INT NOT NULL DEFAULT 0,
+    quantity_received INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (transfer_id) REFERENCES stock_transfers(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_variant_id) REFERENCES product_variants(id) ON DELETE CASCADE
+);
+
+-- Approval workflow for manual stock adjustments
+ALTER TABLE stock_adjustments
+ADD COLUMN quantity INT NOT NULL DEFAULT 0,
+ADD COLUMN reason_code ENUM('damaged', 'theft', 'found', 'expired', 'count_error', 'transfer', 'other') DEFAULT 'other',
+ADD COLUMN status ENUM('pending', 'approved', 'rejected') DEFAULT 'approved',
+ADD COLUMN approved_by INT NULL,
+ADD COLUMN approved_at TIMESTAMP NULL,
+ADD FOREIGN KEY (approved_by) REFERENCES users(id) ON DELETE SET NULL,
+ADD INDEX idx_stock_adjustments_status (status);
+
+-- Stock-take (cycle count) sessions
+CREATE TABLE stock_takes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    reference VARCHAR(50) UNIQUE NOT NULL,
+    store_id INT NOT NULL,
+    category_id INT NULL,
+    brand_id INT NULL,
+    status ENUM('open', 'approved', 'cancelled') DEFAULT 'open',
+    notes TEXT,
+    created_by INT,
+    approved_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    approved_at TIMESTAMP NULL,
+    FOREIGN KEY (store_id) REFERENCES stores(id),
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE SET NULL,
+    FOREIGN KEY (brand_id) REFERENCES brands(id) ON DELETE SET NULL,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (approved_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Expected quantity is snapshotted when the session opens; counted_quantity
+-- stays NULL until the first scan
+CREATE TABLE stock_take_lines (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    stock_take_id INT NOT NULL,
+    product_variant_id INT NOT NULL,
+    expected_quantity INT NOT NULL,
+    counted_quantity INT NULL,
+    FOREIGN KEY (stock_take_id) REFERENCES stock_takes(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_variant_id) REFERENCES product_variants(id) ON DELETE CASCADE,
+    UNIQUE KEY uq_stock_take_variant (stock_take_id, product_variant_id)
+);
+
+-- Individual scans, kept so counts from several devices can be traced
+CREATE TABLE stock_take_counts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    stock_take_id INT NOT NULL,
+    product_variant_id INT NOT NULL,
+    quantity INT NOT NULL,
+    device_id VARCHAR(100),
+    counted_by INT,
+    counted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (stock_take_id) REFERENCES stock_takes(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_variant_id) REFERENCES product_variants(id) ON DELETE CASCADE,
+    FOREIGN KEY (counted_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Barcodes are unique per variant; blank barcodes become NULL so they do not
+-- collide, and where several variants share a barcode only the oldest keeps
+-- it (generate the missing ones with POST /variants/barcodes/generate)
+UPDATE product_variants SET barcode = NULL WHERE barcode = '';
+UPDATE product_variants v
+JOIN (
+    SELECT barcode, MIN(id) AS keep_id
+    FROM product_variants
+    WHERE barcode IS NOT NULL
+    GROUP BY barcode
+    HAVING COUNT(*) > 1
+) dup ON dup.barcode = v.barcode AND v.id <> dup.keep_id
+SET v.barcode = NULL;
+ALTER TABLE product_variants ADD UNIQUE KEY uq_variant_barcode (barcode);
+
+-- Size-run presets used when generating variant matrices
+CREATE TABLE size_runs (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    category_id INT NULL,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    sizes VARCHAR(500) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+INSERT INTO size_runs (category_id, code, name, sizes)
+SELECT id, 'uk_footwear', 'UK footwear 6-11', '6,7,8,9,10,11' FROM categories WHERE name = 'Footwear';
+
+INSERT INTO size_runs (category_id, code, name, sizes)
+SELECT id, 'uk_kids_footwear', 'UK kids footwear', 'C8,C9,C10,C11,C12,C13,1,2,3' FROM categories WHERE name = 'Footwear';
+
+INSERT INTO size_runs (category_id, code, name, sizes)
+SELECT id, 'luggage', 'Luggage S/M/L', 'S,M,L' FROM categories WHERE name = 'Luggage';
+
+-- products.updated_at is the version checked by If-Match on product writes;
+-- microsecond precision keeps two edits in the same second apart
+ALTER TABLE products
+MODIFY updated_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6);
+
+-- Display order for categories, subcategories and brands
+ALTER TABLE categories ADD COLUMN sort_order INT NOT NULL DEFAULT 0;
+ALTER TABLE subcategories ADD COLUMN sort_order INT NOT NULL DEFAULT 0;
+ALTER TABLE brands ADD COLUMN sort_order INT NOT NULL DEFAULT 0;
+
+-- Images may belong to one variant of the product; product_variants.image_url
+-- mirrors the variant's main image. There is at most one main image for the
+-- product itself and one per variant.
+ALTER TABLE product_images
+ADD COLUMN product_variant_id INT NULL AFTER product_id,
+ADD FOREIGN KEY (product_variant_id) REFERENCES product_variants(id) ON DELETE CASCADE,
+ADD INDEX idx_product_images_order (product_id, display_order);
+
+-- Reordering: a variant is suggested for reorder when stock on hand plus
+-- stock on order falls to its reorder point. Unset points and quantities are
+-- derived from sales velocity and the supplier's lead time. A variant
+-- without supplier_id is ordered from the supplier of its latest stock entry.
+ALTER TABLE suppliers ADD COLUMN lead_time_days INT NOT NULL DEFAULT 7;
+
+ALTER TABLE product_variants
+ADD COLUMN reorder_point INT NULL,
+ADD COLUMN reorder_quantity INT NULL,
+ADD COLUMN supplier_id INT NULL,
+ADD FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE SET NULL;
+
+CREATE TABLE purchase_orders (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    po_number VARCHAR(50) UNIQUE NOT NULL,
+    supplier_id INT NOT NULL,
+    store_id INT NOT NULL,
+    status ENUM('draft', 'ordered', 'received', 'cancelled') DEFAULT 'draft',
+    notes TEXT,
+    created_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+    FOREIGN KEY (store_id) REFERENCES stores(id),
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_purchase_orders_status (status)
+);
+
+CREATE TABLE purchase_order_items (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    purchase_order_id INT NOT NULL,
+    product_variant_id INT NOT NULL,
+    quantity INT NOT NULL,
+    unit_cost DECIMAL(10,2) NOT NULL DEFAULT 0,
+    FOREIGN KEY (purchase_order_id) REFERENCES purchase_orders(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_variant_id) REFERENCES product_variants(id) ON DELETE RESTRICT
+);
+
+-- Stock alerts: raised when a variant's quantity at a store falls to the
+-- product's low_stock_threshold (low_stock) or to zero (out_of_stock). At
+-- most one alert per store, variant and type is open at a time; it is
+-- resolved once stock recovers. open_key is NULL for resolved alerts so the
+-- unique key only covers open ones.
+CREATE TABLE stock_alerts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    store_id INT NOT NULL,
+    product_variant_id INT NOT NULL,
+    alert_type ENUM('low_stock', 'out_of_stock') NOT NULL,
+    quantity INT NOT NULL,
+    threshold INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    acknowledged_by INT NULL,
+    acknowledged_at TIMESTAMP NULL,
+    resolved_at TIMESTAMP NULL,
+    open_key TINYINT AS (IF(resolved_at IS NULL, 1, NULL)) STORED,
+    FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_variant_id) REFERENCES product_variants(id) ON DELETE CASCADE,
+    FOREIGN KEY (acknowledged_by) REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE KEY uq_stock_alerts_open (store_id, product_variant_id, alert_type, open_key),
+    INDEX idx_stock_alerts_resolved (resolved_at)
+);
+
+-- Delivery of each alert through each notifier (webhook, smtp, in_app)
+CREATE TABLE stock_alert_deliveries (
+    stock_alert_id INT NOT NULL,
+    notifier VARCHAR(50) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    delivered_at TIMESTAMP NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (stock_alert_id, notifier),
+    FOREIGN KEY (stock_alert_id) REFERENCES stock_alerts(id) ON DELETE CASCADE
+);
+
+-- In-app notifications, read per user
+CREATE TABLE notifications (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    store_id INT NULL,
+    stock_alert_id INT NULL,
+    title VARCHAR(255) NOT NULL,
+    message TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE CASCADE,
+    FOREIGN KEY (stock_alert_id) REFERENCES stock_alerts(id) ON DELETE CASCADE,
+    INDEX idx_notifications_created (created_at)
+);
+
+CREATE TABLE notification_reads (
+    notification_id INT NOT NULL,
+    user_id INT NOT NULL,
+    read_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (notification_id, user_id),
+    FOREIGN KEY (notification_id) REFERENCES notifications(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Two-factor login attempts, one row per mfa_token (stored as its SHA-256
+-- hash). A token allows a limited number of code attempts and is spent by
+-- the first successful one.
+CREATE TABLE mfa_challenges (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    used_at TIMESTAMP NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_mfa_challenges_expires (expires_at)
+);
+
+-- Category, brand and subcategory names are unique (case-insensitively,
+-- through the column collation) so concurrent creates cannot both succeed.
+-- Existing duplicates keep the name on their oldest row; later ones get
+-- their id appended and can be renamed or deactivated afterwards.
+UPDATE categories t
+JOIN (SELECT name, MIN(id) AS keep_id FROM categories GROUP BY name HAVING COUNT(*) > 1) dup
+    ON dup.name = t.name AND t.id <> dup.keep_id
+SET t.name = CONCAT(LEFT(t.name, 85), ' (', t.id, ')');
+UPDATE brands t
+JOIN (SELECT name, MIN(id) AS keep_id FROM brands GROUP BY name HAVING COUNT(*) > 1) dup
+    ON dup.name = t.name AND t.id <> dup.keep_id
+SET t.name = CONCAT(LEFT(t.name, 85), ' (', t.id, ')');
+UPDATE subcategories t
+JOIN (SELECT category_id, name, MIN(id) AS keep_id FROM subcategories
+      WHERE category_id IS NOT NULL GROUP BY category_id, name HAVING COUNT(*) > 1) dup
+    ON dup.category_id = t.category_id AND dup.name = t.name AND t.id <> dup.keep_id
+SET t.name = CONCAT(LEFT(t.name, 85), ' (', t.id, ')');
+ALTER TABLE categories ADD UNIQUE KEY uq_category_name (name);
+ALTER TABLE brands ADD UNIQUE KEY uq_brand_name (name);
+ALTER TABLE subcategories ADD UNIQUE KEY uq_subcategory_name (category_id, name);
+
+-- Two-factor failures per user, across mfa_tokens. Reaching the limit locks
+-- two-factor login until mfa_locked_until; a correct code resets the count.
+ALTER TABLE users
+ADD COLUMN mfa_failed_attempts INT NOT NULL DEFAULT 0,
+ADD COLUMN mfa_locked_until TIMESTAMP NULL;